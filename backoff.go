@@ -0,0 +1,100 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff is the policy for spacing connection attempts after a failure.
+// The first retry waits Initial, each following retry waits Factor times
+// longer up to Max. Each wait is shortened by up to a tenth at random so
+// clients do not retry in step. Zero fields use the DefaultBackoff value.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	Factor  float64
+}
+
+// DefaultBackoff is used for fields of a Backoff that are not set.
+var DefaultBackoff = Backoff{
+	Initial: 100 * time.Millisecond,
+	Max:     30 * time.Second,
+	Factor:  2,
+}
+
+func (b Backoff) withDefaults() Backoff {
+	if b.Initial <= 0 {
+		b.Initial = DefaultBackoff.Initial
+	}
+	if b.Max <= 0 {
+		b.Max = DefaultBackoff.Max
+	}
+	if b.Max < b.Initial {
+		b.Max = b.Initial
+	}
+	if b.Factor < 1 {
+		b.Factor = DefaultBackoff.Factor
+	}
+	return b
+}
+
+// BackoffState tracks consecutive failed connection attempts for a Backoff.
+// Drivers use it in reconnect, warm up and health check paths.
+// It is not safe for concurrent use.
+type BackoffState struct {
+	policy   Backoff
+	failures int
+	delay    time.Duration
+	wait     time.Duration
+}
+
+// NewBackoffState returns the state for the policy with no failures.
+func NewBackoffState(policy Backoff) *BackoffState {
+	return &BackoffState{policy: policy.withDefaults()}
+}
+
+// Fail records a failed attempt and returns the time to wait before the
+// next attempt.
+func (s *BackoffState) Fail() time.Duration {
+	s.failures++
+	if s.failures == 1 {
+		s.delay = s.policy.Initial
+	} else {
+		s.delay = time.Duration(float64(s.delay) * s.policy.Factor)
+	}
+	if s.delay > s.policy.Max {
+		s.delay = s.policy.Max
+	}
+	s.wait = s.delay
+	if jitter := int64(s.delay / 10); jitter > 0 {
+		s.wait -= time.Duration(rand.Int63n(jitter + 1))
+	}
+	return s.wait
+}
+
+// Succeed records a successful attempt and resets the state.
+func (s *BackoffState) Succeed() {
+	s.failures = 0
+	s.delay = 0
+	s.wait = 0
+}
+
+// Failures returns the number of consecutive failed attempts.
+func (s *BackoffState) Failures() int {
+	return s.failures
+}
+
+// Delay returns the policy delay after the last failure before jitter,
+// zero if the last attempt did not fail.
+func (s *BackoffState) Delay() time.Duration {
+	return s.delay
+}
+
+// Wait returns the time to wait returned by the last call to Fail.
+func (s *BackoffState) Wait() time.Duration {
+	return s.wait
+}
@@ -4,6 +4,26 @@
 
 package rdb
 
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"math/big"
+	"time"
+)
+
+func init() {
+	// Register value types drivers commonly return so they may be stored
+	// in an encoded Buffer.
+	gob.Register(time.Time{})
+	gob.Register(time.Duration(0))
+	gob.Register(&big.Int{})
+	gob.Register(&big.Rat{})
+	gob.Register(&big.Float{})
+}
+
 // Buffer provides a database table buffer.
 type Buffer struct {
 	Name   string
@@ -11,5 +31,136 @@ type Buffer struct {
 	Schema Schema
 }
 
+// Release releases any rows created with NewValueRow so their storage may
+// be reused. The buffer and its rows must not be used after Release.
+func (b *Buffer) Release() {
+	for _, row := range b.Row {
+		if vr, ok := row.(*ValueRow); ok {
+			vr.Release()
+		}
+	}
+	b.Row = nil
+}
+
+// gobBuffer is the encoded form of a Buffer.
+type gobBuffer struct {
+	Name   string
+	Schema Schema
+	Rows   [][]interface{}
+}
+
+// GobEncode encodes the buffer schema and rows. Values of types other than
+// the built-in types, time.Time, time.Duration and the math/big number
+// types must be registered with gob.Register.
+func (b Buffer) GobEncode() ([]byte, error) {
+	enc := gobBuffer{
+		Name:   b.Name,
+		Schema: b.Schema,
+		Rows:   make([][]interface{}, len(b.Row)),
+	}
+	for i, row := range b.Row {
+		values := make([]interface{}, len(b.Schema))
+		for j := range values {
+			values[j] = row.Getx(j)
+		}
+		enc.Rows[i] = values
+	}
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(enc)
+	return buf.Bytes(), err
+}
+
+// GobDecode decodes a buffer encoded with GobEncode. The decoded rows are
+// ValueRows.
+func (b *Buffer) GobDecode(data []byte) error {
+	var dec gobBuffer
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&dec); err != nil {
+		return err
+	}
+	b.Name = dec.Name
+	b.Schema = dec.Schema
+	b.Row = make([]Row, len(dec.Rows))
+	for i, values := range dec.Rows {
+		vr := NewValueRow(dec.Schema)
+		copy(vr.Values, values)
+		b.Row[i] = vr
+	}
+	return nil
+}
+
+// JSON returns the rows as a JSON array of objects keyed by column name
+// in column order. Times are encoded as RFC 3339 and bytes as base64.
+func (b Buffer) JSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := b.WriteJSON(buf)
+	return buf.Bytes(), err
+}
+
+// WriteJSON writes the rows to w in the format of JSON.
+func (b Buffer) WriteJSON(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if err := b.writeJSON(bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (b Buffer) writeJSON(w *bufio.Writer) error {
+	keys := make([][]byte, len(b.Schema))
+	for i, col := range b.Schema {
+		key, err := json.Marshal(col.Name)
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+	w.WriteByte('[')
+	for i, row := range b.Row {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteByte('{')
+		for j, key := range keys {
+			if j > 0 {
+				w.WriteByte(',')
+			}
+			value, err := json.Marshal(row.Getx(j))
+			if err != nil {
+				return err
+			}
+			w.Write(key)
+			w.WriteByte(':')
+			w.Write(value)
+		}
+		w.WriteByte('}')
+	}
+	_, err := w.WriteString("]")
+	return err
+}
+
 // BufferSet is a list of Buffers.
 type BufferSet []*Buffer
+
+// JSON returns the buffers as a JSON array with an element for each
+// buffer as encoded by Buffer.JSON.
+func (set BufferSet) JSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := set.WriteJSON(buf)
+	return buf.Bytes(), err
+}
+
+// WriteJSON writes the buffers to w in the format of JSON.
+func (set BufferSet) WriteJSON(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('[')
+	for i, b := range set {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		if err := b.writeJSON(bw); err != nil {
+			return err
+		}
+	}
+	bw.WriteByte(']')
+	return bw.Flush()
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+)
+
+func TestBufferGob(t *testing.T) {
+	schema := rdb.Schema{
+		{Name: "ID", Index: 0, Type: rdb.TypeInt64},
+		{Name: "Name", Index: 1, Type: rdb.TypeText, Nullable: true, Length: 50},
+		{Name: "Data", Index: 2, Type: rdb.TypeBinary},
+		{Name: "At", Index: 3, Type: rdb.TypeTimestampz},
+		{Name: "Amount", Index: 4, Type: rdb.TypeDecimal, Precision: 10, Scale: 2},
+	}
+	at := time.Date(2016, 5, 1, 12, 30, 0, 0, time.FixedZone("X", -5*3600))
+	rows := [][]interface{}{
+		{int64(1), "Ann", []byte{1, 2, 3}, at, big.NewRat(1234, 100)},
+		{int64(2), nil, []byte{}, at.Add(time.Hour), big.NewRat(-5, 1)},
+	}
+	in := rdb.Buffer{Name: "Account", Schema: schema}
+	for _, values := range rows {
+		in.Row = append(in.Row, &rdb.ValueRow{Schema: schema, Values: values})
+	}
+
+	data := &bytes.Buffer{}
+	if err := gob.NewEncoder(data).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out rdb.Buffer
+	if err := gob.NewDecoder(data).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	defer out.Release()
+
+	if out.Name != in.Name {
+		t.Errorf("got name %q", out.Name)
+	}
+	if !reflect.DeepEqual(out.Schema, schema) {
+		t.Errorf("got schema %+v", out.Schema)
+	}
+	if len(out.Row) != len(rows) {
+		t.Fatalf("got %d rows, want %d", len(out.Row), len(rows))
+	}
+	for i, values := range rows {
+		row := out.Row[i]
+		if got := row.Get("ID"); got != values[0] {
+			t.Errorf("row %d: got ID %v", i, got)
+		}
+		if got := row.Get("Name"); got != values[1] {
+			t.Errorf("row %d: got Name %v", i, got)
+		}
+		if got := row.Get("Data").([]byte); !bytes.Equal(got, values[2].([]byte)) {
+			t.Errorf("row %d: got Data %v", i, got)
+		}
+		if got := row.Get("At").(time.Time); !got.Equal(values[3].(time.Time)) {
+			t.Errorf("row %d: got At %v", i, got)
+		}
+		if got := row.Get("Amount").(*big.Rat); got.Cmp(values[4].(*big.Rat)) != 0 {
+			t.Errorf("row %d: got Amount %v", i, got)
+		}
+	}
+}
+
+func TestBufferJSON(t *testing.T) {
+	schema := rdb.Schema{
+		{Name: "ID", Index: 0},
+		{Name: "Name", Index: 1},
+		{Name: "Data", Index: 2},
+		{Name: "At", Index: 3},
+		{Name: "Active", Index: 4},
+		{Name: "Score", Index: 5},
+	}
+	at := time.Date(2016, 5, 1, 12, 30, 0, 0, time.FixedZone("X", -5*3600))
+	b := &rdb.Buffer{Schema: schema, Row: []rdb.Row{
+		&rdb.ValueRow{Schema: schema, Values: []interface{}{int64(1), "Ann \"A\"", []byte("hi"), at, true, 1.5}},
+		&rdb.ValueRow{Schema: schema, Values: []interface{}{int64(2), nil, []byte{}, at.UTC(), false, nil}},
+	}}
+	const golden = `[{"ID":1,"Name":"Ann \"A\"","Data":"aGk=","At":"2016-05-01T12:30:00-05:00","Active":true,"Score":1.5},` +
+		`{"ID":2,"Name":null,"Data":"","At":"2016-05-01T17:30:00Z","Active":false,"Score":null}]`
+
+	got, err := b.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != golden {
+		t.Fatalf("got\n%s\nwant\n%s", got, golden)
+	}
+
+	empty := &rdb.Buffer{Schema: schema}
+	got, err = rdb.BufferSet{b, empty}.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[" + golden + ",[]]"; string(got) != want {
+		t.Fatalf("got set\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrConnectionBusy is returned when a query is run on a Connection or
+// Transaction while a Result from a previous query is still open and the
+// driver does not support multiple active result sets.
+var ErrConnectionBusy = errors.New("rdb: connection busy with an open result")
+
+// MARSSupporter may be implemented by a driver Pool to declare that a
+// connection may have multiple active result sets at the same time.
+type MARSSupporter interface {
+	MultipleActiveResultSets() bool
+}
+
+// busyGuard marks a single connection busy from the time a query is sent
+// until its results are read or it is closed.
+type busyGuard struct {
+	open int32
+}
+
+// query returns ErrConnectionBusy if a previous query is still open,
+// otherwise it runs the query and tracks it until it is done.
+func (g *busyGuard) query(run func() Next) Next {
+	if !atomic.CompareAndSwapInt32(&g.open, 0, 1) {
+		return &nextError{err: ErrConnectionBusy}
+	}
+	return &busyNext{Next: run(), guard: g}
+}
+
+// busyNext releases the guard when closed, when a result is closed, or
+// when its last result is fully read or buffered.
+type busyNext struct {
+	Next
+
+	guard   *busyGuard
+	done    int32
+	pending *busyResult // Read when the previous result was exhausted.
+	end     bool        // Set when the read ahead found no more results.
+}
+
+func (n *busyNext) driverNext() Next {
+	return n.Next
+}
+
+func (n *busyNext) release() {
+	if atomic.CompareAndSwapInt32(&n.done, 0, 1) {
+		atomic.StoreInt32(&n.guard.open, 0)
+	}
+}
+
+// exhausted is called when a result has been read to the end. The next
+// result is read ahead and the guard released if there is none.
+func (n *busyNext) exhausted() error {
+	if n.pending != nil || atomic.LoadInt32(&n.done) != 0 {
+		return nil
+	}
+	res, err := n.Next.Result()
+	if res == nil || err != nil {
+		n.end = err == nil
+		n.release()
+		return err
+	}
+	n.pending = &busyResult{Result: res, next: n}
+	return nil
+}
+
+func (n *busyNext) Result() (Result, error) {
+	if res := n.pending; res != nil {
+		n.pending = nil
+		return res, nil
+	}
+	if n.end {
+		return nil, nil
+	}
+	res, err := n.Next.Result()
+	if res == nil || err != nil {
+		n.release()
+		return res, err
+	}
+	return &busyResult{Result: res, next: n}, nil
+}
+
+func (n *busyNext) Buffer() (*Buffer, error) {
+	var b *Buffer
+	var err error
+	if res := n.pending; res != nil {
+		n.pending = nil
+		b, err = BufferRemaining(res.Result)
+	} else if !n.end {
+		b, err = n.Next.Buffer()
+	}
+	if b == nil || err != nil {
+		n.release()
+		return b, err
+	}
+	return b, n.exhausted()
+}
+
+func (n *busyNext) BufferSet() (BufferSet, error) {
+	defer n.release()
+	var set BufferSet
+	if res := n.pending; res != nil {
+		n.pending = nil
+		b, err := BufferRemaining(res.Result)
+		if err != nil {
+			return set, err
+		}
+		set = append(set, b)
+	}
+	if n.end {
+		return set, nil
+	}
+	more, err := n.Next.BufferSet()
+	return append(set, more...), err
+}
+
+func (n *busyNext) Close() error {
+	defer n.release()
+	return n.Next.Close()
+}
+
+type busyResult struct {
+	Result
+
+	next *busyNext
+	end  bool
+}
+
+func (res *busyResult) Prep(name string, value interface{}) Result {
+	res.Result.Prep(name, value)
+	return res
+}
+
+func (res *busyResult) Prepx(index int, value interface{}) Result {
+	res.Result.Prepx(index, value)
+	return res
+}
+
+func (res *busyResult) Scan() (Row, error) {
+	if res.end {
+		return nil, nil
+	}
+	row, err := res.Result.Scan()
+	if err != nil {
+		res.next.release()
+		return row, err
+	}
+	if row == nil {
+		res.end = true
+		return nil, res.next.exhausted()
+	}
+	return row, nil
+}
+
+func (res *busyResult) ScanInto(row *ValueRow) (bool, error) {
+	if res.end {
+		return false, nil
+	}
+	ok, err := ScanInto(res.Result, row)
+	if err != nil {
+		res.next.release()
+		return ok, err
+	}
+	if !ok {
+		res.end = true
+		return false, res.next.exhausted()
+	}
+	return true, nil
+}
+
+func (res *busyResult) Close() error {
+	defer res.next.release()
+	return res.Result.Close()
+}
@@ -0,0 +1,193 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestConnectionBusy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, mars := range []bool{false, true} {
+		fake := rdbtest.New()
+		fake.MARS = mars
+		fake.Expect("select ID from Account;").Returns(rdbtest.NewResult("ID").Row(1).Row(2))
+		fake.Expect("select 1;")
+		pool, err := rdb.Open(ctx, fake.Config())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := pool.Connection(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := conn.Query(ctx, &rdb.Command{SQL: "select ID from Account;"}).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := res.Scan(); err != nil {
+			t.Fatal(err)
+		}
+		err = conn.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close()
+		switch {
+		case !mars && err != rdb.ErrConnectionBusy:
+			t.Fatalf("got %v with open result, want ErrConnectionBusy", err)
+		case mars && err != nil:
+			t.Fatalf("got %v with open result and MARS", err)
+		}
+
+		// Reading to the end of the result frees the connection.
+		for {
+			row, err := res.Scan()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row == nil {
+				break
+			}
+		}
+		if err := conn.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != nil {
+			t.Fatalf("got %v after result was read", err)
+		}
+		conn.Close()
+	}
+}
+
+func TestTransactionBusy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID from Account;").Returns(rdbtest.NewResult("ID").Row(1))
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := pool.Begin(ctx, rdb.IsoDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tx.Query(ctx, &rdb.Command{SQL: "select ID from Account;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Query(ctx, &rdb.Command{SQL: "select ID from Account;"}).Buffer(); err != rdb.ErrConnectionBusy {
+		t.Fatalf("got %v, want ErrConnectionBusy", err)
+	}
+	res.Close()
+	if _, err := tx.Query(ctx, &rdb.Command{SQL: "select ID from Account;"}).Buffer(); err != nil {
+		t.Fatalf("got %v after result was closed", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionBusyClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID from Account;").Returns(rdbtest.NewResult("ID").Row(1).Row(2))
+	fake.Expect("select 1;")
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	conn, err := pool.Connection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Closing the query after a partial read frees the connection.
+	next := conn.Query(ctx, &rdb.Command{SQL: "select ID from Account;"})
+	res, err := next.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := res.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if err := next.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != nil {
+		t.Fatalf("got %v after query was closed", err)
+	}
+
+	// A query not yet read keeps the connection busy.
+	first := conn.Query(ctx, &rdb.Command{SQL: "select ID from Account;"})
+	if err := conn.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != rdb.ErrConnectionBusy {
+		t.Fatalf("got %v with unread query, want ErrConnectionBusy", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != nil {
+		t.Fatalf("got %v after unread query was closed", err)
+	}
+}
+
+func TestConnectionBusyResults(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID from Account; select ID from Name;").Returns(
+		rdbtest.NewResult("ID").Row(1),
+		rdbtest.NewResult("ID").Row(2),
+	)
+	fake.Expect("select 1;")
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	conn, err := pool.Connection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	next := conn.Query(ctx, &rdb.Command{SQL: "select ID from Account; select ID from Name;"})
+	for i := 0; i < 2; i++ {
+		res, err := next.Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res == nil {
+			t.Fatalf("got no result %d", i)
+		}
+		if err := conn.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != rdb.ErrConnectionBusy {
+			t.Fatalf("got %v before result %d was read, want ErrConnectionBusy", err, i)
+		}
+		for {
+			row, err := res.Scan()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row == nil {
+				break
+			}
+		}
+	}
+
+	// Reading the last result to the end frees the connection.
+	if err := conn.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != nil {
+		t.Fatalf("got %v after all results were read", err)
+	}
+	if res, err := next.Result(); res != nil || err != nil {
+		t.Fatalf("got %v, %v after the last result, want none", res, err)
+	}
+}
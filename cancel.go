@@ -0,0 +1,29 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import "errors"
+
+// ErrCanceled is returned by a query stopped with CancelQuery.
+var ErrCanceled = errors.New("rdb: query canceled")
+
+// QueryCanceler may be implemented by a driver Next to ask the server to
+// abort the running statement, such as with a SQL Server attention or a
+// PostgreSQL cancel request. The query should then fail with ErrCanceled.
+// Cancel must be safe to call while the query is being read.
+type QueryCanceler interface {
+	Cancel() error
+}
+
+// CancelQuery asks the server to abort the statement running for next
+// without canceling its context, such as from another goroutine while the
+// result is read. ErrNotSupported is returned if the driver cannot cancel
+// a single query.
+func CancelQuery(next Next) error {
+	if c, ok := driverNextOf(next).(QueryCanceler); ok {
+		return c.Cancel()
+	}
+	return ErrNotSupported
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestCancelQuery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("waitfor delay '01:00';").Block()
+	fake.Expect("select 1;")
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	next := pool.Query(ctx, &rdb.Command{SQL: "waitfor delay '01:00';"})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		if err := rdb.CancelQuery(next); err != nil {
+			t.Error(err)
+		}
+	}()
+	start := time.Now()
+	if _, err := next.Buffer(); err != rdb.ErrCanceled {
+		t.Fatalf("got %v, want %v", err, rdb.ErrCanceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("query took %v to cancel", elapsed)
+	}
+	next.Close()
+	if ctx.Err() != nil {
+		t.Fatal("context canceled with the query")
+	}
+
+	// The connection is returned and the pool is still usable.
+	if err := pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range fake.Status().Connections() {
+		if !c.Idle {
+			t.Errorf("connection not returned to the pool %+v", c)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+// Capabilities describes the features a driver supports.
+type Capabilities struct {
+	PlaceholderStyle   PlaceholderStyle // Placeholder syntax the driver expects.
+	NamedParams        bool             // Parameters may be bound by name.
+	MultipleResultSets bool             // A connection may have multiple active result sets.
+	BulkCopy           bool             // Rows may be loaded with a bulk copy.
+	Savepoints         bool             // Transactions support SavePoint and RollbackTo.
+	ReturningClause    bool             // Statements may return rows with a RETURNING or OUTPUT clause.
+	XA                 bool             // Distributed transactions are supported.
+	Upsert             UpsertSyntax     // Insert-or-update syntax, UpsertNone if not supported.
+	Quote              QuoteStyle       // Quoting of identifiers and literals.
+	Isolations         IsolationSet     // Supported isolation levels, empty if not declared.
+	MaxPacketSize      int              // Max bytes of a message sent to the server, zero if not limited.
+}
+
+// Capabler may be implemented by a driver Pool to declare its capabilities.
+// It takes precedence over PlaceholderStyler, NamedParamSupporter,
+// MARSSupporter and UpsertSyntaxer. A driver Connection should also implement it so the
+// capabilities of a connection used without its pool may be found.
+type Capabler interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf returns the capabilities of the driver behind q.
+//
+// If the driver does not implement Capabler they are taken from the
+// single feature interfaces it implements, such as PlaceholderStyler.
+// Features without such an interface are reported as not supported.
+func CapabilitiesOf(q Queryer) Capabilities {
+	switch q := q.(type) {
+	case *pool:
+		return q.caps
+	case *transaction:
+		return q.pool.caps
+	case *connection:
+		return q.pool.caps
+	}
+	return driverCapabilities(driverOf(q))
+}
+
+// DriverNamer may be implemented by a driver Pool, Connection and
+// Transaction to report the name the driver is registered with, the
+// Config.DriverName it opens.
+type DriverNamer interface {
+	DriverName() string
+}
+
+// DriverName returns the name of the driver behind q. It is the
+// Config.DriverName of a Pool returned from Open and of its Connections and
+// Transactions. Empty if the driver does not implement DriverNamer.
+func DriverName(q Queryer) string {
+	switch q := q.(type) {
+	case *pool:
+		return q.conf.DriverName
+	case *transaction:
+		return q.pool.conf.DriverName
+	case *connection:
+		return q.pool.conf.DriverName
+	}
+	if n, ok := driverOf(q).(DriverNamer); ok {
+		return n.DriverName()
+	}
+	return ""
+}
+
+func driverCapabilities(driver interface{}) Capabilities {
+	if c, ok := driver.(Capabler); ok {
+		return c.Capabilities()
+	}
+	var caps Capabilities
+	if styler, ok := driver.(PlaceholderStyler); ok {
+		caps.PlaceholderStyle = styler.PlaceholderStyle()
+	}
+	caps.NamedParams = caps.PlaceholderStyle.native()
+	if supporter, ok := driver.(NamedParamSupporter); ok {
+		caps.NamedParams = supporter.NamedParams()
+	}
+	if supporter, ok := driver.(MARSSupporter); ok {
+		caps.MultipleResultSets = supporter.MultipleActiveResultSets()
+	}
+	if syntaxer, ok := driver.(UpsertSyntaxer); ok {
+		caps.Upsert = syntaxer.UpsertSyntax()
+	}
+	_, caps.XA = driver.(DistributedBeginner)
+	return caps
+}
+
+// Capabilities returns the capabilities of the driver.
+func (p *pool) Capabilities() Capabilities {
+	return p.caps
+}
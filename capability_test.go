@@ -0,0 +1,120 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+// styledPool only declares a placeholder style and upsert syntax.
+type styledPool struct {
+	rdb.Pool
+}
+
+func (styledPool) PlaceholderStyle() rdb.PlaceholderStyle {
+	return rdb.PlaceholderDollar
+}
+
+func (styledPool) UpsertSyntax() rdb.UpsertSyntax {
+	return rdb.UpsertOnConflict
+}
+
+func TestCapabilities(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderAtP
+	fake.MARS = true
+	fake.Returning = true
+	fake.Upsert = rdb.UpsertMerge
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	want := rdb.Capabilities{
+		PlaceholderStyle:   rdb.PlaceholderAtP,
+		NamedParams:        true,
+		MultipleResultSets: true,
+		Savepoints:         true,
+		ReturningClause:    true,
+		Upsert:             rdb.UpsertMerge,
+	}
+	if got := rdb.CapabilitiesOf(pool); got != want {
+		t.Errorf("pool: got %+v, want %+v", got, want)
+	}
+	tx, err := pool.Begin(ctx, rdb.IsoDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rdb.CapabilitiesOf(tx); got != want {
+		t.Errorf("transaction: got %+v, want %+v", got, want)
+	}
+	tx.Commit(ctx)
+
+	if _, err := pool.(rdb.DistributedBeginner).BeginDistributed(ctx, rdb.IsoDefault, "xid"); err != rdb.ErrNotSupported {
+		t.Errorf("got %v, want ErrNotSupported without XA", err)
+	}
+
+	got := rdb.CapabilitiesOf(styledPool{fake})
+	want = rdb.Capabilities{PlaceholderStyle: rdb.PlaceholderDollar, Upsert: rdb.UpsertOnConflict}
+	if got != want {
+		t.Errorf("styled pool: got %+v, want %+v", got, want)
+	}
+}
+
+func TestConnectionDriver(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderDollar
+	fake.Positional = true
+	fake.BulkCopy = true
+	want := rdb.Capabilities{
+		PlaceholderStyle: rdb.PlaceholderDollar,
+		BulkCopy:         true,
+		Savepoints:       true,
+	}
+
+	// A driver connection used without its pool.
+	conn, err := fake.Connection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rdb.DriverName(conn); got != rdbtest.DriverName {
+		t.Errorf("driver connection: got driver %q, want %q", got, rdbtest.DriverName)
+	}
+	if got := rdb.CapabilitiesOf(conn); got != want {
+		t.Errorf("driver connection: got %+v, want %+v", got, want)
+	}
+	conn.Close()
+
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	conn, err = pool.Connection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := rdb.DriverName(conn); got != rdbtest.DriverName {
+		t.Errorf("connection: got driver %q, want %q", got, rdbtest.DriverName)
+	}
+	if got := rdb.CapabilitiesOf(conn); got != want {
+		t.Errorf("connection: got %+v, want %+v", got, want)
+	}
+	if got := rdb.DriverName(styledPool{}); got != "" {
+		t.Errorf("got driver %q for a pool without a name", got)
+	}
+}
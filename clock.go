@@ -0,0 +1,24 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import "time"
+
+// Clock tells the time. Tests may set Config.Clock to a clock they advance
+// so connection lifetimes and reconnect backoff are checked without
+// waiting.
+type Clock interface {
+	Now() time.Time
+}
+
+// Now returns the time of Config.Clock, or the system time if the config or
+// its clock is nil. Drivers should use it to age connections and space
+// reconnect attempts.
+func (c *Config) Now() time.Time {
+	if c == nil || c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
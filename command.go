@@ -0,0 +1,89 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Append adds the SQL fragment to the end of the command SQL, separated by
+// a space if neither side has white space.
+func (c *Command) Append(sqlFragment string) *Command {
+	c.SQL = appendSQL(c.SQL, sqlFragment)
+	return c
+}
+
+func appendSQL(sql, fragment string) string {
+	if len(sql) == 0 || len(fragment) == 0 {
+		return sql + fragment
+	}
+	last, _ := utf8.DecodeLastRuneInString(sql)
+	first, _ := utf8.DecodeRuneInString(fragment)
+	if unicode.IsSpace(last) || unicode.IsSpace(first) {
+		return sql + fragment
+	}
+	return sql + " " + fragment
+}
+
+// Rendered returns the SQL and parameters of the command as they are sent
+// to a driver with the placeholder style, without running the command.
+// Struct parameters are expanded and, unless the style binds by name,
+// named references are replaced by position.
+func (c *Command) Rendered(style PlaceholderStyle, params []Param) (sql string, ordered []Param, err error) {
+	cmd, ordered, err := render(c, params, style, !style.native())
+	if err != nil {
+		return "", nil, err
+	}
+	return cmd.SQL, ordered, nil
+}
+
+// CommandBuilder builds command SQL and its parameters together so each
+// placeholder written has a matching parameter.
+//
+//	b := &rdb.CommandBuilder{}
+//	b.WriteString("select * from Account where 1=1")
+//	if len(name) != 0 {
+//		b.WriteString(" and Name = ").Param(rdb.Param{Value: name})
+//	}
+//	cmd, params := b.Build()
+type CommandBuilder struct {
+	// Command is the template for the built command. Its SQL is ignored.
+	Command Command
+
+	buf    bytes.Buffer
+	params []Param
+}
+
+// WriteString adds SQL text to the command. The text should not contain
+// placeholders, use Param to add them.
+func (b *CommandBuilder) WriteString(sql string) *CommandBuilder {
+	b.buf.WriteString(sql)
+	return b
+}
+
+// Param adds a placeholder to the SQL and the parameter to the list.
+// A named parameter is written as "@name", otherwise as "?".
+func (b *CommandBuilder) Param(p Param) *CommandBuilder {
+	if name := trimParamName(p.Name); len(name) != 0 {
+		b.buf.WriteByte('@')
+		b.buf.WriteString(name)
+	} else {
+		b.buf.WriteByte('?')
+	}
+	b.params = append(b.params, p)
+	return b
+}
+
+// Build returns the command and its parameters in placeholder order.
+// The builder may continue to be used after Build.
+func (b *CommandBuilder) Build() (*Command, []Param) {
+	cmd := b.Command
+	cmd.SQL = b.buf.String()
+	params := make([]Param, len(b.params))
+	copy(params, b.params)
+	return &cmd, params
+}
@@ -0,0 +1,121 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kardianos/rdb"
+)
+
+func TestCommandAppend(t *testing.T) {
+	cmd := &rdb.Command{SQL: "select * from Account"}
+	cmd.Append("where ID = ?").Append("\norder by ID")
+	if want := "select * from Account where ID = ?\norder by ID"; cmd.SQL != want {
+		t.Fatalf("got %q, want %q", cmd.SQL, want)
+	}
+}
+
+func TestCommandBuilder(t *testing.T) {
+	build := func(name string, minID int) (*rdb.Command, []rdb.Param) {
+		b := &rdb.CommandBuilder{Command: rdb.Command{Name: "find"}}
+		b.WriteString("select * from Account where 1=1")
+		if len(name) != 0 {
+			b.WriteString(" and Name = ").Param(rdb.Param{Value: name})
+		}
+		if minID != 0 {
+			b.WriteString(" and ID >= ").Param(rdb.Param{Name: "minID", Value: minID})
+		}
+		b.WriteString(";")
+		return b.Build()
+	}
+
+	list := []struct {
+		name   string
+		minID  int
+		sql    string
+		values []interface{}
+	}{
+		{"", 0, "select * from Account where 1=1;", nil},
+		{"Ann", 0, "select * from Account where 1=1 and Name = ?;", []interface{}{"Ann"}},
+		{"", 5, "select * from Account where 1=1 and ID >= @minID;", []interface{}{5}},
+		{"Ann", 5, "select * from Account where 1=1 and Name = ? and ID >= @minID;", []interface{}{"Ann", 5}},
+	}
+	for _, item := range list {
+		cmd, params := build(item.name, item.minID)
+		if cmd.SQL != item.sql {
+			t.Errorf("got %q, want %q", cmd.SQL, item.sql)
+		}
+		if cmd.Name != "find" {
+			t.Errorf("command name not kept, got %q", cmd.Name)
+		}
+		if len(params) != len(item.values) {
+			t.Errorf("%q: got %d params, want %d", item.sql, len(params), len(item.values))
+			continue
+		}
+		for i, p := range params {
+			if p.Value != item.values[i] {
+				t.Errorf("%q: param %d got %v, want %v", item.sql, i, p.Value, item.values[i])
+			}
+		}
+
+		// The SQL and parameters agree after rewriting.
+		_, ordered, err := rdb.PlaceholderDollar.Rewrite(cmd, params)
+		if err != nil {
+			t.Errorf("%q: %v", item.sql, err)
+		} else if len(ordered) != len(item.values) {
+			t.Errorf("%q: rewrite got %d params", item.sql, len(ordered))
+		}
+	}
+}
+
+func TestCommandRendered(t *testing.T) {
+	cmd := &rdb.Command{SQL: "select * from Account where ID = @ID and (Name = @Name or Alias = @Name);"}
+	params := []rdb.Param{{Name: "Name", Value: "Ann"}, {Name: "ID", Value: 1}}
+	list := []struct {
+		Style rdb.PlaceholderStyle
+		SQL   string
+		Order []interface{}
+	}{
+		{rdb.PlaceholderDollar, "select * from Account where ID = $1 and (Name = $2 or Alias = $2);", []interface{}{1, "Ann"}},
+		{rdb.PlaceholderQuestion, "select * from Account where ID = ? and (Name = ? or Alias = ?);", []interface{}{1, "Ann", "Ann"}},
+	}
+	for _, item := range list {
+		sql, ordered, err := cmd.Rendered(item.Style, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql != item.SQL {
+			t.Errorf("style %d: got %q, want %q", item.Style, sql, item.SQL)
+		}
+		var values []interface{}
+		for _, p := range ordered {
+			values = append(values, p.Value)
+		}
+		if !reflect.DeepEqual(values, item.Order) {
+			t.Errorf("style %d: got values %v, want %v", item.Style, values, item.Order)
+		}
+	}
+	if cmd.SQL != "select * from Account where ID = @ID and (Name = @Name or Alias = @Name);" {
+		t.Errorf("command SQL changed to %q", cmd.SQL)
+	}
+
+	insert := &rdb.Command{SQL: "insert into Account (ID, Name) values (@ID, @name);"}
+	sql, ordered, err := insert.Rendered(rdb.PlaceholderDollar, []rdb.Param{rdb.Struct(user{ID: 4, Name: "Bob"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "insert into Account (ID, Name) values ($1, $2);"; sql != want {
+		t.Errorf("got %q, want %q", sql, want)
+	}
+	if len(ordered) != 2 || ordered[0].Value != int64(4) || ordered[1].Value != "Bob" {
+		t.Errorf("got params %+v", ordered)
+	}
+
+	if _, _, err := cmd.Rendered(rdb.PlaceholderDollar, params[:1]); err == nil {
+		t.Error("expected error for a missing parameter")
+	}
+}
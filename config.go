@@ -6,9 +6,12 @@ package rdb
 
 import (
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/net/context"
 )
 
 // Config for database connection.
@@ -29,10 +32,19 @@ type Config struct {
 	Instance string
 	Database string // Initial database to connect to.
 
+	// Schema search path for the session, such as "app, public". Drivers
+	// should set it on each new connection after the database is set,
+	// such as with "SET search_path" in PostgreSQL.
+	Schema string
+
 	// Time for an idle connection to be closed.
 	// Zero if there should be no timeout.
 	PoolIdleTimeout time.Duration
 
+	// Close a connection once it is this old rather then hand it out or
+	// return it to the pool. Zero if there is no limit.
+	PoolMaxLifetime time.Duration
+
 	// How many connection should be created at startup.
 	// Valid range is (0 < init, init <= max).
 	PoolInitCapacity int
@@ -41,6 +53,68 @@ type Config struct {
 	// Valid range is (0 < max).
 	PoolMaxCapacity int
 
+	// Max time a query waits for a connection when the pool is at
+	// PoolMaxCapacity before failing with ErrPoolTimeout.
+	// Zero waits until the context is done.
+	PoolWaitTimeout time.Duration
+
+	// Max number of idle connections to keep in the pool. Connections
+	// returned beyond this are closed. Zero uses PoolInitCapacity.
+	PoolMaxIdle int
+
+	// Close a connection once it has served this many queries rather then
+	// return it to the pool. Zero if there is no limit.
+	PoolMaxQueriesPerConn int
+
+	// Max number of rows a query run through a pool returned from Open may
+	// read from all of its results and buffers. Reading more fails the
+	// query with ErrRowLimitExceeded. Buffers are checked once read.
+	// Zero if there is no limit.
+	MaxRowsPerQuery int64
+
+	// Max size in bytes of a message sent to the server. Drivers that
+	// negotiate a packet size, such as TDS, should request it. Batch helpers
+	// such as Upsert split their rows into statements under the limit.
+	// Zero uses the driver default.
+	MaxPacketSize int
+
+	// ValidationQuery, such as "select 1;", is run to check a connection is
+	// alive in place of a protocol ping, for proxies that answer pings when
+	// the server is down. Drivers should run it on an idle connection
+	// before handing it out and close the connection if it fails. Ping on
+	// a pool returned from Open, including the health check, runs it
+	// rather then pinging the driver.
+	ValidationQuery string
+
+	// HealthCheckInterval, if set, is the time between the pings run in
+	// the background so Healthy reports a failing database without
+	// pinging it. After a failed ping the next waits for ReconnectBackoff
+	// if that is longer.
+	HealthCheckInterval time.Duration
+
+	// Number of pings that must fail in a row for Healthy to report the
+	// pool is not healthy. Zero uses 3.
+	HealthFailures int
+
+	// OpenRetry sets how many times Open tries to open the driver when it
+	// fails with a transient error, see IsTransient. Other errors, such as
+	// a failed login or an unknown database, are returned at once.
+	OpenRetry OpenRetry
+
+	// Clock is read by drivers to age connections, see Now. Nil uses the
+	// system clock and should be left nil outside of tests. It is exported
+	// as drivers in other packages read it and tests of code that uses a
+	// driver set it, see rdbtest.Clock. Drivers built on a pool with its
+	// own clock, such as database/sql, cannot honour it.
+	Clock Clock
+
+	// ReconnectBackoff spaces the attempts of the driver to establish a
+	// connection after an attempt fails. A pool returned from Open also
+	// uses it to space the health check pings after a ping fails, and
+	// between the attempts of Open unless OpenRetry.Interval is set. Zero
+	// fields use DefaultBackoff.
+	ReconnectBackoff Backoff
+
 	// Require the driver to establish a secure connection.
 	Secure bool
 
@@ -48,9 +122,176 @@ type Config struct {
 	// Ignored if Secure is false.
 	InsecureSkipVerify bool
 
+	// Client character set and collation for the session, such as "utf8mb4".
+	// Drivers should set them when a connection is established.
+	// Empty uses the server default.
+	Charset   string
+	Collation string
+
+	// Location of timestamps without a time zone. Drivers should set the
+	// session time zone to it where supported. Timestamp columns read
+	// through a pool returned from Open are interpreted in the location.
+	// Nil leaves timestamps as the driver returns them.
+	Location *time.Location
+
+	// TimeLayouts are tried in order, before RFC 3339 and the common SQL
+	// layouts, when a text column is read into a time.Time destination
+	// through a pool returned from Open. Times without a time zone are
+	// parsed in Location, or UTC if nil.
+	TimeLayouts []string
+
+	// CacheSchema asks drivers that support it to keep a SchemaCache on
+	// each connection so the result schema of a prepared statement is
+	// described once rather then on every execution.
+	CacheSchema bool
+
+	// FetchColumnComments asks drivers to set the Comment of each result
+	// column. Drivers that must run an extra metadata query to read them
+	// should only do so if set, and may cache them with the schema.
+	FetchColumnComments bool
+
+	// DefaultCommand options are applied to each command run through a pool
+	// returned from Open that does not set them. Values set on a command
+	// are used instead.
+	DefaultCommand CommandDefaults
+
+	// InitSQL statements are run by the driver once on each new connection,
+	// after the Database and Schema are set and before the connection is
+	// first used. If a statement fails the connection is closed and the
+	// error is returned to the caller that asked for the connection.
+	InitSQL []string
+
+	// DryRun checks commands run through a pool returned from Open without
+	// sending them to the driver, for tools that lint SQL. Query and the
+	// Exec of a prepared Statement apply the command defaults, BeforeQuery,
+	// the placeholder rewrite and the parameter checks, then return an
+	// error or a Next without results. No connection is taken. Begin and
+	// Connection are not changed and still reach the driver.
+	DryRun bool
+
+	// BeforeQuery, if set, is called with each command run through a pool
+	// returned from Open just before it is sent to the driver. The command
+	// and parameters returned are run in its place, and may be the ones
+	// passed in. Change a copy of the command rather then the command
+	// passed in. An error fails the query without running it. For the Exec
+	// of a prepared Statement only the parameters returned are used.
+	BeforeQuery func(ctx context.Context, cmd *Command, params []Param) (*Command, []Param, error)
+
+	// IncludeParamsInErrors wraps errors the driver returns for a query
+	// run through a pool returned from Open in a *QueryError with the
+	// command name, the SQL and the names, types and lengths of the
+	// parameters. Values are masked. Context errors are not wrapped.
+	IncludeParamsInErrors bool
+
+	// UnsafeIncludeParamValues also includes parameter values in a
+	// *QueryError, other then those marked NoTrace. Errors are often
+	// logged; values may hold secrets or personal data.
+	UnsafeIncludeParamValues bool
+
+	// OnQuery, if set, is called after every query run through a pool
+	// returned from Open, when the query is closed or fully read.
+	OnQuery func(QueryMetric)
+
+	// OnInfo, if set, is called by the driver for each informational
+	// message the server sends during a query, in the order received.
+	// Messages do not stop the query.
+	OnInfo func(InfoMessage)
+
+	// OnTruncate, if set, is called by the driver each time it truncates
+	// text to fit a column because the command set TruncLongText.
+	// The query is not stopped.
+	OnTruncate func(TruncInfo)
+
+	// StrictIsolation returns an error when a transaction or command asks
+	// for an isolation level the driver does not support. Otherwise the
+	// nearest supported level is used, such as repeatable read for
+	// snapshot.
+	StrictIsolation bool
+
+	// DefaultIsolation is the level of a transaction begun with IsoDefault,
+	// including the implicit transaction of an Atomic command, so it does
+	// not depend on the driver or server default. It is resolved like any
+	// other level, see StrictIsolation. IsoDefault leaves the level to the
+	// driver.
+	DefaultIsolation Isolation
+
+	// CorrelationKey, if set, is the context key of a value such as a
+	// request ID that is reported in QueryMetric.Correlation so queries
+	// may be joined to the request that ran them.
+	CorrelationKey interface{}
+
 	KV map[string]interface{}
 }
 
+// MaxIdle returns the max number of idle connections to keep in the pool.
+// It is PoolMaxIdle if set, otherwise PoolInitCapacity.
+// Zero if there is no limit.
+func (c *Config) MaxIdle() int {
+	if c.PoolMaxIdle > 0 {
+		return c.PoolMaxIdle
+	}
+	return c.PoolInitCapacity
+}
+
+// Equal returns true if both configs have the same settings. Raw is not
+// compared as it is only the source of the other fields. KV is compared as a
+// map, an empty KV equals a nil KV. Location is compared by name and the
+// callbacks, which cannot be compared, only by whether they are set.
+func (c *Config) Equal(other *Config) bool {
+	return c.equal(other, false)
+}
+
+// EqualIgnoreSecrets is Equal but does not compare Password.
+func (c *Config) EqualIgnoreSecrets(other *Config) bool {
+	return c.equal(other, true)
+}
+
+func (c *Config) equal(other *Config, ignoreSecrets bool) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	if locationName(c.Location) != locationName(other.Location) ||
+		(c.BeforeQuery == nil) != (other.BeforeQuery == nil) ||
+		(c.OnQuery == nil) != (other.OnQuery == nil) ||
+		(c.OnInfo == nil) != (other.OnInfo == nil) ||
+		(c.OnTruncate == nil) != (other.OnTruncate == nil) {
+		return false
+	}
+	return reflect.DeepEqual(c.comparable(ignoreSecrets), other.comparable(ignoreSecrets))
+}
+
+// comparable returns a copy of the config without the fields that
+// reflect.DeepEqual must not compare.
+func (c *Config) comparable(ignoreSecrets bool) Config {
+	cc := *c
+	cc.Raw = ""
+	if ignoreSecrets {
+		cc.Password = ""
+	}
+	cc.Location = nil
+	cc.BeforeQuery = nil
+	cc.OnQuery = nil
+	cc.OnInfo = nil
+	cc.OnTruncate = nil
+	if len(cc.KV) == 0 {
+		cc.KV = nil
+	}
+	if len(cc.TimeLayouts) == 0 {
+		cc.TimeLayouts = nil
+	}
+	if len(cc.InitSQL) == 0 {
+		cc.InitSQL = nil
+	}
+	return cc
+}
+
+func locationName(loc *time.Location) string {
+	if loc == nil {
+		return ""
+	}
+	return loc.String()
+}
+
 // ParseConfigURL is a standard method to parse configuration options from a text.
 // The instance field can also hold the filename in case of a file based connection.
 //   driver://[username:password@][url[:port]]/[Instance]?db=mydatabase&opt1=valA&opt2=valB
@@ -58,11 +299,21 @@ type Config struct {
 //   sqlite:///srv/folder/file.sqlite3?opt1=valA&opt2=valB
 //   ms://TESTU@localhost/SqlExpress?db=master
 // This will attempt to find the driver to load additional parameters.
+// Other options are placed in KV, parsed if registered with RegisterOption.
 //   Additional field options:
 //      db=<string>:                  Database
+//      schema=<string>:              Schema, also search_path=<string>
 //      init_cap=<int>:               PoolInitCapacity
 //      max_cap=<int>:                PoolMaxCapacity
 //      idle_timeout=<time.Duration>: PoolIdleTimeout
+//      max_idle=<int>:               PoolMaxIdle
+//      wait_timeout=<time.Duration>: PoolWaitTimeout
+//      max_conn_queries=<int>:       PoolMaxQueriesPerConn
+//      charset=<string>:             Charset
+//      collation=<string>:           Collation
+//      loc=<string>:                 Location, as time.LoadLocation
+//      packet_size=<int>:            MaxPacketSize
+//      strict_isolation=<bool>:      StrictIsolation
 func ParseConfigURL(connectionString string) (*Config, error) {
 	u, err := url.Parse(connectionString)
 	if err != nil {
@@ -102,6 +353,13 @@ func ParseConfigURL(connectionString string) (*Config, error) {
 	conf.Database = val.Get("db")
 	val.Del("db")
 
+	conf.Schema = val.Get("schema")
+	if len(conf.Schema) == 0 {
+		conf.Schema = val.Get("search_path")
+	}
+	val.Del("schema")
+	val.Del("search_path")
+
 	if st := val.Get("idle_timeout"); len(st) != 0 {
 		conf.PoolIdleTimeout, err = time.ParseDuration(st)
 		if err != nil {
@@ -126,12 +384,72 @@ func ParseConfigURL(connectionString string) (*Config, error) {
 	}
 	val.Del("max_cap")
 
+	if st := val.Get("wait_timeout"); len(st) != 0 {
+		conf.PoolWaitTimeout, err = time.ParseDuration(st)
+		if err != nil {
+			return nil, err
+		}
+	}
+	val.Del("wait_timeout")
+
+	if st := val.Get("max_idle"); len(st) != 0 {
+		conf.PoolMaxIdle, err = strconv.Atoi(st)
+		if err != nil {
+			return nil, err
+		}
+	}
+	val.Del("max_idle")
+
+	if st := val.Get("max_conn_queries"); len(st) != 0 {
+		conf.PoolMaxQueriesPerConn, err = strconv.Atoi(st)
+		if err != nil {
+			return nil, err
+		}
+	}
+	val.Del("max_conn_queries")
+
+	conf.Charset = val.Get("charset")
+	val.Del("charset")
+
+	conf.Collation = val.Get("collation")
+	val.Del("collation")
+
+	if st := val.Get("loc"); len(st) != 0 {
+		conf.Location, err = time.LoadLocation(st)
+		if err != nil {
+			return nil, err
+		}
+	}
+	val.Del("loc")
+
+	if st := val.Get("packet_size"); len(st) != 0 {
+		conf.MaxPacketSize, err = strconv.Atoi(st)
+		if err != nil {
+			return nil, err
+		}
+	}
+	val.Del("packet_size")
+
+	if st := val.Get("strict_isolation"); len(st) != 0 {
+		conf.StrictIsolation, err = strconv.ParseBool(st)
+		if err != nil {
+			return nil, err
+		}
+	}
+	val.Del("strict_isolation")
+
 	if len(u.Path) > 0 {
 		conf.Instance = u.Path[1:]
 	}
 
+	if len(val) != 0 {
+		conf.KV = make(map[string]interface{}, len(val))
+	}
 	for key, value := range val {
 		conf.KV[key] = value
 	}
+	if err := conf.parseOptions(); err != nil {
+		return nil, err
+	}
 	return conf, nil
 }
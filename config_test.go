@@ -0,0 +1,328 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestParseConfigCharset(t *testing.T) {
+	conf, err := rdb.ParseConfigURL("my://root@localhost:3306/?db=app&charset=utf8mb4&collation=utf8mb4_unicode_ci&tls=skip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Charset != "utf8mb4" {
+		t.Errorf("got charset %q", conf.Charset)
+	}
+	if conf.Collation != "utf8mb4_unicode_ci" {
+		t.Errorf("got collation %q", conf.Collation)
+	}
+	if _, found := conf.KV["charset"]; found {
+		t.Error("charset left in KV")
+	}
+	if _, found := conf.KV["tls"]; !found {
+		t.Error("tls missing from KV")
+	}
+}
+
+func TestOpenCharset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	conf, err := rdb.ParseConfigURL("rdbtest:///" + fake.Config().Instance + "?charset=latin1&collation=latin1_swedish_ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rdb.Open(ctx, conf); err != nil {
+		t.Fatal(err)
+	}
+	opened := fake.Opened()
+	if opened == nil {
+		t.Fatal("pool not opened")
+	}
+	if opened.Charset != "latin1" || opened.Collation != "latin1_swedish_ci" {
+		t.Fatalf("driver got charset %q collation %q", opened.Charset, opened.Collation)
+	}
+}
+
+func TestParseConfigPool(t *testing.T) {
+	conf, err := rdb.ParseConfigURL("ms://localhost/?init_cap=2&max_cap=20&max_conn_queries=1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.PoolMaxCapacity != 20 || conf.PoolMaxQueriesPerConn != 1000 {
+		t.Fatalf("got max capacity %d, max queries per connection %d", conf.PoolMaxCapacity, conf.PoolMaxQueriesPerConn)
+	}
+	if conf.MaxIdle() != 2 {
+		t.Errorf("got default max idle %d, want init capacity", conf.MaxIdle())
+	}
+	conf, err = rdb.ParseConfigURL("ms://localhost/?init_cap=2&max_idle=5&wait_timeout=2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.MaxIdle() != 5 {
+		t.Errorf("got max idle %d, want 5", conf.MaxIdle())
+	}
+	if conf.PoolWaitTimeout != 2*time.Second {
+		t.Errorf("got wait timeout %v", conf.PoolWaitTimeout)
+	}
+}
+
+func TestParseConfigStrictIsolation(t *testing.T) {
+	conf, err := rdb.ParseConfigURL("pg://localhost/?strict_isolation=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conf.StrictIsolation || conf.KV != nil {
+		t.Fatalf("got strict isolation %t, KV %v", conf.StrictIsolation, conf.KV)
+	}
+	if _, err := rdb.ParseConfigURL("pg://localhost/?strict_isolation=maybe"); err == nil {
+		t.Fatal("expected error for invalid bool")
+	}
+}
+
+func TestParseConfigPacketSize(t *testing.T) {
+	conf, err := rdb.ParseConfigURL("ms://localhost/?packet_size=32768")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.MaxPacketSize != 32768 || conf.KV != nil {
+		t.Fatalf("got packet size %d, KV %v", conf.MaxPacketSize, conf.KV)
+	}
+	if _, err := rdb.ParseConfigURL("ms://localhost/?packet_size=big"); err == nil {
+		t.Fatal("expected error for invalid packet size")
+	}
+	conf, err = rdb.ParseConfigDSN("Server=db1;Packet Size=8000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.MaxPacketSize != 8000 {
+		t.Fatalf("got DSN packet size %d, want 8000", conf.MaxPacketSize)
+	}
+}
+
+func TestRegisterOption(t *testing.T) {
+	rdb.RegisterOption("optfake", "tls", rdb.OptionBool)
+	rdb.RegisterOption("optfake", "pool_timeout", rdb.OptionDuration)
+	rdb.RegisterOption("optfake", "Retries", rdb.OptionInt)
+	rdb.RegisterOption("optfake", "app", rdb.OptionString)
+
+	conf, err := rdb.ParseConfigURL("optfake://localhost/?tls=true&pool_timeout=30&retries=3&app=billing&other=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"tls":          true,
+		"pool_timeout": 30 * time.Second,
+		"retries":      3,
+		"app":          []string{"billing"},
+		"other":        []string{"1"},
+	}
+	if !reflect.DeepEqual(conf.KV, want) {
+		t.Fatalf("got KV %#v, want %#v", conf.KV, want)
+	}
+
+	conf, err = rdb.ParseConfigDSN("Driver=optfake;Server=db1;TLS=off;Pool_Timeout=1m30s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.KV["TLS"] != false || conf.KV["Pool_Timeout"] != 90*time.Second {
+		t.Fatalf("got DSN KV %#v", conf.KV)
+	}
+
+	// Options of other drivers are left as text.
+	conf, err = rdb.ParseConfigURL("pg://localhost/?tls=maybe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conf.KV["tls"], []string{"maybe"}) {
+		t.Fatalf("got KV %#v", conf.KV)
+	}
+
+	for _, s := range []string{
+		"optfake://localhost/?tls=maybe",
+		"optfake://localhost/?retries=three",
+		"optfake://localhost/?pool_timeout=soon",
+	} {
+		if _, err := rdb.ParseConfigURL(s); err == nil {
+			t.Errorf("%s: expected error for malformed value", s)
+		}
+	}
+	if _, err := rdb.ParseConfigDSN("Driver=optfake;Retries=x"); err == nil {
+		t.Error("expected DSN error for malformed value")
+	}
+}
+
+func TestParseConfigSchema(t *testing.T) {
+	conf, err := rdb.ParseConfigURL("pg://localhost/?db=app&schema=app,public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Database != "app" || conf.Schema != "app,public" || conf.KV != nil {
+		t.Fatalf("got database %q, schema %q, KV %v", conf.Database, conf.Schema, conf.KV)
+	}
+	conf, err = rdb.ParseConfigURL("pg://localhost/?search_path=reporting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Schema != "reporting" || conf.KV != nil {
+		t.Fatalf("got schema %q, KV %v", conf.Schema, conf.KV)
+	}
+}
+
+func TestOpenSchema(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("USE app;")
+	fake.Expect("SET search_path TO reporting;")
+	fake.Expect("select 1;")
+	conf, err := rdb.ParseConfigURL("rdbtest:///" + fake.Config().Instance + "?db=app&schema=reporting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	for i := 0; i < 2; i++ {
+		if err := pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, c := range fake.Calls() {
+		got = append(got, c.SQL)
+	}
+	want := []string{"USE app;", "SET search_path TO reporting;", "select 1;", "select 1;"}
+	if len(got) != len(want) {
+		t.Fatalf("got calls %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got calls %q, want %q", got, want)
+		}
+	}
+}
+
+func TestParseConfigDSN(t *testing.T) {
+	conf, err := rdb.ParseConfigDSN(`Server=tcp:db1\SQLEXPRESS,1433;Database=app;User Id=svc;Password=secret;Max Pool Size=20;Min Pool Size=2;Connection Lifetime=300;Encrypt=yes;TrustServerCertificate=True;Application Name=billing`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Hostname != "db1" || conf.Instance != "SQLEXPRESS" || conf.Port != 1433 {
+		t.Errorf("got host %q instance %q port %d", conf.Hostname, conf.Instance, conf.Port)
+	}
+	if conf.Database != "app" || conf.Username != "svc" || conf.Password != "secret" {
+		t.Errorf("got database %q user %q password %q", conf.Database, conf.Username, conf.Password)
+	}
+	if conf.PoolMaxCapacity != 20 || conf.PoolInitCapacity != 2 {
+		t.Errorf("got max capacity %d, init capacity %d", conf.PoolMaxCapacity, conf.PoolInitCapacity)
+	}
+	if conf.PoolMaxLifetime != 5*time.Minute || conf.PoolIdleTimeout != 0 {
+		t.Errorf("got max lifetime %v, idle timeout %v", conf.PoolMaxLifetime, conf.PoolIdleTimeout)
+	}
+	if !conf.Secure || !conf.InsecureSkipVerify {
+		t.Errorf("got secure %t, skip verify %t", conf.Secure, conf.InsecureSkipVerify)
+	}
+	if conf.KV["Application Name"] != "billing" {
+		t.Errorf("got KV %v", conf.KV)
+	}
+}
+
+func TestParseConfigDSNQuoting(t *testing.T) {
+	list := []struct {
+		DSN      string
+		Password string
+		Database string
+	}{
+		{`Password="a;b";Database=app`, "a;b", "app"},
+		{`Password='it''s';Database=app`, "it's", "app"},
+		{`Password={x;}}y};Database=app`, "x;}y", "app"},
+		{`  PASSWORD = " p w " ; database =  app  ;;`, " p w ", "app"},
+		{`pwd=x=y;INITIAL CATALOG=app`, "x=y", "app"},
+	}
+	for _, item := range list {
+		conf, err := rdb.ParseConfigDSN(item.DSN)
+		if err != nil {
+			t.Errorf("%s: %v", item.DSN, err)
+			continue
+		}
+		if conf.Password != item.Password || conf.Database != item.Database {
+			t.Errorf("%s: got password %q database %q", item.DSN, conf.Password, conf.Database)
+		}
+	}
+	for _, dsn := range []string{
+		`Password="open;Database=app`,
+		`Password="a"b;Database=app`,
+		`=value`,
+		`Server`,
+		`Max Pool Size=many`,
+	} {
+		if _, err := rdb.ParseConfigDSN(dsn); err == nil {
+			t.Errorf("%s: expected error", dsn)
+		}
+	}
+}
+
+func TestConfigEqual(t *testing.T) {
+	parse := func(s string) *rdb.Config {
+		conf, err := rdb.ParseConfigURL(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conf
+	}
+	a := parse("ms://app:secret@localhost/?db=main&app_name=web&retries=2")
+	b := parse("ms://app:secret@localhost/?retries=2&app_name=web&db=main")
+	if !a.Equal(b) || !b.Equal(a) {
+		t.Fatal("configs with KV in a different order are not equal")
+	}
+
+	c := parse("ms://app:other@localhost/?db=main&app_name=web&retries=2")
+	if a.Equal(c) {
+		t.Fatal("configs with different passwords are equal")
+	}
+	if !a.EqualIgnoreSecrets(c) {
+		t.Fatal("configs differing only in password are not equal ignoring secrets")
+	}
+
+	d := parse("ms://app:secret@localhost/?db=main&app_name=api&retries=2")
+	if a.Equal(d) || a.EqualIgnoreSecrets(d) {
+		t.Fatal("configs with different KV values are equal")
+	}
+
+	b.OnQuery = func(rdb.QueryMetric) {}
+	if a.Equal(b) {
+		t.Fatal("config with OnQuery equals config without")
+	}
+	a.OnQuery = func(rdb.QueryMetric) {}
+	if !a.Equal(b) {
+		t.Fatal("configs that both set OnQuery are not equal")
+	}
+	before := func(ctx context.Context, cmd *rdb.Command, params []rdb.Param) (*rdb.Command, []rdb.Param, error) {
+		return cmd, params, nil
+	}
+	a.BeforeQuery = before
+	if !a.Equal(a) || a.Equal(b) {
+		t.Fatal("BeforeQuery not compared by whether it is set")
+	}
+	b.BeforeQuery = before
+	if !a.Equal(b) {
+		t.Fatal("configs that both set BeforeQuery are not equal")
+	}
+	if a.Equal(nil) || !(*rdb.Config)(nil).Equal(nil) {
+		t.Fatal("unexpected nil comparison")
+	}
+}
@@ -13,7 +13,10 @@ import (
 type key int
 
 const (
-	poolKey key = 0
+	poolKey      key = 0
+	txKey        key = 1
+	readOnlyKey  key = 2
+	isolationKey key = 3
 )
 
 // NewContext wraps a Pool in a context.
@@ -27,24 +30,91 @@ func FromContext(ctx context.Context) (Pool, bool) {
 	return pool, has
 }
 
+// ContextWithTx wraps a Transaction in a context so functions called with
+// the context may join the transaction.
+func ContextWithTx(ctx context.Context, tx Transaction) context.Context {
+	return context.WithValue(ctx, txKey, tx)
+}
+
+// TxFromContext returns a Transaction from a context.
+func TxFromContext(ctx context.Context) (Transaction, bool) {
+	tx, has := ctx.Value(txKey).(Transaction)
+	return tx, has
+}
+
+// From returns the Transaction in the context if present, otherwise the pool.
+func From(ctx context.Context, p Pool) Queryer {
+	if tx, has := TxFromContext(ctx); has {
+		return tx
+	}
+	return p
+}
+
 var (
 	errNoPoolContext = errors.New("No Pool in context")
 )
 
+// WithReadOnly returns a context that marks the commands run with it
+// through a pool returned from Open as ReadOnly.
+func WithReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey, true)
+}
+
+// WithIsolation returns a context that sets the Isolation of commands run
+// with it on a pool returned from Open that leave it at IsoDefault.
+func WithIsolation(ctx context.Context, iso Isolation) context.Context {
+	return context.WithValue(ctx, isolationKey, iso)
+}
+
+// withReadOnly returns the command marked ReadOnly if the context is from
+// WithReadOnly. The command is copied if it is changed.
+func withReadOnly(ctx context.Context, cmd *Command) *Command {
+	if cmd.ReadOnly {
+		return cmd
+	}
+	if ro, _ := ctx.Value(readOnlyKey).(bool); !ro {
+		return cmd
+	}
+	c := *cmd
+	c.ReadOnly = true
+	return &c
+}
+
+// withIsolation returns the command with the Isolation of a context from
+// WithIsolation if it does not set one. The command is copied if it is
+// changed.
+func withIsolation(ctx context.Context, cmd *Command) *Command {
+	if cmd.Isolation != IsoDefault {
+		return cmd
+	}
+	iso, ok := ctx.Value(isolationKey).(Isolation)
+	if !ok || iso == IsoDefault {
+		return cmd
+	}
+	c := *cmd
+	c.Isolation = iso
+	return &c
+}
+
 type nextError struct {
-	err error
+	err    error
+	closed bool
 }
 
-func (next nextError) Result() (Result, error) {
+func (next *nextError) Result() (Result, error) {
 	return nil, next.err
 }
-func (next nextError) Buffer() (*Buffer, error) {
+func (next *nextError) Buffer() (*Buffer, error) {
 	return nil, next.err
 }
-func (next nextError) BufferSet() (BufferSet, error) {
+func (next *nextError) BufferSet() (BufferSet, error) {
 	return nil, next.err
 }
-func (next nextError) Close() error {
+func (next *nextError) Close() error {
+	if next.closed {
+		return nil
+	}
+	next.closed = true
 	return next.err
 }
 
@@ -52,7 +122,7 @@ func (next nextError) Close() error {
 func Query(ctx context.Context, cmd *Command, params ...Param) Next {
 	pool, has := FromContext(ctx)
 	if !has {
-		return nextError{err: errNoPoolContext}
+		return &nextError{err: errNoPoolContext}
 	}
 	return pool.Query(ctx, cmd, params...)
 }
@@ -66,6 +136,18 @@ func Begin(ctx context.Context, iso Isolation) (Transaction, error) {
 	return pool.Begin(ctx, iso)
 }
 
+// BeginDistributed starts a transaction on the pool enlisted in the
+// distributed transaction identified by xid. A coordinator should call
+// Prepare on every participant before calling Commit on any of them.
+// ErrNotSupported is returned if the pool does not support it.
+func BeginDistributed(ctx context.Context, p Pool, iso Isolation, xid string) (Transaction, error) {
+	db, ok := p.(DistributedBeginner)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return db.BeginDistributed(ctx, iso, xid)
+}
+
 // QuerySet runs command and returns a list of buffers and closes any connections
 // it has opened before returning.
 func QuerySet(ctx context.Context, cmd *Command, params ...Param) (BufferSet, error) {
@@ -0,0 +1,152 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"fmt"
+	"time"
+)
+
+// Converter changes the value the driver read for a column before it is
+// read from the row, see Command.Converter.
+type Converter func(col Column, driverValue interface{}) (interface{}, error)
+
+// convertValues replaces each value with the converted value.
+func convertValues(conv Converter, schema Schema, values []interface{}) error {
+	for i, col := range schema {
+		if i >= len(values) {
+			break
+		}
+		v, err := conv(col, values[i])
+		if err != nil {
+			return fmt.Errorf("rdb: convert column %q: %v", col.Name, err)
+		}
+		values[i] = v
+	}
+	return nil
+}
+
+// convertNext applies the Converter of a command to every row read.
+type convertNext struct {
+	Next
+
+	conv    Converter
+	loc     *time.Location
+	layouts []string
+}
+
+func (n *convertNext) driverNext() Next {
+	return n.Next
+}
+
+func (n *convertNext) Result() (Result, error) {
+	res, err := n.Next.Result()
+	if res == nil {
+		return res, err
+	}
+	return &convertResult{Result: res, next: n}, err
+}
+
+func (n *convertNext) Buffer() (*Buffer, error) {
+	b, err := n.Next.Buffer()
+	if b != nil && err == nil {
+		err = n.convertBuffer(b)
+	}
+	return b, err
+}
+
+func (n *convertNext) BufferSet() (BufferSet, error) {
+	set, err := n.Next.BufferSet()
+	for _, b := range set {
+		if err != nil {
+			break
+		}
+		err = n.convertBuffer(b)
+	}
+	return set, err
+}
+
+func (n *convertNext) convertBuffer(b *Buffer) error {
+	for i, row := range b.Row {
+		vr, err := n.valueRow(row, b.Schema)
+		if err != nil {
+			return err
+		}
+		b.Row[i] = vr
+	}
+	return nil
+}
+
+// valueRow returns the row with its values converted. A *ValueRow is
+// converted in place, other rows are read into a new ValueRow.
+func (n *convertNext) valueRow(row Row, schema Schema) (*ValueRow, error) {
+	vr, ok := row.(*ValueRow)
+	if !ok {
+		vr = &ValueRow{
+			Schema:     schema,
+			Values:     make([]interface{}, len(schema)),
+			NullAsZero: rowNullAsZero(row),
+			layouts:    n.layouts,
+			loc:        n.loc,
+		}
+		for i := range vr.Values {
+			vr.Values[i] = row.Getx(i)
+		}
+	}
+	return vr, convertValues(n.conv, schema, vr.Values)
+}
+
+type convertResult struct {
+	Result
+
+	next *convertNext
+	prep map[int]interface{} // Bound here so the converted value is set.
+}
+
+func (res *convertResult) Prep(name string, value interface{}) Result {
+	for _, col := range res.Schema() {
+		if col.Name == name {
+			return res.Prepx(col.Index, value)
+		}
+	}
+	res.Result.Prep(name, value)
+	return res
+}
+
+func (res *convertResult) Prepx(index int, value interface{}) Result {
+	if res.prep == nil {
+		res.prep = make(map[int]interface{})
+	}
+	res.prep[index] = value
+	return res
+}
+
+func (res *convertResult) Scan() (Row, error) {
+	row, err := res.Result.Scan()
+	if row == nil {
+		return row, err
+	}
+	vr, err := res.next.valueRow(row, res.Schema())
+	if err != nil {
+		return nil, err
+	}
+	return PrepRow(vr, res.Schema(), res.prep)
+}
+
+func (res *convertResult) ScanInto(row *ValueRow) (bool, error) {
+	ok, err := ScanInto(res.Result, row)
+	if !ok {
+		return ok, err
+	}
+	if err := convertValues(res.next.conv, row.Schema, row.Values); err != nil {
+		return false, err
+	}
+	for index, dest := range res.prep {
+		if err := intox(row, index, dest); err != nil {
+			return false, err
+		}
+	}
+	return ok, err
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestCommandConverter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "select ID, Secret from Account;"
+	fake := rdbtest.New()
+	fake.Expect(sql).Returns(rdbtest.NewResult("ID", "Secret").
+		Row(int64(1), hex.EncodeToString([]byte("alpha"))).
+		Row(int64(2), "not hex"),
+	)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	var seen []string
+	decode := func(col rdb.Column, v interface{}) (interface{}, error) {
+		seen = append(seen, col.Name)
+		if col.Name != "Code" {
+			return v, nil
+		}
+		return hex.DecodeString(v.(string))
+	}
+	cmd := &rdb.Command{SQL: sql, Converter: decode, ColumnMap: map[string]string{"Secret": "Code"}}
+
+	res, err := pool.Query(ctx, cmd).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var code []byte
+	res.Prep("Code", &code)
+	row, err := res.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(code) != "alpha" || row.Get("ID") != int64(1) {
+		t.Fatalf("got ID %v, code %q", row.Get("ID"), code)
+	}
+	if strings.Join(seen, ",") != "ID,Code" {
+		t.Fatalf("converter called for %v", seen)
+	}
+	_, err = res.Scan()
+	if err == nil || !strings.Contains(err.Error(), `"Code"`) {
+		t.Fatalf("got %v, want convert error for Code", err)
+	}
+	res.Close()
+
+	// Without the converter the driver value is read.
+	b, err := pool.Query(ctx, &rdb.Command{SQL: sql}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Row[1].Get("Secret") != "not hex" {
+		t.Fatalf("got %v without converter", b.Row[1].Get("Secret"))
+	}
+
+	if _, err := pool.Query(ctx, cmd).Buffer(); err == nil {
+		t.Fatal("expected convert error from Buffer")
+	}
+}
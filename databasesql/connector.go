@@ -0,0 +1,353 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package databasesql
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/pkg/errors"
+)
+
+// connector opens connections of the database/sql driver and applies the
+// per connection settings of the config that database/sql does not have.
+// It is only used if the config sets one of them.
+type connector struct {
+	driver driver.Driver
+	dsn    string
+	base   driver.Connector // Nil if the driver is not a DriverContext.
+	config *rdb.Config
+	schema string // Statement that sets the Schema, empty if not set.
+
+	mu      sync.Mutex
+	backoff *rdb.BackoffState
+	retryAt time.Time // Time the next attempt may be made after a failure.
+}
+
+// needConnector returns true if the config has settings applied by the
+// connector.
+func needConnector(config *rdb.Config) bool {
+	return config.PoolMaxQueriesPerConn > 0 || len(config.InitSQL) != 0 || len(config.ValidationQuery) != 0 ||
+		config.ReconnectBackoff != (rdb.Backoff{}) || len(config.Schema) != 0
+}
+
+// schemaSQL returns the statement that sets the schema search path of a
+// session for the database/sql driver.
+func schemaSQL(driverName, schema string) (string, error) {
+	switch driverName {
+	case "mysql":
+		return "USE " + schema + ";", nil
+	case "godror", "oracle", "oci8":
+		return "ALTER SESSION SET CURRENT_SCHEMA = " + schema, nil
+	case "sqlserver", "mssql", "sqlite", "sqlite3":
+		return "", errors.Errorf("rdb: Schema is not supported by driver %q", driverName)
+	}
+	return "SET search_path TO " + schema + ";", nil
+}
+
+func newConnector(d driver.Driver, config *rdb.Config) (*connector, error) {
+	c := &connector{driver: d, dsn: config.Raw, config: config, backoff: rdb.NewBackoffState(config.ReconnectBackoff)}
+	if len(config.Schema) != 0 {
+		sql, err := schemaSQL(config.DriverName, config.Schema)
+		if err != nil {
+			return nil, err
+		}
+		c.schema = sql
+	}
+	if dc, ok := d.(driver.DriverContext); ok {
+		base, err := dc.OpenConnector(config.Raw)
+		if err != nil {
+			return nil, err
+		}
+		c.base = base
+	}
+	return c, nil
+}
+
+// Connect opens a connection. After a failed attempt the next waits for
+// the ReconnectBackoff.
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	wait := c.retryAt.Sub(c.config.Now())
+	c.mu.Unlock()
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	var dc driver.Conn
+	var err error
+	if c.base != nil {
+		dc, err = c.base.Connect(ctx)
+	} else {
+		dc, err = c.driver.Open(c.dsn)
+	}
+	c.mu.Lock()
+	if err != nil {
+		c.retryAt = c.config.Now().Add(c.backoff.Fail())
+	} else {
+		c.backoff.Succeed()
+		c.retryAt = time.Time{}
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	list := c.config.InitSQL
+	if len(c.schema) != 0 {
+		list = append([]string{c.schema}, list...)
+	}
+	for _, sql := range list {
+		if err := execConn(ctx, dc, sql); err != nil {
+			dc.Close()
+			return nil, err
+		}
+	}
+	return &conn{Conn: dc, config: c.config}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// execConn runs the SQL on the driver connection.
+func execConn(ctx context.Context, dc driver.Conn, sql string) error {
+	if ex, ok := dc.(driver.ExecerContext); ok {
+		_, err := ex.ExecContext(ctx, sql, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+	if ex, ok := dc.(driver.Execer); ok {
+		_, err := ex.Exec(sql, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+	st, err := dc.Prepare(sql)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	_, err = st.Exec(nil)
+	return err
+}
+
+// conn is a driver connection opened by a connector. It forwards the
+// optional interfaces of the driver connection and counts the queries run
+// on it.
+type conn struct {
+	driver.Conn
+
+	config  *rdb.Config
+	queries int
+}
+
+var (
+	_ driver.Pinger             = &conn{}
+	_ driver.NamedValueChecker  = &conn{}
+	_ driver.ExecerContext      = &conn{}
+	_ driver.QueryerContext     = &conn{}
+	_ driver.ConnBeginTx        = &conn{}
+	_ driver.ConnPrepareContext = &conn{}
+	_ driver.SessionResetter    = &conn{}
+	_ driver.Validator          = &conn{}
+)
+
+// IsValid is called by database/sql each time the connection is returned
+// to the pool. The connection is closed once it has served
+// PoolMaxQueriesPerConn queries.
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok && !v.IsValid() {
+		return false
+	}
+	max := c.config.PoolMaxQueriesPerConn
+	return max <= 0 || c.queries < max
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// CheckNamedValue returns driver.ErrSkip to use the default conversion if
+// the driver connection does not check values.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if ch, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	var res driver.Result
+	var err error
+	switch ex := c.Conn.(type) {
+	case driver.ExecerContext:
+		res, err = ex.ExecContext(ctx, query, args)
+	case driver.Execer:
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			res, err = ex.Exec(query, values)
+		}
+	default:
+		// Prepare the query.
+		return nil, driver.ErrSkip
+	}
+	if err != driver.ErrSkip {
+		c.queries++
+	}
+	return res, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	var rows driver.Rows
+	var err error
+	switch q := c.Conn.(type) {
+	case driver.QueryerContext:
+		rows, err = q.QueryContext(ctx, query, args)
+	case driver.Queryer:
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			rows, err = q.Query(query, values)
+		}
+	default:
+		// Prepare the query.
+		return nil, driver.ErrSkip
+	}
+	if err != driver.ErrSkip {
+		c.queries++
+	}
+	return rows, err
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != 0 {
+		return nil, errors.New("rdb: driver does not support an isolation level")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("rdb: driver does not support read-only transactions")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var st driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		st, err = p.PrepareContext(ctx, query)
+	} else {
+		st, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: st, conn: c}, nil
+}
+
+// namedValues returns the values for a driver that does not take names.
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if len(arg.Name) != 0 {
+			return nil, errors.New("rdb: driver does not support named parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+// stmt is a statement prepared on a conn. It forwards the optional
+// interfaces of the driver statement and counts each run as a query of
+// the connection.
+type stmt struct {
+	driver.Stmt
+
+	conn *conn
+}
+
+var (
+	_ driver.StmtExecContext   = &stmt{}
+	_ driver.StmtQueryContext  = &stmt{}
+	_ driver.NamedValueChecker = &stmt{}
+	_ driver.ColumnConverter   = &stmt{}
+)
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	s.conn.queries++
+	if ex, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return ex.ExecContext(ctx, args)
+	}
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Stmt.Exec(values)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	s.conn.queries++
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return q.QueryContext(ctx, args)
+	}
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Stmt.Query(values)
+}
+
+// CheckNamedValue uses the checker of the statement, then that of the
+// connection, or else returns driver.ErrSkip to use the default
+// conversion.
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if ch, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	return s.conn.CheckNamedValue(nv)
+}
+
+// ColumnConverter returns the converter of the driver statement or the
+// default.
+func (s *stmt) ColumnConverter(index int) driver.ValueConverter {
+	if cc, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return cc.ColumnConverter(index)
+	}
+	return driver.DefaultParameterConverter
+}
+
+// ResetSession is called by database/sql before an idle connection is
+// used again. The ValidationQuery is run and the connection is closed if
+// it fails.
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		if err := r.ResetSession(ctx); err != nil {
+			return err
+		}
+	}
+	if len(c.config.ValidationQuery) == 0 {
+		return nil
+	}
+	if err := execConn(ctx, c.Conn, c.config.ValidationQuery); err != nil {
+		return driver.ErrBadConn
+	}
+	return nil
+}
@@ -35,8 +35,32 @@ func (o *Opener) Open(ctx context.Context, config *rdb.Config) (rdb.Pool, error)
 	if err != nil {
 		return nil, err
 	}
+	if needConnector(config) {
+		c, err := newConnector(db.Driver(), config)
+		db.Close()
+		if err != nil {
+			return nil, err
+		}
+		db = sql.OpenDB(c)
+	}
+	if config.PoolMaxCapacity > 0 {
+		db.SetMaxOpenConns(config.PoolMaxCapacity)
+	}
+	if n := config.MaxIdle(); n > 0 {
+		db.SetMaxIdleConns(n)
+	}
+	if config.PoolMaxLifetime > 0 {
+		db.SetConnMaxLifetime(config.PoolMaxLifetime)
+	}
+	if config.PoolIdleTimeout > 0 {
+		db.SetConnMaxIdleTime(config.PoolIdleTimeout)
+	}
 	pool := &Pool{
 		DB: db,
 	}
+	if config.PoolWaitTimeout > 0 && config.PoolMaxCapacity > 0 {
+		pool.slots = make(chan struct{}, config.PoolMaxCapacity)
+		pool.wait = config.PoolWaitTimeout
+	}
 	return pool, nil
 }
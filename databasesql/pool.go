@@ -8,6 +8,9 @@
 // Limitations:
 //   Cannot cancel a query in progress due to underlying database/sql limitations.
 //   Does not respect rdb.Command.TextAsBytes parameter as the result data type is not available.
+//   Ages connections with the system clock rather then rdb.Config.Clock.
+//   Spaces reconnects by rdb.Config.ReconnectBackoff only if it is set.
+//   Sets rdb.Config.Schema by the driver name, "SET search_path" if not known.
 //
 //   import _ "github.com/kardianos/rdb/databasesql"
 //   import _ "my-database-sql-driver"
@@ -15,6 +18,8 @@ package databasesql // import "github.com/kardianos/rdb/databasesql"
 
 import (
 	"database/sql"
+	"sync"
+	"time"
 
 	"github.com/kardianos/rdb"
 	"github.com/pkg/errors"
@@ -29,13 +34,22 @@ var (
 // Pool implements rdb.Pool.
 type Pool struct {
 	DB *sql.DB
+
+	stmts stmtCache // Prepared for commands with Prepare set.
+
+	// Connections in use, nil unless the pool has a PoolWaitTimeout.
+	slots chan struct{}
+	wait  time.Duration
 }
 
 type next struct {
-	ctx    context.Context
-	err    error
-	rows   *sql.Rows
-	cancel func()
+	ctx     context.Context
+	err     error
+	rows    *sql.Rows
+	cancel  func()
+	closed  bool
+	closec  chan error // Receives the error closing the rows.
+	release func()     // Frees the connection of the pool once rows are closed.
 
 	textAsBytes bool
 }
@@ -43,30 +57,53 @@ type next struct {
 type statement struct {
 	ctx  context.Context
 	stmt *sql.Stmt
+	pool *Pool
 
 	truncateLongText bool
 	textAsBytes      bool
 }
 
 type transaction struct {
-	ctx context.Context
-	tx  *sql.Tx
+	ctx     context.Context
+	tx      *sql.Tx
+	iso     rdb.Isolation
+	pool    *Pool
+	done    chan struct{} // Closed by release.
+	release func()
+}
+
+// watch rolls back the transaction and frees its connection if the
+// context is done before the transaction ends.
+func (tx *transaction) watch() error {
+	select {
+	case <-tx.ctx.Done():
+		defer tx.release()
+		return tx.tx.Rollback()
+	case <-tx.done:
+		return nil
+	}
 }
+
 type result struct {
 	rows *sql.Rows
 }
 
 func (n *next) init() {
 	if n.err != nil {
+		if n.release != nil {
+			n.release()
+		}
 		return
 	}
 	n.ctx, n.cancel = context.WithCancel(n.ctx)
-	go func() {
-		select {
-		case <-n.ctx.Done():
-			n.rows.Close()
+	n.closec = make(chan error, 1)
+	rdb.GoSafe(nil, n.closec, func() error {
+		<-n.ctx.Done()
+		if n.release != nil {
+			defer n.release()
 		}
-	}()
+		return n.rows.Close()
+	})
 }
 func (n *next) Prep(name string, value interface{}) rdb.Result {
 	panic(errTODO)
@@ -108,7 +145,16 @@ func (n *next) BufferSet() (rdb.BufferSet, error) {
 }
 
 func (n *next) Close() error {
-	n.cancel()
+	if n.closed {
+		return nil
+	}
+	n.closed = true
+	if n.cancel != nil {
+		n.cancel()
+		if err := <-n.closec; n.err == nil {
+			n.err = err
+		}
+	}
 	return n.err
 }
 
@@ -116,12 +162,16 @@ func (st *statement) Exec(ctx context.Context, params ...rdb.Param) rdb.Next {
 	if err := ctx.Err(); err != nil {
 		return &next{err: err}
 	}
-	rows, err := st.stmt.Query(makeArgs(st.truncateLongText, params))
+	release, err := st.pool.acquire(ctx)
+	if err != nil {
+		return &next{err: err}
+	}
+	rows, err := st.stmt.Query(makeArgs(st.truncateLongText, params)...)
 	if cerr := ctx.Err(); cerr != nil {
 		rows.Close()
 		err = cerr
 	}
-	n := &next{err: err, rows: rows, ctx: ctx, textAsBytes: st.textAsBytes}
+	n := &next{err: err, rows: rows, ctx: ctx, textAsBytes: st.textAsBytes, release: release}
 	n.init()
 	return n
 }
@@ -130,7 +180,17 @@ func (tx *transaction) Query(ctx context.Context, cmd *rdb.Command, params ...rd
 	if err := ctx.Err(); err != nil {
 		return &next{err: err}
 	}
-	rows, err := tx.tx.Query(cmd.SQL, makeArgs(cmd.TruncLongText, params)...)
+	var rows *sql.Rows
+	s, done, err := tx.pool.stmt(cmd)
+	if err == nil {
+		args := makeArgs(cmd.TruncLongText, params)
+		if s != nil {
+			rows, err = tx.tx.Stmt(s).Query(args...)
+			done()
+		} else {
+			rows, err = tx.tx.Query(cmd.SQL, args...)
+		}
+	}
 	if cerr := ctx.Err(); cerr != nil {
 		rows.Close()
 		err = cerr
@@ -140,6 +200,7 @@ func (tx *transaction) Query(ctx context.Context, cmd *rdb.Command, params ...rd
 	return n
 }
 func (tx *transaction) RollbackTo(ctx context.Context, name string) error {
+	defer tx.release()
 	return tx.tx.Rollback()
 }
 
@@ -148,9 +209,21 @@ func (tx *transaction) SavePoint(ctx context.Context, name string) error {
 	return errNotSupported
 }
 func (tx *transaction) Commit(ctx context.Context) error {
+	defer tx.release()
 	return tx.tx.Commit()
 }
 
+// Isolation returns the level requested in Begin. It is not set on the
+// database/sql transaction.
+func (tx *transaction) Isolation() rdb.Isolation {
+	return tx.iso
+}
+
+// Prepare is not supported by database/sql.
+func (tx *transaction) Prepare(ctx context.Context) error {
+	return rdb.ErrNotSupported
+}
+
 func makeArgs(tuncLongText bool, params []rdb.Param) []interface{} {
 	out := make([]interface{}, len(params))
 	for i := range params {
@@ -159,21 +232,79 @@ func makeArgs(tuncLongText bool, params []rdb.Param) []interface{} {
 	return out
 }
 
+// acquire waits up to the PoolWaitTimeout for a connection of the pool to
+// be free and returns the func that frees it. It returns rdb.ErrPoolTimeout
+// if none is freed in time.
+func (p *Pool) acquire(ctx context.Context) (func(), error) {
+	if p.slots == nil {
+		return func() {}, nil
+	}
+	release := func() {
+		<-p.slots
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return onceFunc(release), nil
+	default:
+	}
+	t := time.NewTimer(p.wait)
+	defer t.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return onceFunc(release), nil
+	case <-t.C:
+		return nil, rdb.ErrPoolTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func onceFunc(fn func()) func() {
+	var once sync.Once
+	return func() {
+		once.Do(fn)
+	}
+}
+
 // Query sends a database query.
 func (p *Pool) Query(ctx context.Context, cmd *rdb.Command, params ...rdb.Param) rdb.Next {
 	if err := ctx.Err(); err != nil {
 		return &next{err: err}
 	}
-	rows, err := p.DB.Query(cmd.SQL, makeArgs(cmd.TruncLongText, params)...)
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return &next{err: err}
+	}
+	var rows *sql.Rows
+	s, done, err := p.stmt(cmd)
+	if err == nil {
+		args := makeArgs(cmd.TruncLongText, params)
+		if s != nil {
+			rows, err = s.Query(args...)
+			done()
+		} else {
+			rows, err = p.DB.Query(cmd.SQL, args...)
+		}
+	}
 	if cerr := ctx.Err(); cerr != nil {
 		rows.Close()
 		err = cerr
 	}
-	n := &next{err: err, rows: rows, ctx: ctx, textAsBytes: cmd.TextAsBytes}
+	n := &next{err: err, rows: rows, ctx: ctx, textAsBytes: cmd.TextAsBytes, release: release}
 	n.init()
 	return n
 }
 
+// stmt returns the statement prepared for the SQL of a command with Prepare
+// set to rdb.FlagTrue, preparing it on first use, and the func to call once
+// the query is sent. It returns nil for other commands.
+func (p *Pool) stmt(cmd *rdb.Command) (*sql.Stmt, func(), error) {
+	if cmd.Prepare != rdb.FlagTrue {
+		return nil, nil, nil
+	}
+	return p.stmts.get(p.DB, cmd.SQL)
+}
+
 func (p *Pool) Prepare(ctx context.Context, cmd *rdb.Command) (rdb.Statement, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -186,9 +317,15 @@ func (p *Pool) Prepare(ctx context.Context, cmd *rdb.Command) (rdb.Statement, er
 		s.Close()
 		return nil, err
 	}
+	rdb.GoSafe(nil, nil, func() error {
+		// Un-prepare the statement on each connection when done.
+		<-ctx.Done()
+		return s.Close()
+	})
 	st := &statement{
 		ctx:  ctx,
 		stmt: s,
+		pool: p,
 
 		truncateLongText: cmd.TruncLongText,
 		textAsBytes:      cmd.TextAsBytes,
@@ -201,22 +338,39 @@ func (p *Pool) Begin(ctx context.Context, iso rdb.Isolation) (rdb.Transaction, e
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
 	tx, err := p.DB.Begin()
 	if err != nil {
+		release()
 		return nil, err
 	}
 	if err := ctx.Err(); err != nil {
+		tx.Rollback()
+		release()
 		return nil, err
 	}
+	done := make(chan struct{})
 	t := &transaction{
-		ctx: ctx,
-		tx:  tx,
+		ctx:  ctx,
+		tx:   tx,
+		iso:  iso,
+		pool: p,
+		done: done,
+		release: onceFunc(func() {
+			close(done)
+			release()
+		}),
 	}
+	rdb.GoSafe(nil, nil, t.watch)
 	return t, nil
 }
 
 // Close the connection pool.
 func (p *Pool) Close() {
+	p.stmts.close()
 	p.DB.Close()
 }
 
@@ -235,6 +389,11 @@ func (p *Pool) Status() rdb.PoolStatus {
 	return p
 }
 
+// Connections returns nil, database/sql does not report connections.
+func (p *Pool) Connections() []rdb.ConnInfo {
+	return nil
+}
+
 // Capacity returns the same as Available for database/sql drivers.
 func (p *Pool) Capacity() int {
 	// No way to get true capacity.
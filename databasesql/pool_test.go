@@ -0,0 +1,571 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package databasesql_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	_ "github.com/kardianos/rdb/databasesql"
+	"golang.org/x/net/context"
+)
+
+// countDriver is a database/sql driver that returns empty results and
+// counts by data source name the connections it opens and closes and the
+// statements it prepares.
+type countDriver struct {
+	mu    sync.Mutex
+	stats map[string]*countStats
+}
+
+type countStats struct {
+	opened, closed int
+	pinged         int
+	failOpen       int // Number of opens to fail.
+	prepared       map[string]int
+	unprepared     map[string]int
+}
+
+var counter = &countDriver{stats: make(map[string]*countStats)}
+
+func init() {
+	sql.Register("rdbcount", counter)
+}
+
+func (d *countDriver) conns(name string) (opened, closed int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats[name].opened, d.stats[name].closed
+}
+
+// reset clears the counts of the data source name.
+func (d *countDriver) reset(name string) {
+	d.mu.Lock()
+	d.stats[name] = &countStats{prepared: make(map[string]int), unprepared: make(map[string]int)}
+	d.mu.Unlock()
+}
+
+func (d *countDriver) prepares(name, query string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats[name].prepared[query]
+}
+
+func (d *countDriver) unprepares(name, query string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats[name].unprepared[query]
+}
+
+func (d *countDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if st := d.stats[name]; st.failOpen > 0 {
+		st.failOpen--
+		return nil, errCount
+	}
+	d.stats[name].opened++
+	return &countConn{d: d, name: name}, nil
+}
+
+type countConn struct {
+	d    *countDriver
+	name string
+}
+
+func (c *countConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.mu.Lock()
+	c.d.stats[c.name].prepared[query]++
+	c.d.mu.Unlock()
+	return countStmt{c: c, query: query}, nil
+}
+
+// Query runs queries that are not prepared.
+func (c *countConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	if query == panicSQL {
+		return panicRows{}, nil
+	}
+	return countRows{}, nil
+}
+
+func (c *countConn) Ping(ctx context.Context) error {
+	c.d.mu.Lock()
+	c.d.stats[c.name].pinged++
+	c.d.mu.Unlock()
+	return nil
+}
+
+// point is a parameter type only countConn accepts.
+type point struct{ X, Y int }
+
+func (c *countConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if p, ok := nv.Value.(point); ok {
+		nv.Value = fmt.Sprintf("(%d,%d)", p.X, p.Y)
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+func (c *countConn) Close() error {
+	c.d.mu.Lock()
+	c.d.stats[c.name].closed++
+	c.d.mu.Unlock()
+	return nil
+}
+
+func (c *countConn) Begin() (driver.Tx, error) { return countTx{}, nil }
+
+// errCount is returned by a statement with the SQL failSQL.
+var errCount = errors.New("count: statement failed")
+
+const failSQL = "fail;"
+
+// panicSQL returns rows that panic when closed.
+const panicSQL = "panic;"
+
+type countStmt struct {
+	c     *countConn
+	query string
+}
+
+func (s countStmt) Close() error {
+	s.c.d.mu.Lock()
+	s.c.d.stats[s.c.name].unprepared[s.query]++
+	s.c.d.mu.Unlock()
+	return nil
+}
+
+func (countStmt) NumInput() int { return -1 }
+
+func (s countStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.query == failSQL {
+		return nil, errCount
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (s countStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.query == failSQL {
+		return nil, errCount
+	}
+	return countRows{}, nil
+}
+
+type countRows struct{}
+
+func (countRows) Columns() []string              { return []string{"V"} }
+func (countRows) Close() error                   { return nil }
+func (countRows) Next(dest []driver.Value) error { return io.EOF }
+
+type panicRows struct{ countRows }
+
+func (panicRows) Close() error { panic("count: close rows") }
+
+type countTx struct{}
+
+func (countTx) Commit() error   { return nil }
+func (countTx) Rollback() error { return nil }
+
+func TestDefaultCommandPrepare(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// One connection, so database/sql does not prepare again on another.
+	pool := openCount(t, ctx, &rdb.Config{DefaultCommand: rdb.CommandDefaults{Prepare: true}})
+	defer pool.Close()
+
+	const sqlText = "select V from Prepared;"
+	for i := 0; i < 3; i++ {
+		if err := pool.Query(ctx, &rdb.Command{SQL: sqlText}).Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := counter.prepares(t.Name(), sqlText); n != 1 {
+		t.Fatalf("got %d prepares, want 1", n)
+	}
+
+	const other = "select V from Unprepared;"
+	if err := pool.Query(ctx, &rdb.Command{SQL: other, Prepare: rdb.FlagFalse}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := counter.prepares(t.Name(), other); n != 0 {
+		t.Fatalf("got %d prepares for a command with Prepare false, want 0", n)
+	}
+}
+
+func TestPrepareEvict(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := openCount(t, ctx, &rdb.Config{DefaultCommand: rdb.CommandDefaults{Prepare: true}})
+	defer pool.Close()
+
+	// More statements then the pool keeps prepared.
+	const count = 100
+	sqlText := func(i int) string {
+		return fmt.Sprintf("select V from T where ID = %d;", i)
+	}
+	for i := 0; i < count; i++ {
+		if err := pool.Query(ctx, &rdb.Command{SQL: sqlText(i)}).Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := counter.unprepares(t.Name(), sqlText(0)); n != 1 {
+		t.Fatalf("got the least recently used statement closed %d times, want 1", n)
+	}
+	if n := counter.unprepares(t.Name(), sqlText(count-1)); n != 0 {
+		t.Fatalf("got the most recently used statement closed %d times, want 0", n)
+	}
+
+	// Queries prepared at the same time keep a single statement.
+	const same = "select V from Same;"
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Query(ctx, &rdb.Command{SQL: same}).Close()
+		}()
+	}
+	wg.Wait()
+	if prepared, closed := counter.prepares(t.Name(), same), counter.unprepares(t.Name(), same); prepared-closed != 1 {
+		t.Fatalf("got %d prepared and %d closed, want 1 statement kept", prepared, closed)
+	}
+}
+
+func TestStmtClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := openCount(t, ctx, &rdb.Config{})
+	defer pool.Close()
+
+	const sqlText = "select V from T where ID = ?;"
+	stmt, err := rdb.PrepareStmt(ctx, pool, &rdb.Command{SQL: sqlText})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := stmt.Query(ctx, rdb.Param{Value: 1})
+	if _, err := next.Result(); err != nil {
+		t.Fatal(err)
+	}
+	next.Close()
+
+	stmt.Close()
+	var n int
+	for i := 0; i < 100; i++ {
+		if n = counter.unprepares(t.Name(), sqlText); n != 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if want := counter.prepares(t.Name(), sqlText); want == 0 || n != want {
+		t.Fatalf("got %d statements closed, want %d", n, want)
+	}
+}
+
+// openCount opens a pool on countDriver named for the test. Unless set the
+// pool has one connection so queries run one after the other on it.
+func openCount(t *testing.T, ctx context.Context, conf *rdb.Config) rdb.Pool {
+	conf.DriverName = "rdbcount"
+	conf.Raw = t.Name()
+	counter.reset(conf.Raw)
+	if conf.PoolMaxCapacity == 0 {
+		conf.PoolMaxCapacity = 1
+	}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+// queryCount runs a query and waits for its connection to be returned.
+func queryCount(t *testing.T, ctx context.Context, pool rdb.Pool) {
+	next := pool.Query(ctx, &rdb.Command{SQL: "select V from T;"})
+	if _, err := next.Result(); err != nil {
+		t.Fatal(err)
+	}
+	if err := next.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxQueriesPerConn(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := openCount(t, ctx, &rdb.Config{PoolMaxQueriesPerConn: 2})
+	defer pool.Close()
+
+	for i := 0; i < 5; i++ {
+		queryCount(t, ctx, pool)
+	}
+	if opened, closed := counter.conns(t.Name()); opened != 3 || closed != 2 {
+		t.Fatalf("got %d connections opened and %d closed, want 3 and 2", opened, closed)
+	}
+}
+
+func TestMaxQueriesPerConnTx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := openCount(t, ctx, &rdb.Config{PoolMaxQueriesPerConn: 2})
+	defer pool.Close()
+
+	// Queries are counted, not the times the connection is taken.
+	tx, err := pool.Begin(ctx, rdb.IsoDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := tx.Query(ctx, &rdb.Command{SQL: "select V from T;"}).Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	queryCount(t, ctx, pool)
+	if opened, closed := counter.conns(t.Name()); opened != 2 || closed != 1 {
+		t.Fatalf("got %d connections opened and %d closed, want 2 and 1", opened, closed)
+	}
+}
+
+func TestConnectorForward(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := openCount(t, ctx, &rdb.Config{PoolMaxQueriesPerConn: 10})
+	defer pool.Close()
+
+	// The value checker of the driver connection accepts the type.
+	next := pool.Query(ctx, &rdb.Command{SQL: "select V from T where P = ?;"}, rdb.Param{Value: point{1, 2}})
+	if _, err := next.Result(); err != nil {
+		t.Fatal(err)
+	}
+	next.Close()
+
+	if err := pool.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	counter.mu.Lock()
+	pinged := counter.stats[t.Name()].pinged
+	counter.mu.Unlock()
+	if pinged == 0 {
+		t.Fatal("ping not sent to the driver connection")
+	}
+}
+
+// waitClosed waits for the connections of the test to be closed, as
+// database/sql returns them to the pool after the query is closed.
+func waitClosed(t *testing.T, want int) int {
+	var closed int
+	for i := 0; i < 100; i++ {
+		if _, closed = counter.conns(t.Name()); closed >= want {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return closed
+}
+
+func TestMaxIdle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := openCount(t, ctx, &rdb.Config{PoolMaxCapacity: 3, PoolMaxIdle: 1})
+	defer pool.Close()
+
+	var list []rdb.Next
+	for i := 0; i < 3; i++ {
+		next := pool.Query(ctx, &rdb.Command{SQL: "select V from T;"})
+		if _, err := next.Result(); err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, next)
+	}
+	for _, next := range list {
+		next.Close()
+	}
+	if closed := waitClosed(t, 2); closed != 2 {
+		t.Fatalf("got %d connections closed, want 2 beyond the idle limit", closed)
+	}
+	if opened, _ := counter.conns(t.Name()); opened != 3 {
+		t.Fatalf("got %d connections opened, want 3", opened)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := openCount(t, ctx, &rdb.Config{PoolWaitTimeout: 20 * time.Millisecond})
+	defer pool.Close()
+
+	held := pool.Query(ctx, &rdb.Command{SQL: "select V from T;"})
+	if _, err := held.Result(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err := pool.Query(ctx, &rdb.Command{SQL: "select V from T;"}).Result()
+	if err != rdb.ErrPoolTimeout {
+		t.Fatalf("got %v, want ErrPoolTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("waited %v for a connection", elapsed)
+	}
+
+	held.Close()
+	queryCount(t, ctx, pool)
+}
+
+func TestWaitTimeoutCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := openCount(t, ctx, &rdb.Config{PoolWaitTimeout: 20 * time.Millisecond})
+	defer pool.Close()
+
+	txCtx, txCancel := context.WithCancel(ctx)
+	if _, err := pool.Begin(txCtx, rdb.IsoDefault); err != nil {
+		t.Fatal(err)
+	}
+	// Canceling the context rolls back the transaction and frees its slot.
+	txCancel()
+	queryCount(t, ctx, pool)
+}
+
+func TestInitSQL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const init = "set lock_timeout 1000;"
+	pool := openCount(t, ctx, &rdb.Config{InitSQL: []string{init}})
+	defer pool.Close()
+	for i := 0; i < 3; i++ {
+		queryCount(t, ctx, pool)
+	}
+	if n := counter.prepares(t.Name(), init); n != 1 {
+		t.Fatalf("got init SQL run %d times, want once on the one connection", n)
+	}
+
+	// A failed statement fails the connection.
+	t.Run("fail", func(t *testing.T) {
+		pool := openCount(t, ctx, &rdb.Config{InitSQL: []string{init, failSQL}})
+		defer pool.Close()
+		if _, err := pool.Query(ctx, &rdb.Command{SQL: "select V from T;"}).Result(); err != errCount {
+			t.Fatalf("got %v, want %v", err, errCount)
+		}
+		if opened, closed := counter.conns(t.Name()); opened == 0 || opened != closed {
+			t.Fatalf("got %d connections opened and %d closed, want failed connections closed", opened, closed)
+		}
+	})
+}
+
+func TestSchema(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := openCount(t, ctx, &rdb.Config{Schema: "app, public"})
+	defer pool.Close()
+	for i := 0; i < 3; i++ {
+		queryCount(t, ctx, pool)
+	}
+	if n := counter.prepares(t.Name(), "SET search_path TO app, public;"); n != 1 {
+		t.Fatalf("got schema set %d times, want once on the one connection", n)
+	}
+}
+
+func TestValidationQuery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const valid = "select 1;"
+	pool := openCount(t, ctx, &rdb.Config{ValidationQuery: valid})
+	defer pool.Close()
+	for i := 0; i < 3; i++ {
+		queryCount(t, ctx, pool)
+	}
+	if n := counter.prepares(t.Name(), valid); n != 2 {
+		t.Fatalf("got validation run %d times, want 2 before each reuse", n)
+	}
+	if opened, _ := counter.conns(t.Name()); opened != 1 {
+		t.Fatalf("got %d connections opened, want 1", opened)
+	}
+
+	// A connection that fails validation is closed and replaced.
+	t.Run("fail", func(t *testing.T) {
+		pool := openCount(t, ctx, &rdb.Config{ValidationQuery: failSQL})
+		defer pool.Close()
+		for i := 0; i < 3; i++ {
+			queryCount(t, ctx, pool)
+		}
+		if opened, closed := counter.conns(t.Name()); opened != 3 || closed != 2 {
+			t.Fatalf("got %d connections opened and %d closed, want 3 and 2", opened, closed)
+		}
+	})
+}
+
+func TestMaxLifetime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const lifetime = 5 * time.Millisecond
+	pool := openCount(t, ctx, &rdb.Config{PoolMaxLifetime: lifetime})
+	defer pool.Close()
+
+	queryCount(t, ctx, pool)
+	time.Sleep(4 * lifetime)
+	queryCount(t, ctx, pool)
+	if opened, closed := counter.conns(t.Name()); opened != 2 || closed != 1 {
+		t.Fatalf("got %d connections opened and %d closed, want the old connection replaced", opened, closed)
+	}
+}
+
+func TestRowsClosePanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := openCount(t, ctx, &rdb.Config{})
+	defer pool.Close()
+
+	next := pool.Query(ctx, &rdb.Command{SQL: panicSQL})
+	if _, err := next.Result(); err != nil {
+		t.Fatal(err)
+	}
+	if err, ok := next.Close().(*rdb.PanicError); !ok || err.Value != "count: close rows" {
+		t.Fatalf("got %v, want *rdb.PanicError", err)
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const backoff = 30 * time.Millisecond
+	pool := openCount(t, ctx, &rdb.Config{ReconnectBackoff: rdb.Backoff{Initial: backoff, Max: backoff}})
+	defer pool.Close()
+
+	counter.mu.Lock()
+	counter.stats[t.Name()].failOpen = 1
+	counter.mu.Unlock()
+	if _, err := pool.Query(ctx, &rdb.Command{SQL: "select V from T;"}).Result(); err != errCount {
+		t.Fatalf("got %v, want %v", err, errCount)
+	}
+	start := time.Now()
+	queryCount(t, ctx, pool)
+	// The wait is shortened by up to a tenth.
+	if elapsed := time.Since(start); elapsed < backoff*9/10 {
+		t.Fatalf("connected after %v, want the backoff of %v", elapsed, backoff)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package databasesql
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+)
+
+// stmtCacheSize is the number of statements a pool keeps prepared for
+// commands with Prepare set.
+const stmtCacheSize = 64
+
+// stmtCache keeps the most recently used statements prepared by SQL text.
+// A statement is closed once it is evicted and no query is using it.
+type stmtCache struct {
+	mu    sync.Mutex
+	lru   list.List // Of *cachedStmt, most recently used first.
+	items map[string]*list.Element
+}
+
+type cachedStmt struct {
+	sql     string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+// get returns the statement for the SQL, preparing it outside of the lock
+// if it is not cached. The returned func must be called once the statement
+// is no longer used.
+func (c *stmtCache) get(db *sql.DB, sqlText string) (*sql.Stmt, func(), error) {
+	if cs := c.use(sqlText); cs != nil {
+		return cs.stmt, c.releaseFunc(cs), nil
+	}
+	s, err := db.Prepare(sqlText)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.mu.Lock()
+	if el, found := c.items[sqlText]; found {
+		// Prepared by another query at the same time.
+		cs := el.Value.(*cachedStmt)
+		cs.refs++
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		s.Close()
+		return cs.stmt, c.releaseFunc(cs), nil
+	}
+	if c.items == nil {
+		c.items = make(map[string]*list.Element)
+	}
+	cs := &cachedStmt{sql: sqlText, stmt: s, refs: 1}
+	c.items[sqlText] = c.lru.PushFront(cs)
+	var closed []*sql.Stmt
+	for c.lru.Len() > stmtCacheSize {
+		if s := c.evict(c.lru.Back()); s != nil {
+			closed = append(closed, s)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, s := range closed {
+		s.Close()
+	}
+	return s, c.releaseFunc(cs), nil
+}
+
+// use returns the cached statement for the SQL and marks it in use.
+func (c *stmtCache) use(sqlText string) *cachedStmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, found := c.items[sqlText]
+	if !found {
+		return nil
+	}
+	cs := el.Value.(*cachedStmt)
+	cs.refs++
+	c.lru.MoveToFront(el)
+	return cs
+}
+
+func (c *stmtCache) releaseFunc(cs *cachedStmt) func() {
+	return onceFunc(func() {
+		c.mu.Lock()
+		cs.refs--
+		done := cs.evicted && cs.refs == 0
+		c.mu.Unlock()
+		if done {
+			cs.stmt.Close()
+		}
+	})
+}
+
+// evict removes the element and returns its statement if it is not in use
+// and should be closed.
+func (c *stmtCache) evict(el *list.Element) *sql.Stmt {
+	cs := c.lru.Remove(el).(*cachedStmt)
+	delete(c.items, cs.sql)
+	cs.evicted = true
+	if cs.refs != 0 {
+		return nil
+	}
+	return cs.stmt
+}
+
+// close evicts all statements.
+func (c *stmtCache) close() {
+	var closed []*sql.Stmt
+	c.mu.Lock()
+	for c.lru.Len() > 0 {
+		if s := c.evict(c.lru.Back()); s != nil {
+			closed = append(closed, s)
+		}
+	}
+	c.mu.Unlock()
+	for _, s := range closed {
+		s.Close()
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Flag is a Command option that may be left to the pool default.
+type Flag byte
+
+// Flag values.
+const (
+	FlagDefault Flag = iota // Use the default of the pool, see Config.DefaultCommand.
+	FlagTrue
+	FlagFalse
+)
+
+// Bool returns true if the flag is FlagTrue, or def if it is FlagDefault.
+func (f Flag) Bool(def bool) bool {
+	switch f {
+	case FlagTrue:
+		return true
+	case FlagFalse:
+		return false
+	}
+	return def
+}
+
+// CommandDefaults are applied to each command run through a pool returned
+// from Open that leaves the matching field at its zero value.
+type CommandDefaults struct {
+	// Prepare is used for commands with Prepare set to FlagDefault.
+	Prepare bool
+
+	// Timeout is used for commands without a Timeout.
+	Timeout time.Duration
+}
+
+// withDefaults returns the command with the pool defaults applied. The
+// command is copied if it is changed.
+func (p *pool) withDefaults(cmd *Command) *Command {
+	def := p.conf.DefaultCommand
+	prepare := cmd.Prepare == FlagDefault && def.Prepare
+	timeout := cmd.Timeout == 0 && def.Timeout > 0
+	if !prepare && !timeout {
+		return cmd
+	}
+	c := *cmd
+	if prepare {
+		c.Prepare = FlagTrue
+	}
+	if timeout {
+		c.Timeout = def.Timeout
+	}
+	return &c
+}
+
+// timeoutNext ends the context of a command with a Timeout when the query
+// is closed.
+type timeoutNext struct {
+	Next
+
+	cancel func()
+}
+
+func (n *timeoutNext) driverNext() Next {
+	return n.Next
+}
+
+func (n *timeoutNext) Close() error {
+	err := n.Next.Close()
+	n.cancel()
+	return err
+}
+
+// withTimeout returns the context of the command and the function to end
+// it, nil if the command has no Timeout.
+func withTimeout(ctx context.Context, cmd *Command) (context.Context, func()) {
+	if cmd.Timeout <= 0 {
+		return ctx, nil
+	}
+	return context.WithTimeout(ctx, cmd.Timeout)
+}
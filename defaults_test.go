@@ -0,0 +1,99 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestDefaultCommand(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select 1;")
+	conf := fake.Config()
+	conf.DefaultCommand = rdb.CommandDefaults{Prepare: true}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	inherit := &rdb.Command{SQL: "select 1;"}
+	override := &rdb.Command{SQL: "select 1;", Prepare: rdb.FlagFalse}
+	var hits []bool
+	for _, cmd := range []*rdb.Command{inherit, inherit, override} {
+		next := pool.Query(ctx, cmd)
+		if err := next.Close(); err != nil {
+			t.Fatal(err)
+		}
+		hits = append(hits, rdb.PreparedCacheHit(next))
+	}
+	calls := fake.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("got %d calls, want 3", len(calls))
+	}
+	if got := calls[0].Command; got.Prepare != rdb.FlagTrue {
+		t.Errorf("unset: got prepare %d", got.Prepare)
+	}
+	if got := calls[2].Command; got.Prepare != rdb.FlagFalse {
+		t.Errorf("set to false: got prepare %d", got.Prepare)
+	}
+	if inherit.Prepare != rdb.FlagDefault {
+		t.Errorf("command changed by defaults %+v", inherit)
+	}
+
+	// The driver prepares the SQL once and reuses it.
+	if hits[0] || !hits[1] || hits[2] {
+		t.Errorf("got prepared cache hits %v, want [false true false]", hits)
+	}
+	if n := fake.Prepared("select 1;"); n != 1 {
+		t.Errorf("got SQL prepared on %d connections, want 1", n)
+	}
+}
+
+func TestDefaultCommandTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("waitfor delay '01:00';").Block()
+	conf := fake.Config()
+	conf.DefaultCommand.Timeout = 20 * time.Millisecond
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	start := time.Now()
+	next := pool.Query(ctx, &rdb.Command{SQL: "waitfor delay '01:00';"})
+	_, err = next.Buffer()
+	next.Close()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("query took %v to time out", elapsed)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("context of the caller ended")
+	}
+
+	// A command Timeout is used rather then the default.
+	start = time.Now()
+	next = pool.Query(ctx, &rdb.Command{SQL: "waitfor delay '01:00';", Timeout: 80 * time.Millisecond})
+	_, err = next.Buffer()
+	next.Close()
+	if err != context.DeadlineExceeded || time.Since(start) < 80*time.Millisecond {
+		t.Fatalf("got %v after %v", err, time.Since(start))
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+// Discarder may be implemented by a driver Next to skip the remaining
+// results of a query without reading their rows. It returns the first error
+// of the query.
+type Discarder interface {
+	Discard() error
+}
+
+// discard reads and closes the results of next and returns an empty Next
+// that reports the first error. The rows are skipped by the driver if it
+// implements Discarder, otherwise they are scanned and dropped.
+func discard(next Next) Next {
+	var err error
+	if d, ok := driverNextOf(next).(Discarder); ok {
+		err = d.Discard()
+	} else {
+		err = drain(next)
+	}
+	if cerr := next.Close(); err == nil {
+		err = cerr
+	}
+	return &nextError{err: err}
+}
+
+func drain(next Next) error {
+	for {
+		res, err := next.Result()
+		if err != nil || res == nil {
+			return err
+		}
+		for {
+			row, err := res.Scan()
+			if err != nil {
+				return err
+			}
+			if row == nil {
+				break
+			}
+		}
+	}
+}
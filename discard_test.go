@@ -0,0 +1,63 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestDiscard(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const rows = 1000
+	big := rdbtest.NewResult("ID", "Name")
+	for i := 0; i < rows; i++ {
+		big.Row(int64(i), "name")
+	}
+	errFail := errors.New("audit failed")
+	fake := rdbtest.New()
+	fake.Expect("exec WarmCache;").Returns(big, rdbtest.NewResult("Count").Row(int64(rows)))
+	fake.Expect("exec Audit;").Returns(big).ErrorAfter(errFail)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	warm := &rdb.Command{SQL: "exec WarmCache;", Discard: true}
+	next := pool.Query(ctx, warm)
+	// The results are already read, the connection is back in the pool.
+	for _, c := range fake.Status().Connections() {
+		if !c.Idle {
+			t.Fatalf("connection not returned before close %+v", c)
+		}
+	}
+	if res, err := next.Result(); res != nil || err != nil {
+		t.Fatalf("got result %v, error %v", res, err)
+	}
+	if err := next.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The error after the last result is reported.
+	if err := pool.Query(ctx, &rdb.Command{SQL: "exec Audit;", Discard: true}).Close(); err != errFail {
+		t.Fatalf("got %v, want %v", err, errFail)
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		if err := pool.Query(ctx, warm).Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs >= rows {
+		t.Fatalf("got %.0f allocations, rows were built", allocs)
+	}
+}
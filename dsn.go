@@ -0,0 +1,216 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseConfigDSN parses configuration options from a semicolon separated
+// list of key=value pairs as used by ODBC and ADO.NET.
+//
+//	Server=tcp:db1,1433;Database=app;User Id=u;Password="p;w";Max Pool Size=20
+//
+// Keys are not case sensitive and, like values, are trimmed of spaces. A
+// value may be quoted with double quotes, single quotes or braces to
+// contain semicolons; a quote is escaped by doubling it.
+// Known keys:
+//
+//	driver:                                Driver name
+//	server, data source, address, host:    Hostname[\Instance][,Port] or Hostname:Port
+//	port:                                  Port
+//	database, initial catalog, db:         Database
+//	user id, uid, user, username:          Username
+//	password, pwd:                         Password
+//	instance:                              Instance
+//	schema, search path:                   Schema
+//	encrypt:                               Secure
+//	trust server certificate:              InsecureSkipVerify
+//	min pool size:                         PoolInitCapacity
+//	max pool size:                         PoolMaxCapacity
+//	connection lifetime:                   PoolMaxLifetime in seconds
+//	charset, collation:                    Charset, Collation
+//	packet size:                           MaxPacketSize
+//
+// Other keys are placed in KV, parsed if registered with RegisterOption.
+func ParseConfigDSN(dsn string) (*Config, error) {
+	conf := &Config{Raw: dsn}
+	pairs, err := splitDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		key, value := pair[0], pair[1]
+		var err error
+		switch strings.Replace(strings.ToLower(key), " ", "", -1) {
+		case "driver":
+			conf.DriverName = value
+		case "server", "datasource", "address", "addr", "host", "hostname":
+			err = conf.setServer(value)
+		case "port":
+			conf.Port, err = parsePort(value)
+		case "database", "initialcatalog", "db":
+			conf.Database = value
+		case "userid", "uid", "user", "username":
+			conf.Username = value
+		case "password", "pwd":
+			conf.Password = value
+		case "instance":
+			conf.Instance = value
+		case "schema", "searchpath", "search_path":
+			conf.Schema = value
+		case "encrypt":
+			conf.Secure, err = parseDSNBool(value)
+		case "trustservercertificate":
+			conf.InsecureSkipVerify, err = parseDSNBool(value)
+		case "minpoolsize":
+			conf.PoolInitCapacity, err = strconv.Atoi(value)
+		case "maxpoolsize":
+			conf.PoolMaxCapacity, err = strconv.Atoi(value)
+		case "connectionlifetime":
+			var sec int
+			sec, err = strconv.Atoi(value)
+			conf.PoolMaxLifetime = time.Duration(sec) * time.Second
+		case "charset":
+			conf.Charset = value
+		case "collation":
+			conf.Collation = value
+		case "packetsize":
+			conf.MaxPacketSize, err = strconv.Atoi(value)
+		default:
+			if conf.KV == nil {
+				conf.KV = make(map[string]interface{})
+			}
+			conf.KV[key] = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rdb: invalid DSN value for %q: %v", key, err)
+		}
+	}
+	if err := conf.parseOptions(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// setServer sets the host, instance and port from a server value such as
+// "tcp:host\instance,1433" or "host:5432".
+func (c *Config) setServer(value string) error {
+	value = strings.TrimPrefix(value, "tcp:")
+	host, port := value, ""
+	if i := strings.LastIndex(value, ","); i >= 0 {
+		host, port = value[:i], value[i+1:]
+	} else if i := strings.LastIndex(value, ":"); i >= 0 && strings.Count(value, ":") == 1 {
+		host, port = value[:i], value[i+1:]
+	}
+	if i := strings.Index(host, `\`); i >= 0 {
+		host, c.Instance = host[:i], host[i+1:]
+	}
+	c.Hostname = strings.TrimSpace(host)
+	if port = strings.TrimSpace(port); len(port) != 0 {
+		var err error
+		c.Port, err = parsePort(port)
+		return err
+	}
+	return nil
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.ParseUint(value, 10, 16)
+	return int(port), err
+}
+
+func parseDSNBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// splitDSN returns the key and value of each pair in the DSN.
+func splitDSN(dsn string) ([][2]string, error) {
+	var pairs [][2]string
+	for len(dsn) != 0 {
+		eq := strings.IndexByte(dsn, '=')
+		semi := strings.IndexByte(dsn, ';')
+		if eq < 0 || (semi >= 0 && semi < eq) {
+			// A segment without a value is only allowed if empty.
+			seg := dsn
+			if semi >= 0 {
+				seg, dsn = dsn[:semi], dsn[semi+1:]
+			} else {
+				dsn = ""
+			}
+			if len(strings.TrimSpace(seg)) != 0 {
+				return nil, fmt.Errorf("rdb: DSN segment %q is not key=value", strings.TrimSpace(seg))
+			}
+			continue
+		}
+		key := strings.TrimSpace(dsn[:eq])
+		if len(key) == 0 {
+			return nil, fmt.Errorf("rdb: DSN has a value without a key")
+		}
+		rest := strings.TrimLeft(dsn[eq+1:], " \t")
+		var value string
+		var err error
+		value, dsn, err = dsnValue(rest)
+		if err != nil {
+			return nil, fmt.Errorf("rdb: DSN value for %q: %v", key, err)
+		}
+		pairs = append(pairs, [2]string{key, value})
+	}
+	return pairs, nil
+}
+
+// dsnValue reads a value up to the next semicolon and returns the rest of
+// the DSN after it.
+func dsnValue(s string) (value, rest string, err error) {
+	if len(s) != 0 {
+		var end byte
+		switch s[0] {
+		case '"', '\'':
+			end = s[0]
+		case '{':
+			end = '}'
+		}
+		if end != 0 {
+			buf := make([]byte, 0, len(s))
+			i := 1
+			for {
+				if i >= len(s) {
+					return "", "", fmt.Errorf("unterminated quote")
+				}
+				if s[i] == end {
+					if i+1 < len(s) && s[i+1] == end {
+						buf = append(buf, end)
+						i += 2
+						continue
+					}
+					break
+				}
+				buf = append(buf, s[i])
+				i++
+			}
+			rest = strings.TrimLeft(s[i+1:], " \t")
+			if len(rest) != 0 && rest[0] != ';' {
+				return "", "", fmt.Errorf("unexpected text after quoted value")
+			}
+			if len(rest) != 0 {
+				rest = rest[1:]
+			}
+			return string(buf), rest, nil
+		}
+	}
+	if i := strings.IndexByte(s, ';'); i >= 0 {
+		return strings.TrimSpace(s[:i]), s[i+1:], nil
+	}
+	return strings.TrimSpace(s), "", nil
+}
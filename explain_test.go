@@ -0,0 +1,54 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestExplain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderDollar
+	fake.Expect("EXPLAIN select * from T where ID = $1;").Returns(
+		rdbtest.NewResult("QUERY PLAN").
+			Row("Index Scan using t_pkey on t").
+			Row("  Index Cond: (id = 1)"),
+	)
+	fake.Expect("EXPLAIN ANALYZE select * from T where ID = $1;").Returns(
+		rdbtest.NewResult("QUERY PLAN", "cost").
+			Row("Index Scan using t_pkey on t", 8.27),
+	)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := &rdb.Command{SQL: "select * from T where ID = ?;"}
+
+	plan, err := rdb.Explain(ctx, pool, cmd, false, rdb.Param{Value: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Index Scan using t_pkey on t\n  Index Cond: (id = 1)"; plan != want {
+		t.Errorf("got plan %q, want %q", plan, want)
+	}
+
+	plan, err = rdb.Explain(ctx, pool, cmd, true, rdb.Param{Value: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Index Scan using t_pkey on t\t8.27"; plan != want {
+		t.Errorf("got plan %q, want %q", plan, want)
+	}
+	if cmd.SQL != "select * from T where ID = ?;" {
+		t.Errorf("command was modified: %q", cmd.SQL)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// HealthReporter may be implemented by a driver Pool to report if it can
+// establish connections, such as when every recent attempt to dial has
+// failed. It must not block on the network.
+type HealthReporter interface {
+	Healthy() (bool, error)
+}
+
+// Healthy returns false and the reason if the pool is closed, the driver
+// reports it cannot establish connections, or the last pings failed, see
+// Config.HealthFailures. Pings are run in the background if
+// Config.HealthCheckInterval is set, Healthy itself does not ping.
+func Healthy(p Pool) (bool, error) {
+	var driver interface{} = p
+	if cp, ok := p.(*pool); ok {
+		if cp.isClosed() {
+			return false, ErrPoolClosed
+		}
+		if err := cp.health.failing(cp.conf.HealthFailures); err != nil {
+			return false, err
+		}
+		driver = cp.Pool
+	}
+	if h, ok := driver.(HealthReporter); ok {
+		return h.Healthy()
+	}
+	return true, nil
+}
+
+// defaultHealthFailures is used if Config.HealthFailures is zero.
+const defaultHealthFailures = 3
+
+// health counts the pings that failed in a row.
+type health struct {
+	mu     sync.Mutex
+	failed int
+	err    error
+	stop   chan struct{} // Closed when the pool is closed, nil if no checker.
+}
+
+func (h *health) ping(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err == nil {
+		h.failed = 0
+		h.err = nil
+		return
+	}
+	h.failed++
+	h.err = err
+}
+
+// done records a ping that ended with its context. A ping that timed out,
+// as the pings of the health checker do if the server does not respond,
+// failed. A canceled ping is not counted.
+func (h *health) done(err error) {
+	if err == context.DeadlineExceeded {
+		h.ping(err)
+	}
+}
+
+// failing returns the last ping error if at least max pings failed in a
+// row.
+func (h *health) failing(max int) error {
+	if max <= 0 {
+		max = defaultHealthFailures
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.failed < max {
+		return nil
+	}
+	return h.err
+}
+
+// checkHealth pings the pool each interval until it is closed. After a
+// failed ping the next waits for Config.ReconnectBackoff if that is longer.
+func (p *pool) checkHealth(interval time.Duration) {
+	backoff := NewBackoffState(p.conf.ReconnectBackoff)
+	t := time.NewTimer(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.health.stop:
+			return
+		case <-t.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := p.Ping(ctx)
+		cancel()
+		wait := interval
+		if err == nil {
+			backoff.Succeed()
+		} else if d := backoff.Fail(); d > wait {
+			wait = d
+		}
+		t.Reset(wait)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+// waitHealthy polls Healthy until it reports want or a second passes.
+func waitHealthy(t *testing.T, pool rdb.Pool, want bool) error {
+	var err error
+	for i := 0; i < 200; i++ {
+		var ok bool
+		ok, err = rdb.Healthy(pool)
+		if ok == want {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("pool healthy is not %t, last error %v", want, err)
+	return nil
+}
+
+func TestHealthyPing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errDown := errors.New("server down")
+	var down int32
+	fake := rdbtest.New()
+	fake.PingFunc = func(ctx context.Context) error {
+		if atomic.LoadInt32(&down) != 0 {
+			return errDown
+		}
+		return nil
+	}
+	conf := fake.Config()
+	conf.HealthCheckInterval = 5 * time.Millisecond
+	conf.HealthFailures = 2
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := rdb.Healthy(pool); !ok || err != nil {
+		t.Fatalf("got %t, %v before any ping", ok, err)
+	}
+	atomic.StoreInt32(&down, 1)
+	if err := waitHealthy(t, pool, false); err != errDown {
+		t.Fatalf("got reason %v, want %v", err, errDown)
+	}
+	atomic.StoreInt32(&down, 0)
+	if err := waitHealthy(t, pool, true); err != nil {
+		t.Fatalf("got reason %v after recovery", err)
+	}
+
+	pool.Close()
+	if ok, err := rdb.Healthy(pool); ok || err != rdb.ErrPoolClosed {
+		t.Fatalf("got %t, %v after close", ok, err)
+	}
+}
+
+func TestHealthyPingTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.PingFunc = func(ctx context.Context) error {
+		// The server does not respond.
+		<-ctx.Done()
+		time.Sleep(time.Millisecond)
+		return errors.New("ping abandoned")
+	}
+	conf := fake.Config()
+	conf.HealthCheckInterval = 5 * time.Millisecond
+	conf.HealthFailures = 2
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	if err := waitHealthy(t, pool, false); err != context.DeadlineExceeded {
+		t.Fatalf("got reason %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestHealthyPingBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var pings int32
+	fake := rdbtest.New()
+	fake.PingFunc = func(ctx context.Context) error {
+		atomic.AddInt32(&pings, 1)
+		return errors.New("server down")
+	}
+	conf := fake.Config()
+	conf.HealthCheckInterval = time.Millisecond
+	conf.ReconnectBackoff = rdb.Backoff{Initial: 40 * time.Millisecond, Max: 40 * time.Millisecond}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	pool.Close()
+	// Pings after the first failure wait for the backoff, not the interval.
+	if n := atomic.LoadInt32(&pings); n < 2 || n > 4 {
+		t.Fatalf("got %d pings in 100ms, want 2 to 4", n)
+	}
+}
+
+func TestHealthyDial(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errRefused := errors.New("connection refused")
+	var down int32 = 1
+	fake := rdbtest.New()
+	fake.DialFunc = func() error {
+		if atomic.LoadInt32(&down) != 0 {
+			return errRefused
+		}
+		return nil
+	}
+	fake.Expect("select 1;")
+	conf := fake.Config()
+	conf.ReconnectBackoff = rdb.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	if err := pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != errRefused {
+		t.Fatalf("got %v, want %v", err, errRefused)
+	}
+	if ok, err := rdb.Healthy(pool); ok || err != errRefused {
+		t.Fatalf("got %t, %v while connections fail", ok, err)
+	}
+
+	atomic.StoreInt32(&down, 0)
+	time.Sleep(5 * time.Millisecond)
+	if err := pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := rdb.Healthy(pool); !ok || err != nil {
+		t.Fatalf("got %t, %v after recovery", ok, err)
+	}
+}
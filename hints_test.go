@@ -0,0 +1,64 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestCommandHints(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderDollar
+	fake.Expect("select * from Account where ID = $1;")
+
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hints := map[string]string{
+		rdb.HintForceIndex:      "IX_Account_ID",
+		rdb.HintMaxGrantPercent: "10",
+		"vendor_specific":       "on",
+	}
+	want := map[string]string{}
+	for k, v := range hints {
+		want[k] = v
+	}
+	cmd := &rdb.Command{
+		SQL:   "select * from Account where ID = ?;",
+		Hints: hints,
+	}
+	if err := pool.Query(ctx, cmd, rdb.Param{Value: 1}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	st, err := pool.Prepare(ctx, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Exec(ctx, rdb.Param{Value: 2}).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("got %d calls, want 3", len(calls))
+	}
+	for _, c := range calls {
+		if !reflect.DeepEqual(c.Hints, want) {
+			t.Errorf("%v got hints %v, want %v", c.Op, c.Hints, want)
+		}
+	}
+	if !reflect.DeepEqual(cmd.Hints, want) {
+		t.Errorf("command hints modified to %v", cmd.Hints)
+	}
+}
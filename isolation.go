@@ -0,0 +1,74 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import "fmt"
+
+var isolationNames = [...]string{
+	IsoDefault:        "default",
+	IsoReadUncommited: "read uncommitted",
+	IsoReadCommited:   "read committed",
+	IsoWriteCommited:  "write committed",
+	IsoRepeatableRead: "repeatable read",
+	IsoSerializable:   "serializable",
+	IsoSnapshot:       "snapshot",
+	IsoLinearizable:   "linearizable",
+}
+
+func (iso Isolation) String() string {
+	if int(iso) < len(isolationNames) {
+		return isolationNames[iso]
+	}
+	return fmt.Sprintf("isolation(%d)", iso)
+}
+
+// IsolationSet is a set of isolation levels.
+type IsolationSet uint16
+
+// IsolationLevels returns a set of the levels.
+func IsolationLevels(levels ...Isolation) IsolationSet {
+	var set IsolationSet
+	for _, iso := range levels {
+		set |= 1 << iso
+	}
+	return set
+}
+
+// Has returns true if iso is in the set.
+func (set IsolationSet) Has(iso Isolation) bool {
+	return set&(1<<iso) != 0
+}
+
+// isolationFallback lists the levels used in order when a level is not
+// supported. Levels are not weakened except that snapshot is satisfied by
+// repeatable read, which gives a snapshot in PostgreSQL, and linearizable
+// by serializable.
+var isolationFallback = map[Isolation][]Isolation{
+	IsoReadUncommited: {IsoReadCommited, IsoRepeatableRead, IsoSnapshot, IsoSerializable},
+	IsoReadCommited:   {IsoRepeatableRead, IsoSnapshot, IsoSerializable},
+	IsoWriteCommited:  {IsoRepeatableRead, IsoSnapshot, IsoSerializable},
+	IsoRepeatableRead: {IsoSnapshot, IsoSerializable},
+	IsoSnapshot:       {IsoRepeatableRead, IsoSerializable},
+	IsoSerializable:   {IsoLinearizable},
+	IsoLinearizable:   {IsoSerializable, IsoSnapshot, IsoRepeatableRead},
+}
+
+// resolveIsolation returns the level to request from a driver that
+// supports the set of levels. An empty set is not declared and every level
+// is passed to the driver. If strict is true a level that is not supported
+// is an error, otherwise the nearest supported level is used.
+func resolveIsolation(iso Isolation, set IsolationSet, strict bool) (Isolation, error) {
+	if iso == IsoDefault || set == 0 || set.Has(iso) {
+		return iso, nil
+	}
+	if !strict {
+		for _, alt := range isolationFallback[iso] {
+			if set.Has(alt) {
+				return alt, nil
+			}
+		}
+	}
+	return iso, fmt.Errorf("rdb: isolation level %s not supported by driver", iso)
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var jsonTypes = struct {
+	sync.RWMutex
+	set map[Type]bool
+}{set: map[Type]bool{TypeJSON: true}}
+
+// RegisterJSONType declares that columns of the type hold JSON text, such
+// as the jsonb type of a PostgreSQL driver. Drivers should call it from
+// init for each of their JSON types. TypeJSON is always registered.
+func RegisterJSONType(t Type) {
+	jsonTypes.Lock()
+	defer jsonTypes.Unlock()
+	jsonTypes.set[t] = true
+}
+
+func isJSONType(t Type) bool {
+	jsonTypes.RLock()
+	defer jsonTypes.RUnlock()
+	return jsonTypes.set[t]
+}
+
+// assignJSON unmarshals src into dest if the column type t is a JSON type
+// and dest points to a struct, map, slice or array other then a []byte. It
+// returns false if src was not assigned. NULL is left to assign.
+func assignJSON(dest, src interface{}, t Type) (bool, error) {
+	if src == nil || !isJSONType(t) {
+		return false, nil
+	}
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return false, nil
+	}
+	dt := reflect.TypeOf(dest)
+	if dt == nil || dt.Kind() != reflect.Ptr {
+		return false, nil
+	}
+	if dt.Implements(scannerType) {
+		return false, nil
+	}
+	et := dt.Elem()
+	for et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	switch et.Kind() {
+	case reflect.Struct:
+		if et == timeType {
+			return false, nil
+		}
+	case reflect.Map, reflect.Array:
+	case reflect.Slice:
+		if et.Elem().Kind() == reflect.Uint8 {
+			return false, nil
+		}
+	default:
+		return false, nil
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		return true, fmt.Errorf("rdb: cannot unmarshal JSON into %s: %v", dt.Elem(), err)
+	}
+	return true, nil
+}
+
+// jsonParams returns the params with the value of each JSON type parameter
+// that is not already text or bytes marshaled with encoding/json. The
+// params are copied if changed.
+func jsonParams(params []Param) ([]Param, error) {
+	var out []Param
+	for i, p := range params {
+		if p.Out || p.Value == nil || !isJSONType(p.Type) {
+			continue
+		}
+		switch p.Value.(type) {
+		case []byte, string:
+			continue
+		}
+		data, err := json.Marshal(p.Value)
+		if err != nil {
+			return nil, fmt.Errorf("rdb: parameter %q: cannot marshal JSON: %v", p.Name, err)
+		}
+		if out == nil {
+			out = append([]Param(nil), params...)
+		}
+		out[i].Value = data
+	}
+	if out == nil {
+		return params, nil
+	}
+	return out, nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+const typeJSONB = rdb.TypeDriverThresh + 3802
+
+func init() {
+	rdb.RegisterJSONType(typeJSONB)
+}
+
+func jsonBuffer(t *testing.T, typ rdb.Type, values ...interface{}) *rdb.Buffer {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "select ID, Data from Event;"
+	rs := rdbtest.NewResult("ID", "Data")
+	rs.Schema[1].Type = typ
+	for i, v := range values {
+		rs.Row(int64(i+1), v)
+	}
+	fake := rdbtest.New()
+	fake.Expect(sql).Returns(rs)
+	b, err := fake.Query(ctx, &rdb.Command{SQL: sql}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestJSONMap(t *testing.T) {
+	b := jsonBuffer(t, rdb.TypeJSON, `{"kind":"login","count":2}`, []byte(`{"tags":["a","b"]}`), nil)
+
+	var m map[string]interface{}
+	b.Row[0].Into("Data", &m)
+	want := map[string]interface{}{"kind": "login", "count": float64(2)}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("got %v, want %v", m, want)
+	}
+	m = nil
+	b.Row[1].Into("Data", &m)
+	if tags, _ := m["tags"].([]interface{}); len(tags) != 2 {
+		t.Fatalf("got %v from binary JSON", m)
+	}
+	b.Row[2].Into("Data", &m)
+	if m != nil {
+		t.Fatalf("got %v for NULL, want nil map", m)
+	}
+
+	// Text destinations still receive the raw JSON.
+	var s string
+	b.Row[0].Into("Data", &s)
+	if s != `{"kind":"login","count":2}` {
+		t.Fatalf("got raw text %q", s)
+	}
+}
+
+func TestJSONStruct(t *testing.T) {
+	type detail struct {
+		Browser string `json:"browser"`
+		Version int    `json:"version"`
+	}
+	type event struct {
+		ID   int64
+		Data struct {
+			Kind   string  `json:"kind"`
+			Detail *detail `json:"detail"`
+		}
+	}
+	b := jsonBuffer(t, typeJSONB, `{"kind":"login","detail":{"browser":"lynx","version":2}}`)
+
+	var e event
+	if err := rdb.IntoStruct(b.Row[0], b.Schema, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != 1 || e.Data.Kind != "login" || e.Data.Detail == nil || *e.Data.Detail != (detail{"lynx", 2}) {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
+
+func TestJSONMalformed(t *testing.T) {
+	b := jsonBuffer(t, rdb.TypeJSON, `{"kind":`)
+
+	var e struct {
+		ID   int64
+		Data map[string]string
+	}
+	err := rdb.IntoStruct(b.Row[0], b.Schema, &e)
+	if err == nil || !strings.Contains(err.Error(), `column "Data"`) {
+		t.Fatalf("got %v, want JSON error for column Data", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected Into to panic on malformed JSON")
+		}
+	}()
+	var m map[string]interface{}
+	b.Row[0].Into("Data", &m)
+}
+
+func TestJSONParam(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "insert into Event (Data, Tags, Raw) values (?, ?, ?);"
+	fake := rdbtest.New()
+	fake.Expect(sql)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	type detail struct {
+		Kind  string `json:"kind"`
+		Count int    `json:"count"`
+	}
+	err = pool.Query(ctx, &rdb.Command{SQL: sql},
+		rdb.Param{Type: rdb.TypeJSON, Value: detail{"login", 2}},
+		rdb.Param{Type: typeJSONB, Value: map[string]bool{"new": true}},
+		rdb.Param{Type: rdb.TypeJSON, Value: `{"raw":1}`},
+	).Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fake.Calls()[0].Params
+	want := []interface{}{[]byte(`{"kind":"login","count":2}`), []byte(`{"new":true}`), `{"raw":1}`}
+	for i := range want {
+		if !reflect.DeepEqual(got[i].Value, want[i]) {
+			t.Errorf("param %d: got %#v, want %#v", i, got[i].Value, want[i])
+		}
+	}
+
+	err = pool.Query(ctx, &rdb.Command{SQL: "insert into Event (Data) values (?);"},
+		rdb.Param{Type: rdb.TypeJSON, Value: make(chan int)},
+	).Close()
+	if err == nil || !strings.Contains(err.Error(), "cannot marshal JSON") {
+		t.Fatalf("got %v, want marshal error", err)
+	}
+	if n := len(fake.Calls()); n != 1 {
+		t.Fatalf("got %d calls, the failed param should not reach the driver", n)
+	}
+}
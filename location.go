@@ -0,0 +1,256 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"fmt"
+	"time"
+)
+
+// localColumns returns the index of each column holding a time without a
+// time zone, or nil if there are none.
+func localColumns(schema Schema) map[int]bool {
+	var local map[int]bool
+	for _, col := range schema {
+		if col.Type != TypeTimestamp {
+			continue
+		}
+		if local == nil {
+			local = make(map[int]bool)
+		}
+		local[col.Index] = true
+	}
+	return local
+}
+
+// inLocation returns the wall clock of a time.Time value in loc.
+// Other values are returned unchanged.
+func inLocation(v interface{}, loc *time.Location) interface{} {
+	t, ok := v.(time.Time)
+	if !ok {
+		return v
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// parseTime parses text with the layouts followed by timeLayouts. Times
+// without a time zone are parsed in loc.
+func parseTime(s string, layouts []string, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, list := range [][]string{layouts, timeLayouts} {
+		for _, layout := range list {
+			if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("rdb: cannot parse %q as a time", s)
+}
+
+// assignTime parses a text src into a *time.Time dest with the layouts.
+// It returns false if dest is not a *time.Time or src is not text.
+func assignTime(dest, src interface{}, layouts []string, loc *time.Location) (bool, error) {
+	t, ok := dest.(*time.Time)
+	if !ok {
+		return false, nil
+	}
+	s, ok := textValue(src)
+	if !ok {
+		return false, nil
+	}
+	v, err := parseTime(s, layouts, loc)
+	if err != nil {
+		return true, err
+	}
+	*t = v
+	return true, nil
+}
+
+// locationNext interprets timestamps without a time zone in loc and
+// parses text read into a time.Time with the layouts.
+type locationNext struct {
+	Next
+
+	loc     *time.Location // Nil if only parsing text.
+	layouts []string
+}
+
+// local returns the columns of the schema to interpret in loc.
+func (n *locationNext) local(schema Schema) map[int]bool {
+	if n.loc == nil {
+		return nil
+	}
+	return localColumns(schema)
+}
+
+func (n *locationNext) driverNext() Next {
+	return n.Next
+}
+
+func (n *locationNext) Result() (Result, error) {
+	res, err := n.Next.Result()
+	if res == nil {
+		return res, err
+	}
+	local := n.local(res.Schema())
+	if local == nil && len(n.layouts) == 0 {
+		return res, err
+	}
+	return &locationResult{Result: res, loc: n.loc, layouts: n.layouts, local: local}, err
+}
+
+func (n *locationNext) Buffer() (*Buffer, error) {
+	b, err := n.Next.Buffer()
+	if b != nil {
+		n.localBuffer(b)
+	}
+	return b, err
+}
+
+func (n *locationNext) BufferSet() (BufferSet, error) {
+	set, err := n.Next.BufferSet()
+	for _, b := range set {
+		n.localBuffer(b)
+	}
+	return set, err
+}
+
+func (n *locationNext) localBuffer(b *Buffer) {
+	local := n.local(b.Schema)
+	if local == nil && len(n.layouts) == 0 {
+		return
+	}
+	for i, row := range b.Row {
+		if vr, ok := row.(*ValueRow); ok {
+			for index := range local {
+				vr.Values[index] = inLocation(vr.Values[index], n.loc)
+			}
+			vr.layouts, vr.loc = n.layouts, n.loc
+			continue
+		}
+		b.Row[i] = &locationRow{Row: row, schema: b.Schema, loc: n.loc, layouts: n.layouts, local: local}
+	}
+}
+
+type locationResult struct {
+	Result
+
+	loc     *time.Location
+	layouts []string
+	local   map[int]bool
+	prep    map[int]interface{} // Prepared values of local columns.
+}
+
+func (res *locationResult) Prep(name string, value interface{}) Result {
+	for _, col := range res.Schema() {
+		if col.Name == name {
+			return res.Prepx(col.Index, value)
+		}
+	}
+	res.Result.Prep(name, value)
+	return res
+}
+
+func (res *locationResult) Prepx(index int, value interface{}) Result {
+	if !res.local[index] {
+		res.Result.Prepx(index, value)
+		return res
+	}
+	if res.prep == nil {
+		res.prep = make(map[int]interface{})
+	}
+	res.prep[index] = value
+	return res
+}
+
+func (res *locationResult) Scan() (Row, error) {
+	row, err := res.Result.Scan()
+	if row == nil {
+		return row, err
+	}
+	lr := &locationRow{Row: row, schema: res.Schema(), loc: res.loc, layouts: res.layouts, local: res.local}
+	return PrepRow(lr, res.Schema(), res.prep)
+}
+
+func (res *locationResult) ScanInto(row *ValueRow) (bool, error) {
+	ok, err := ScanInto(res.Result, row)
+	if !ok {
+		return ok, err
+	}
+	for index := range res.local {
+		row.Values[index] = inLocation(row.Values[index], res.loc)
+	}
+	row.layouts, row.loc = res.layouts, res.loc
+	for index, dest := range res.prep {
+		if err := intox(row, index, dest); err != nil {
+			return false, err
+		}
+	}
+	return ok, err
+}
+
+func (r *locationRow) nullAsZero() bool {
+	return rowNullAsZero(r.Row)
+}
+
+type locationRow struct {
+	Row
+
+	schema  Schema
+	loc     *time.Location
+	layouts []string
+	local   map[int]bool
+}
+
+func (r *locationRow) index(name string) (int, bool) {
+	for _, col := range r.schema {
+		if col.Name == name {
+			return col.Index, true
+		}
+	}
+	return 0, false
+}
+
+func (r *locationRow) Get(name string) interface{} {
+	if index, found := r.index(name); found && r.local[index] {
+		return r.Getx(index)
+	}
+	return r.Row.Get(name)
+}
+
+func (r *locationRow) Getx(index int) interface{} {
+	v := r.Row.Getx(index)
+	if r.local[index] {
+		return inLocation(v, r.loc)
+	}
+	return v
+}
+
+func (r *locationRow) Into(name string, value interface{}) Row {
+	if index, found := r.index(name); found {
+		return r.Intox(index, value)
+	}
+	r.Row.Into(name, value)
+	return r
+}
+
+func (r *locationRow) Intox(index int, value interface{}) Row {
+	if ok, err := assignTime(value, r.Row.Getx(index), r.layouts, r.loc); ok {
+		if err != nil {
+			panic(err)
+		}
+		return r
+	}
+	if !r.local[index] {
+		r.Row.Intox(index, value)
+		return r
+	}
+	if err := assign(value, r.Getx(index), rowNullAsZero(r.Row)); err != nil {
+		panic(err)
+	}
+	return r
+}
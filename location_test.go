@@ -0,0 +1,162 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestParseConfigLocation(t *testing.T) {
+	conf, err := rdb.ParseConfigURL("pg://localhost/?loc=America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Location == nil || conf.Location.String() != "America/New_York" {
+		t.Fatalf("got location %v", conf.Location)
+	}
+	if _, err := rdb.ParseConfigURL("pg://localhost/?loc=Nowhere/Special"); err == nil {
+		t.Fatal("expected error for unknown location")
+	}
+}
+
+func TestLocationScan(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	loc := time.FixedZone("EST", -5*3600)
+	wall := time.Date(2016, 5, 1, 12, 30, 0, 0, time.UTC)
+	set := rdbtest.NewResult("Local", "Zoned").Row(wall, wall)
+	set.Schema[0].Type = rdb.TypeTimestamp
+	set.Schema[1].Type = rdb.TypeTimestampz
+
+	fake := rdbtest.New()
+	fake.Expect("select Local, Zoned;").Returns(set)
+	conf := fake.Config()
+	conf.Location = loc
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2016, 5, 1, 12, 30, 0, 0, loc)
+
+	res, err := pool.Query(ctx, &rdb.Command{SQL: "select Local, Zoned;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prepped time.Time
+	res.Prep("Local", &prepped)
+	row, err := res.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var local, zoned time.Time
+	row.Into("Zoned", &zoned)
+	res.Close()
+
+	res, err = pool.Query(ctx, &rdb.Command{SQL: "select Local, Zoned;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err = res.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row.Into("Local", &local)
+	res.Close()
+
+	if !local.Equal(want) || local.Location() != loc {
+		t.Errorf("got local %v, want %v", local, want)
+	}
+	if !prepped.Equal(want) {
+		t.Errorf("got prepared %v, want %v", prepped, want)
+	}
+	if !zoned.Equal(wall) {
+		t.Errorf("got zoned %v, want %v", zoned, wall)
+	}
+
+	buf, err := pool.Query(ctx, &rdb.Command{SQL: "select Local, Zoned;"}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.Row[0].Get("Local").(time.Time); !got.Equal(want) {
+		t.Errorf("got buffered %v, want %v", got, want)
+	}
+
+	// A prepared destination that cannot be assigned fails ScanInto.
+	res, err = pool.Query(ctx, &rdb.Command{SQL: "select Local, Zoned;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	var bad int
+	res.Prep("Local", &bad)
+	var vr rdb.ValueRow
+	if ok, err := rdb.ScanInto(res, &vr); ok || err == nil {
+		t.Fatalf("got %t, %v, want assignment error", ok, err)
+	}
+}
+
+func TestTimeLayouts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	loc := time.FixedZone("EST", -5*3600)
+	fake := rdbtest.New()
+	fake.Expect("select Created, Updated, Audited;").Returns(rdbtest.NewResult("Created", "Updated", "Audited").
+		Row("01/05/2016 12:30", "2016.05.01-12h30m15s", "2016-05-01 12:30:00"))
+	conf := fake.Config()
+	conf.Location = loc
+	conf.TimeLayouts = []string{"02/01/2006 15:04", "2006.01.02-15h04m05s"}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	want := []time.Time{
+		time.Date(2016, 5, 1, 12, 30, 0, 0, loc),
+		time.Date(2016, 5, 1, 12, 30, 15, 0, loc),
+		time.Date(2016, 5, 1, 12, 30, 0, 0, loc),
+	}
+	check := func(name string, row rdb.Row) {
+		var created, updated, audited time.Time
+		row.Into("Created", &created).Into("Updated", &updated).Into("Audited", &audited)
+		for i, got := range []time.Time{created, updated, audited} {
+			if !got.Equal(want[i]) || got.Location() != loc {
+				t.Errorf("%s column %d: got %v, want %v", name, i, got, want[i])
+			}
+		}
+	}
+
+	res, err := pool.Query(ctx, &rdb.Command{SQL: "select Created, Updated, Audited;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := res.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("scan", row)
+	res.Close()
+
+	b, err := pool.Query(ctx, &rdb.Command{SQL: "select Created, Updated, Audited;"}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("buffer", b.Row[0])
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for text in no known layout")
+		}
+	}()
+	var bad time.Time
+	rdb.NewValueRow(rdb.Schema{{Name: "Bad"}}).Intox(0, &bad)
+}
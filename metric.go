@@ -0,0 +1,233 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// QueryMetric describes a completed query. It is passed to Config.OnQuery.
+type QueryMetric struct {
+	Name             string        // Command name.
+	RenderedSQL      string        // SQL sent to the driver after placeholders were rewritten.
+	Correlation      string        // Context value of Config.CorrelationKey, empty if not set.
+	SessionID        string        // Server session of the connection if reported by the driver.
+	Duration         time.Duration // From the start of the query until it was closed or fully read.
+	Queued           time.Duration // Time spent waiting for a pooled connection.
+	RowsReturned     int64         // Rows read from results and buffers.
+	RowsAffected     int64         // Rows affected if reported by the driver.
+	Prepared         bool          // True if run from a prepared Statement.
+	PreparedCacheHit bool          // True if the Statement was already prepared on the connection.
+	Err              error         // First error returned by the query.
+}
+
+// RowsAffecter may be implemented by a driver Next to report the number of
+// rows affected by the command.
+type RowsAffecter interface {
+	RowsAffected() int64
+}
+
+// QueueTimer may be implemented by a driver Next to report the time the
+// query waited for a pooled connection.
+type QueueTimer interface {
+	Queued() time.Duration
+}
+
+// SessionIDer may be implemented by a driver Connection, and the driver
+// Next of a query, to report the server session or process ID of the
+// connection, such as @@SPID in SQL Server or pg_backend_pid() in
+// PostgreSQL.
+type SessionIDer interface {
+	SessionID() (string, error)
+}
+
+// SessionID returns the server session ID of the connection.
+// ErrNotSupported is returned if the driver does not report it.
+func SessionID(conn Connection) (string, error) {
+	if c, ok := conn.(*connection); ok {
+		conn = c.Connection
+	}
+	if s, ok := conn.(SessionIDer); ok {
+		return s.SessionID()
+	}
+	return "", ErrNotSupported
+}
+
+// PreparedCacheHitter may be implemented by a driver Next of a prepared
+// Statement to report if the statement was already prepared on the
+// connection it ran on rather then prepared for this execution.
+type PreparedCacheHitter interface {
+	PreparedCacheHit() bool
+}
+
+// PreparedCacheHit returns true if next is from a prepared Statement that
+// reused the statement cached on its connection. It returns false if the
+// driver does not report it.
+func PreparedCacheHit(next Next) bool {
+	if h, ok := driverNextOf(next).(PreparedCacheHitter); ok {
+		return h.PreparedCacheHit()
+	}
+	return false
+}
+
+// metricNext reports a QueryMetric when the query is closed or fully read.
+type metricNext struct {
+	Next
+
+	start   time.Time
+	onQuery func(QueryMetric)
+
+	mu     sync.Mutex
+	metric QueryMetric
+	done   bool
+}
+
+func newMetricNext(next Next, start time.Time, name, sql, correlation string, prepared bool, onQuery func(QueryMetric)) *metricNext {
+	return &metricNext{
+		Next:    next,
+		start:   start,
+		onQuery: onQuery,
+		metric: QueryMetric{
+			Name:        name,
+			RenderedSQL: sql,
+			Correlation: correlation,
+			Prepared:    prepared,
+		},
+	}
+}
+
+// correlation returns the context value of key as a string.
+func correlation(ctx context.Context, key interface{}) string {
+	if key == nil {
+		return ""
+	}
+	switch v := ctx.Value(key).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (n *metricNext) driverNext() Next {
+	return n.Next
+}
+
+// read records rows read and the first error.
+func (n *metricNext) read(rows int, err error) {
+	n.mu.Lock()
+	n.metric.RowsReturned += int64(rows)
+	if n.metric.Err == nil {
+		n.metric.Err = err
+	}
+	n.mu.Unlock()
+}
+
+// finish reports the metric the first time it is called.
+func (n *metricNext) finish() {
+	n.mu.Lock()
+	if n.done {
+		n.mu.Unlock()
+		return
+	}
+	n.done = true
+	m := n.metric
+	n.mu.Unlock()
+
+	m.Duration = time.Since(n.start)
+	d := driverNextOf(n.Next)
+	if ra, ok := d.(RowsAffecter); ok {
+		m.RowsAffected = ra.RowsAffected()
+	}
+	if qt, ok := d.(QueueTimer); ok {
+		m.Queued = qt.Queued()
+	}
+	if m.Prepared {
+		m.PreparedCacheHit = PreparedCacheHit(n.Next)
+	}
+	if s, ok := d.(SessionIDer); ok {
+		m.SessionID, _ = s.SessionID()
+	}
+	n.onQuery(m)
+}
+
+func (n *metricNext) Result() (Result, error) {
+	res, err := n.Next.Result()
+	n.read(0, err)
+	if res == nil || err != nil {
+		n.finish()
+		return res, err
+	}
+	return &metricResult{Result: res, next: n}, nil
+}
+
+func (n *metricNext) Buffer() (*Buffer, error) {
+	b, err := n.Next.Buffer()
+	rows := 0
+	if b != nil {
+		rows = len(b.Row)
+	}
+	n.read(rows, err)
+	if b == nil || err != nil {
+		n.finish()
+	}
+	return b, err
+}
+
+func (n *metricNext) BufferSet() (BufferSet, error) {
+	set, err := n.Next.BufferSet()
+	rows := 0
+	for _, b := range set {
+		rows += len(b.Row)
+	}
+	n.read(rows, err)
+	n.finish()
+	return set, err
+}
+
+func (n *metricNext) Close() error {
+	err := n.Next.Close()
+	n.read(0, err)
+	n.finish()
+	return err
+}
+
+type metricResult struct {
+	Result
+
+	next *metricNext
+}
+
+func (res *metricResult) Scan() (Row, error) {
+	row, err := res.Result.Scan()
+	rows := 0
+	if row != nil {
+		rows = 1
+	}
+	res.next.read(rows, err)
+	return row, err
+}
+
+func (res *metricResult) ScanInto(row *ValueRow) (bool, error) {
+	ok, err := ScanInto(res.Result, row)
+	rows := 0
+	if ok {
+		rows = 1
+	}
+	res.next.read(rows, err)
+	return ok, err
+}
+
+func (res *metricResult) Close() error {
+	return res.next.Close()
+}
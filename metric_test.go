@@ -0,0 +1,376 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+type metricLog struct {
+	mu   sync.Mutex
+	list []rdb.QueryMetric
+}
+
+func (l *metricLog) add(m rdb.QueryMetric) {
+	l.mu.Lock()
+	l.list = append(l.list, m)
+	l.mu.Unlock()
+}
+
+func (l *metricLog) get() []rdb.QueryMetric {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]rdb.QueryMetric(nil), l.list...)
+}
+
+func openMetrics(t *testing.T, ctx context.Context, fake *rdbtest.Pool, log *metricLog) rdb.Pool {
+	conf := fake.Config()
+	conf.OnQuery = log.add
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestMetricPrepared(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID from Account;").Returns(rdbtest.NewResult("ID").Row(1).Row(2).Row(3))
+	log := &metricLog{}
+	pool := openMetrics(t, ctx, fake, log)
+
+	st, err := pool.Prepare(ctx, &rdb.Command{SQL: "select ID from Account;", Name: "accounts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := st.Exec(ctx).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		row, err := res.Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row == nil {
+			break
+		}
+	}
+	res.Close()
+
+	list := log.get()
+	if len(list) != 1 {
+		t.Fatalf("got %d metrics, want 1", len(list))
+	}
+	m := list[0]
+	if m.Name != "accounts" || !m.Prepared || m.RowsReturned != 3 || m.Err != nil {
+		t.Fatalf("unexpected metric %+v", m)
+	}
+}
+
+func TestMetricPreparedCacheHit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID from Account;")
+	log := &metricLog{}
+	conf := fake.Config()
+	conf.OnQuery = log.add
+	conf.PoolMaxCapacity = 1
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := pool.Prepare(ctx, &rdb.Command{SQL: "select ID from Account;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{false, true} {
+		next := st.Exec(ctx)
+		if got := rdb.PreparedCacheHit(next); got != want {
+			t.Errorf("exec %d: got cache hit %t, want %t", i, got, want)
+		}
+		if err := next.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pool.Query(ctx, &rdb.Command{SQL: "select ID from Account;"}).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	list := log.get()
+	if len(list) != 3 {
+		t.Fatalf("got %d metrics, want 3", len(list))
+	}
+	for i, want := range []bool{false, true, false} {
+		if list[i].PreparedCacheHit != want {
+			t.Errorf("metric %d: got cache hit %t, want %t", i, list[i].PreparedCacheHit, want)
+		}
+	}
+}
+
+func TestMetricRenderedSQL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderDollar
+	fake.Expect("select Name from Account where ID = $1;")
+	log := &metricLog{}
+	pool := openMetrics(t, ctx, fake, log)
+	cmd := &rdb.Command{SQL: "select Name from Account where ID = @ID;"}
+	if err := pool.Query(ctx, cmd, rdb.Param{Name: "ID", Value: 1}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	list := log.get()
+	if len(list) != 1 || list[0].RenderedSQL != "select Name from Account where ID = $1;" {
+		t.Fatalf("unexpected metrics %+v", list)
+	}
+}
+
+func TestMetricSessionID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select 1;")
+	log := &metricLog{}
+	pool := openMetrics(t, ctx, fake, log)
+	defer pool.Close()
+
+	// Two concurrent queries run on the first and second connection.
+	first := pool.Query(ctx, &rdb.Command{SQL: "select 1;"})
+	second := pool.Query(ctx, &rdb.Command{SQL: "select 1;"})
+	first.Close()
+	second.Close()
+
+	conn, err := pool.Connection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := rdb.SessionID(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	list := log.get()
+	if len(list) != 3 {
+		t.Fatalf("got %d metrics, want 3", len(list))
+	}
+	for i, want := range []string{"1", "2", id} {
+		if list[i].SessionID != want {
+			t.Errorf("metric %d: got session %q, want %q", i, list[i].SessionID, want)
+		}
+	}
+}
+
+func TestMetricSlow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const delay = 30 * time.Millisecond
+	fake := rdbtest.New()
+	fake.Expect("update Account set Active = 0;").Delay(delay).Affected(7)
+	log := &metricLog{}
+	pool := openMetrics(t, ctx, fake, log)
+
+	err := pool.Query(ctx, &rdb.Command{SQL: "update Account set Active = 0;", Name: "deactivate"}).Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := log.get()
+	if len(list) != 1 {
+		t.Fatalf("got %d metrics, want 1", len(list))
+	}
+	m := list[0]
+	if m.Name != "deactivate" || m.Prepared || m.Duration < delay || m.RowsAffected != 7 {
+		t.Fatalf("unexpected metric %+v", m)
+	}
+}
+
+func TestMetricWrapped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("update Account set Active = 0;").Affected(7)
+	log := &metricLog{}
+	conf := fake.Config()
+	conf.OnQuery = log.add
+	conf.MaxRowsPerQuery = 100
+	conf.IncludeParamsInErrors = true
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	cmd := &rdb.Command{SQL: "update Account set Active = 0;", Timeout: time.Minute}
+	if err := pool.Query(ctx, cmd).Close(); err != nil {
+		t.Fatal(err)
+	}
+	list := log.get()
+	if len(list) != 1 || list[0].RowsAffected != 7 {
+		t.Fatalf("unexpected metrics %+v", list)
+	}
+}
+
+func TestMetricError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failed := errors.New("syntax error")
+	fake := rdbtest.New()
+	fake.Expect("selec 1;").Error(failed)
+	log := &metricLog{}
+	pool := openMetrics(t, ctx, fake, log)
+
+	if _, err := pool.Query(ctx, &rdb.Command{SQL: "selec 1;"}).Buffer(); err != failed {
+		t.Fatalf("got %v, want %v", err, failed)
+	}
+	list := log.get()
+	if len(list) != 1 || list[0].Err != failed {
+		t.Fatalf("unexpected metrics %+v", list)
+	}
+}
+
+func TestMetricQueued(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const hold = 30 * time.Millisecond
+	fake := rdbtest.New()
+	fake.Expect("select 1;")
+	log := &metricLog{}
+	conf := fake.Config()
+	conf.OnQuery = log.add
+	conf.PoolMaxCapacity = 1
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	held := pool.Query(ctx, &rdb.Command{SQL: "select 1;", Name: "held"})
+	go func() {
+		time.Sleep(hold)
+		held.Close()
+	}()
+	if err := pool.Query(ctx, &rdb.Command{SQL: "select 1;", Name: "waiting"}).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range log.get() {
+		if m.Name == "waiting" {
+			if m.Queued < hold/2 || m.Duration < m.Queued {
+				t.Fatalf("unexpected queue time in %+v", m)
+			}
+			return
+		}
+	}
+	t.Fatal("no metric for waiting query")
+}
+
+type requestIDKey struct{}
+
+func TestMetricCorrelation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID from Account;").Returns(rdbtest.NewResult("ID").Row(1))
+	log := &metricLog{}
+	conf := fake.Config()
+	conf.OnQuery = log.add
+	conf.CorrelationKey = requestIDKey{}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	cmd := &rdb.Command{SQL: "select ID from Account;"}
+	reqCtx := context.WithValue(ctx, requestIDKey{}, "req-81")
+	if _, err := pool.Query(reqCtx, cmd).BufferSet(); err != nil {
+		t.Fatal(err)
+	}
+	st, err := pool.Prepare(ctx, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Exec(reqCtx).BufferSet(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Query(ctx, cmd).BufferSet(); err != nil {
+		t.Fatal(err)
+	}
+
+	list := log.get()
+	if len(list) != 3 {
+		t.Fatalf("got %d metrics, want 3", len(list))
+	}
+	if list[0].Correlation != "req-81" || list[1].Correlation != "req-81" {
+		t.Errorf("got correlation %q and %q, want req-81", list[0].Correlation, list[1].Correlation)
+	}
+	if list[2].Correlation != "" {
+		t.Errorf("got correlation %q without a context value", list[2].Correlation)
+	}
+}
+
+func TestOnInfo(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgs := []rdb.InfoMessage{
+		{Message: "Checking accounts", Severity: 0, State: 1, Server: "db1", Procedure: "Audit", Line: 4},
+		{Message: "Warning: 2 rows skipped", Severity: 10, State: 1, Server: "db1", Procedure: "Audit", Line: 9},
+	}
+	fake := rdbtest.New()
+	fake.Expect("exec Audit;").
+		Info(msgs...).
+		Returns(rdbtest.NewResult("Checked").Row(int64(40)))
+
+	var mu sync.Mutex
+	var got []rdb.InfoMessage
+	conf := fake.Config()
+	conf.OnInfo = func(msg rdb.InfoMessage) {
+		mu.Lock()
+		got = append(got, msg)
+		mu.Unlock()
+	}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	b, err := pool.Query(ctx, &rdb.Command{SQL: "exec Audit;"}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Row) != 1 {
+		t.Fatalf("got %d rows, want 1", len(b.Row))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 || got[0] != msgs[0] || got[1] != msgs[1] {
+		t.Fatalf("got messages %+v", got)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+)
+
+// SavePointReleaser may be implemented by a driver Transaction to release
+// a savepoint and the savepoints created after it, such as with
+// RELEASE SAVEPOINT.
+type SavePointReleaser interface {
+	ReleaseSavePoint(ctx context.Context, name string) error
+}
+
+var savePointSeq uint64
+
+// Nested runs fn in a savepoint of the transaction with a generated name.
+// If fn returns an error the transaction is rolled back to the savepoint
+// and the error is returned, otherwise the savepoint is released if the
+// driver implements SavePointReleaser. Nested may be called again in fn.
+func Nested(ctx context.Context, tx Transaction, fn func(Transaction) error) error {
+	name := "rdb_sp" + strconv.FormatUint(atomic.AddUint64(&savePointSeq, 1), 10)
+	if err := tx.SavePoint(ctx, name); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rerr := tx.RollbackTo(ctx, name); rerr != nil {
+			return fmt.Errorf("rdb: rollback to savepoint after %v: %v", err, rerr)
+		}
+		return err
+	}
+	var driver interface{} = tx
+	if t, ok := tx.(*transaction); ok {
+		driver = t.Transaction
+	}
+	if r, ok := driver.(SavePointReleaser); ok {
+		return r.ReleaseSavePoint(ctx, name)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestNested(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("insert A;")
+	fake.Expect("insert B;")
+	fake.Expect("insert C;")
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	tx, err := pool.Begin(ctx, rdb.IsoDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec := func(tx rdb.Transaction, sql string) error {
+		return tx.Query(ctx, &rdb.Command{SQL: sql}).Close()
+	}
+
+	errFail := errors.New("insert failed")
+	err = rdb.Nested(ctx, tx, func(tx rdb.Transaction) error {
+		if err := exec(tx, "insert A;"); err != nil {
+			return err
+		}
+		// The failing inner block only rolls back its own savepoint.
+		err := rdb.Nested(ctx, tx, func(tx rdb.Transaction) error {
+			if err := exec(tx, "insert B;"); err != nil {
+				return err
+			}
+			return errFail
+		})
+		if err != errFail {
+			return fmt.Errorf("got inner error %v, want %v", err, errFail)
+		}
+		return rdb.Nested(ctx, tx, func(tx rdb.Transaction) error {
+			return exec(tx, "insert C;")
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	type op struct {
+		Op   rdbtest.Op
+		Name string
+	}
+	var got []op
+	for _, c := range fake.Calls() {
+		got = append(got, op{c.Op, c.Name})
+	}
+	if len(got) != 11 {
+		t.Fatalf("got %d calls %v, want 11", len(got), got)
+	}
+	outer, inner, second := got[1].Name, got[3].Name, got[6].Name
+	if outer == inner || inner == second || outer == second {
+		t.Fatalf("savepoint names not distinct %q, %q, %q", outer, inner, second)
+	}
+	want := []op{
+		{rdbtest.OpBegin, ""},
+		{rdbtest.OpSavePoint, outer},
+		{rdbtest.OpQuery, ""},
+		{rdbtest.OpSavePoint, inner},
+		{rdbtest.OpQuery, ""},
+		{rdbtest.OpRollbackTo, inner},
+		{rdbtest.OpSavePoint, second},
+		{rdbtest.OpQuery, ""},
+		{rdbtest.OpReleaseSavePoint, second},
+		{rdbtest.OpReleaseSavePoint, outer},
+		{rdbtest.OpCommit, ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got calls %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import "golang.org/x/net/context"
+
+// Notification is an asynchronous message sent by the server to a channel,
+// such as with NOTIFY in PostgreSQL.
+type Notification struct {
+	Channel string
+	Payload string
+}
+
+// Listener may be implemented by a driver Connection that can receive
+// notifications.
+type Listener interface {
+	// Listen subscribes the connection to the channel. Notifications are
+	// sent on the returned channel until the context is done or the
+	// connection is closed or lost, then the channel is closed.
+	Listen(ctx context.Context, channel string) (<-chan Notification, error)
+}
+
+// Listen subscribes the dedicated connection to the channel and returns
+// the notifications sent to it. The returned channel is closed when the
+// context is done or the connection is closed or lost.
+// ErrNotSupported is returned if the driver does not support notifications.
+func Listen(ctx context.Context, conn Connection, channel string) (<-chan Notification, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c, ok := conn.(*connection); ok {
+		conn = c.Connection
+	}
+	if l, ok := conn.(Listener); ok {
+		return l.Listen(ctx, channel)
+	}
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestListen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	conn, err := pool.Connection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	lctx, lcancel := context.WithCancel(ctx)
+	notes, err := rdb.Listen(lctx, conn, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		fake.Notify("invoices", "ignored")
+		fake.Notify("orders", "1")
+		fake.Notify("orders", "2")
+	}()
+	for _, want := range []string{"1", "2"} {
+		select {
+		case n := <-notes:
+			if n.Channel != "orders" || n.Payload != want {
+				t.Fatalf("got %+v, want payload %q", n, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("notification %q not received", want)
+		}
+	}
+
+	lcancel()
+	select {
+	case n, ok := <-notes:
+		if ok {
+			t.Fatalf("got %+v after cancel", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+	if got := fake.Notify("orders", "3"); got != 0 {
+		t.Fatalf("notified %d listeners after cancel, want 0", got)
+	}
+}
+
+func TestListenConnectionClosed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	conn, err := pool.Connection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := rdb.Listen(ctx, conn, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	select {
+	case _, ok := <-notes:
+		if ok {
+			t.Fatal("got notification after close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed with the connection")
+	}
+}
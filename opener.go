@@ -6,7 +6,9 @@ package rdb
 
 import (
 	"errors"
+	"net"
 	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 )
@@ -15,7 +17,8 @@ var (
 	errNoOpenerFound = errors.New("Now opener found that could open config")
 )
 
-// Open a new database connection pool.
+// Open a new database connection pool. If the driver fails to open with a
+// transient error it is tried again as set by Config.OpenRetry.
 func Open(ctx context.Context, config *Config) (Pool, error) {
 	var found Opener
 
@@ -30,7 +33,67 @@ func Open(ctx context.Context, config *Config) (Pool, error) {
 	if found == nil {
 		return nil, errNoOpenerFound
 	}
-	return found.Open(ctx, config)
+	driver, err := openRetry(ctx, found, config)
+	if err != nil {
+		return nil, err
+	}
+	return newPool(config, driver), nil
+}
+
+// OpenRetry sets how many times Open tries a driver that fails with a
+// transient error, such as while the database is still starting.
+type OpenRetry struct {
+	Attempts int // Max number of attempts. Zero or one tries once.
+
+	// Interval, if set, is a fixed time to wait between attempts. Zero
+	// waits as set by Config.ReconnectBackoff.
+	Interval time.Duration
+}
+
+// Transient may be implemented by a driver error to report if the operation
+// failed for a reason that may pass, such as a refused connection, rather
+// then one that will not, such as a failed login.
+type Transient interface {
+	Transient() bool
+}
+
+// IsTransient returns true if err is a connection error that may not occur
+// if tried again: ErrBadConn, a net.Error, or an error that implements
+// Transient and reports true.
+func IsTransient(err error) bool {
+	switch err := err.(type) {
+	case nil:
+		return false
+	case Transient:
+		return err.Transient()
+	case net.Error:
+		return true
+	}
+	return err == ErrBadConn
+}
+
+// openRetry opens the driver, trying again after transient errors. The
+// error of the last attempt is returned.
+func openRetry(ctx context.Context, o Opener, config *Config) (Pool, error) {
+	retry := config.OpenRetry
+	backoff := NewBackoffState(config.ReconnectBackoff)
+	for attempt := 1; ; attempt++ {
+		driver, err := o.Open(ctx, config)
+		if err == nil || attempt >= retry.Attempts || !IsTransient(err) {
+			return driver, err
+		}
+		wait := retry.Interval
+		if wait <= 0 {
+			wait = backoff.Fail()
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+	}
 }
 
 /*
@@ -57,3 +120,28 @@ func RegisterOpener(opener Opener) {
 
 	openerList = append(openerList, opener)
 }
+
+// PingWait pings the pool until it succeeds or the context is done, waiting
+// interval between attempts. If the context is done first the error from the
+// last failed ping is returned. This is useful to wait for a database to
+// start.
+func PingWait(ctx context.Context, p Pool, interval time.Duration) error {
+	var last error
+	for {
+		err := p.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		// Keep the ping error rather then a context error caused by the deadline.
+		if last == nil || ctx.Err() == nil {
+			last = err
+		}
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return last
+		case <-t.C:
+		}
+	}
+}
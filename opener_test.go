@@ -0,0 +1,172 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestPingWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	starting := errors.New("database is starting up")
+	fake := rdbtest.New()
+	attempts := 0
+	fake.PingFunc = func(ctx context.Context) error {
+		attempts++
+		if attempts < 4 {
+			return starting
+		}
+		return nil
+	}
+	if err := rdb.PingWait(ctx, fake, 5*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 4 {
+		t.Fatalf("got %d attempts, want 4", attempts)
+	}
+}
+
+func TestPingWaitTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	down := errors.New("connection refused")
+	fake := rdbtest.New()
+	fake.PingError = down
+
+	start := time.Now()
+	if err := rdb.PingWait(ctx, fake, 5*time.Millisecond); err != down {
+		t.Fatalf("got %v, want last ping error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("PingWait did not stop at deadline, took %v", elapsed)
+	}
+}
+
+func TestPingDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// Simulate a driver stuck dialing a black-hole address that does not
+	// watch the context.
+	stuck := make(chan struct{})
+	defer close(stuck)
+	fake := rdbtest.New()
+	fake.PingFunc = func(context.Context) error {
+		<-stuck
+		return nil
+	}
+	pool, err := rdb.Open(context.Background(), fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if err := pool.Ping(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("Ping returned after %v, deadline was 200ms", elapsed)
+	}
+}
+
+func TestOpenRetry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	fake := rdbtest.New()
+	attempts := 0
+	fake.OpenFunc = func() error {
+		attempts++
+		if attempts <= 2 {
+			return refused
+		}
+		return nil
+	}
+	conf := fake.Config()
+	conf.OpenRetry = rdb.OpenRetry{Attempts: 5, Interval: time.Millisecond}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Close()
+	if attempts != 3 {
+		t.Fatalf("got %d attempts, want 3", attempts)
+	}
+
+	// The last error is returned once the attempts are used.
+	attempts = 0
+	conf.OpenRetry.Attempts = 2
+	if _, err := rdb.Open(ctx, conf); err != refused {
+		t.Fatalf("got %v, want last open error", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("got %d attempts, want 2", attempts)
+	}
+}
+
+func TestOpenRetryBackoff(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	fake := rdbtest.New()
+	var opened []time.Time
+	fake.OpenFunc = func() error {
+		opened = append(opened, time.Now())
+		if len(opened) <= 2 {
+			return refused
+		}
+		return nil
+	}
+	conf := fake.Config()
+	conf.OpenRetry = rdb.OpenRetry{Attempts: 5}
+	conf.ReconnectBackoff = rdb.Backoff{Initial: 20 * time.Millisecond, Factor: 2}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Close()
+	if len(opened) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(opened))
+	}
+	// Each wait is shortened by up to a tenth.
+	for i, want := range []time.Duration{18 * time.Millisecond, 36 * time.Millisecond} {
+		if got := opened[i+1].Sub(opened[i]); got < want {
+			t.Errorf("attempt %d waited %v, want at least %v", i+2, got, want)
+		}
+	}
+}
+
+func TestOpenRetryFailFast(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	login := errors.New("login failed for user")
+	fake := rdbtest.New()
+	attempts := 0
+	fake.OpenFunc = func() error {
+		attempts++
+		return login
+	}
+	conf := fake.Config()
+	conf.OpenRetry = rdb.OpenRetry{Attempts: 5, Interval: time.Second}
+	if _, err := rdb.Open(ctx, conf); err != login {
+		t.Fatalf("got %v, want login error", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("got %d attempts, want 1", attempts)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OptionKind is the type a driver option in Config.KV is parsed as.
+type OptionKind byte
+
+// Option kinds.
+const (
+	OptionString   OptionKind = iota // Left as text.
+	OptionBool                       // Parsed as a bool, also "yes", "no", "on" and "off".
+	OptionInt                        // Parsed as an int.
+	OptionDuration                   // Parsed as a time.Duration, a number without a unit is in seconds.
+)
+
+var (
+	optionSync = sync.RWMutex{}
+	optionList = make(map[string]map[string]OptionKind)
+)
+
+// RegisterOption declares the kind of a driver option. ParseConfigURL and
+// ParseConfigDSN store the value of a registered option in Config.KV as a
+// bool, int or time.Duration rather then text, and fail if the value
+// cannot be parsed. Names are not case sensitive. Drivers should call this
+// when they register their opener.
+func RegisterOption(driver, name string, kind OptionKind) {
+	optionSync.Lock()
+	defer optionSync.Unlock()
+
+	list := optionList[driver]
+	if list == nil {
+		list = make(map[string]OptionKind)
+		optionList[driver] = list
+	}
+	list[strings.ToLower(name)] = kind
+}
+
+// parseOptions replaces the text values in KV of the options registered
+// for the driver with their parsed value.
+func (c *Config) parseOptions() error {
+	optionSync.RLock()
+	list := optionList[c.DriverName]
+	optionSync.RUnlock()
+	if len(list) == 0 {
+		return nil
+	}
+	for key, value := range c.KV {
+		kind, found := list[strings.ToLower(key)]
+		if !found || kind == OptionString {
+			continue
+		}
+		text, ok := optionText(value)
+		if !ok {
+			continue
+		}
+		v, err := parseOption(kind, text)
+		if err != nil {
+			return fmt.Errorf("rdb: invalid value for option %q: %v", key, err)
+		}
+		c.KV[key] = v
+	}
+	return nil
+}
+
+// optionText returns the text of a KV value, the first value if it is
+// from a URL query.
+func optionText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []string:
+		if len(v) != 0 {
+			return v[0], true
+		}
+	}
+	return "", false
+}
+
+func parseOption(kind OptionKind, text string) (interface{}, error) {
+	switch kind {
+	case OptionBool:
+		return parseDSNBool(text)
+	case OptionInt:
+		return strconv.Atoi(text)
+	case OptionDuration:
+		if sec, err := strconv.Atoi(text); err == nil {
+			return time.Duration(sec) * time.Second, nil
+		}
+		return time.ParseDuration(text)
+	}
+	return text, nil
+}
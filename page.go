@@ -0,0 +1,192 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// PageMarker may be placed in the SQL passed to Page to end the part of
+// the command that is counted, such as before an "order by" clause that is
+// not allowed in a sub-query. It is removed from the page query.
+const PageMarker = "{{count}}"
+
+// Pager may be implemented by a driver Pool to provide the clause that
+// limits a query to a page of rows.
+type Pager interface {
+	PageClause(offset, limit int) string
+}
+
+var errPage = errors.New("rdb: page must be at least 1 and size at least 1")
+
+// Page returns a page of rows from the command and the total number of
+// rows the command returns. Page numbers start at 1.
+//
+// The page is read by appending the driver's paging clause to the SQL,
+// "LIMIT size OFFSET offset" if the driver does not implement Pager.
+// The total is read by wrapping the SQL in "select count(*)". If the
+// SQL contains PageMarker only the SQL before it is counted.
+func Page(ctx context.Context, q Queryer, cmd *Command, page, size int, params ...Param) (rows Buffer, total int64, err error) {
+	if page < 1 || size < 1 {
+		return rows, 0, errPage
+	}
+	sql := strings.TrimRight(strings.TrimSpace(cmd.SQL), ";")
+	countSQL := sql
+	if at := strings.Index(sql, PageMarker); at >= 0 {
+		countSQL = sql[:at]
+		sql = appendSQL(strings.TrimSpace(sql[:at]), strings.TrimSpace(sql[at+len(PageMarker):]))
+	}
+	offset := (page - 1) * size
+
+	var clause string
+	if pager, ok := driverOf(q).(Pager); ok {
+		clause = pager.PageClause(offset, size)
+	} else {
+		clause = fmt.Sprintf("LIMIT %d OFFSET %d", size, offset)
+	}
+
+	pageCmd := *cmd
+	pageCmd.SQL = appendSQL(strings.TrimSpace(sql), clause) + ";"
+	b, err := queryBuffer(ctx, q, &pageCmd, params)
+	if err != nil {
+		return rows, 0, err
+	}
+	if b != nil {
+		rows = *b
+	}
+
+	countCmd := *cmd
+	countCmd.ColumnMap = nil
+	countCmd.Converter = nil
+	alias, _ := QuoteIdentifier(q, "page_count")
+	countCmd.SQL = "select count(*) from (" + strings.TrimSpace(countSQL) + ") as " + alias + ";"
+	cb, err := queryBuffer(ctx, q, &countCmd, params)
+	if err != nil {
+		return rows, 0, err
+	}
+	if cb == nil || len(cb.Row) != 1 || len(cb.Schema) != 1 {
+		return rows, 0, errors.New("rdb: page count query did not return a single value")
+	}
+	if err := assign(&total, cb.Row[0].Getx(0), false); err != nil {
+		return rows, 0, err
+	}
+	return rows, total, nil
+}
+
+// queryBuffer reads the results of the command and closes the query.
+func queryBuffer(ctx context.Context, q Queryer, cmd *Command, params []Param) (*Buffer, error) {
+	next := q.Query(ctx, cmd, params...)
+	defer next.Close()
+	return next.Buffer()
+}
+
+var errKeyset = errors.New("rdb: keyset needs order columns, a limit of at least 1 and a value for each column after the first page")
+
+// Keyset returns the page of at most limit rows of the base command that
+// follow the row with the after values of the order columns, and the
+// values of the order columns of its last row to pass as after for the
+// next page. A nil after reads the first page. The returned cursor is nil
+// when the page has no rows.
+//
+// The base SQL must not be ordered or limited. It is read as a sub-query
+// filtered with "a > ? or (a = ? and b > ?)" for the order columns a, b,
+// ordered by them and limited with the paging clause of the driver, see
+// Pager. The order columns are named as in the base SQL and quoted with
+// QuoteIdentifier. They must be in the result and together unique; the
+// cursor is read from the columns renamed by the base ColumnMap.
+func Keyset(ctx context.Context, q Queryer, base *Command, orderCols []string, after []interface{}, limit int, params ...Param) (Buffer, []interface{}, error) {
+	var rows Buffer
+	if len(orderCols) == 0 || limit < 1 || (after != nil && len(after) != len(orderCols)) {
+		return rows, nil, errKeyset
+	}
+	cols := make([]string, len(orderCols))
+	for i, col := range orderCols {
+		quoted, err := QuoteIdentifier(q, col)
+		if err != nil {
+			return rows, nil, err
+		}
+		cols[i] = quoted
+	}
+	var clause string
+	if pager, ok := driverOf(q).(Pager); ok {
+		clause = pager.PageClause(0, limit)
+	} else {
+		clause = fmt.Sprintf("LIMIT %d", limit)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("select * from (")
+	buf.WriteString(strings.TrimRight(strings.TrimSpace(base.SQL), ";"))
+	alias, _ := QuoteIdentifier(q, "keyset_page")
+	buf.WriteString(") as ")
+	buf.WriteString(alias)
+	if after != nil {
+		params = append([]Param(nil), params...)
+		buf.WriteString(" where ")
+		if len(orderCols) > 1 {
+			buf.WriteByte('(')
+		}
+		for i, col := range cols {
+			if i > 0 {
+				buf.WriteString(" or (")
+			}
+			for j := 0; j < i; j++ {
+				fmt.Fprintf(buf, "%s = ? and ", cols[j])
+				params = append(params, Param{Value: after[j]})
+			}
+			fmt.Fprintf(buf, "%s > ?", col)
+			params = append(params, Param{Value: after[i]})
+			if i > 0 {
+				buf.WriteByte(')')
+			}
+		}
+		if len(orderCols) > 1 {
+			buf.WriteByte(')')
+		}
+	}
+	buf.WriteString(" order by ")
+	buf.WriteString(strings.Join(cols, ", "))
+	buf.WriteByte(' ')
+	buf.WriteString(clause)
+	buf.WriteByte(';')
+
+	cmd := *base
+	cmd.SQL = buf.String()
+	b, err := queryBuffer(ctx, q, &cmd, params)
+	if err != nil {
+		return rows, nil, err
+	}
+	if b == nil || len(b.Row) == 0 {
+		if b != nil {
+			rows = *b
+		}
+		return rows, nil, nil
+	}
+	rows = *b
+	last := rows.Row[len(rows.Row)-1]
+	cursor := make([]interface{}, len(orderCols))
+	for i, col := range orderCols {
+		if name, ok := base.ColumnMap[col]; ok {
+			col = name
+		}
+		index := -1
+		for _, c := range rows.Schema {
+			if c.Name == col {
+				index = c.Index
+				break
+			}
+		}
+		if index < 0 {
+			return rows, nil, fmt.Errorf("rdb: keyset order column %q not in result", col)
+		}
+		cursor[i] = last.Getx(index)
+	}
+	return rows, cursor, nil
+}
@@ -0,0 +1,232 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestPage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID from Account where Active = ? order by ID LIMIT 2 OFFSET 2;").Returns(
+		rdbtest.NewResult("ID").Row(3).Row(4),
+	)
+	fake.Expect(`select count(*) from (select ID from Account where Active = ?) as "page_count";`).Returns(
+		rdbtest.NewResult("").Row(int64(5)),
+	)
+
+	cmd := &rdb.Command{SQL: "select ID from Account where Active = ? " + rdb.PageMarker + " order by ID;"}
+	rows, total, err := rdb.Page(ctx, fake, cmd, 2, 2, rdb.Param{Value: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows.Row) != 2 || rows.Row[0].Get("ID") != 3 || rows.Row[1].Get("ID") != 4 {
+		t.Fatalf("unexpected page rows %+v", rows.Row)
+	}
+	if total != 5 {
+		t.Fatalf("got total %d, want 5", total)
+	}
+	for _, c := range fake.Calls() {
+		if len(c.Params) != 1 || c.Params[0].Value != true {
+			t.Fatalf("%q got params %+v", c.SQL, c.Params)
+		}
+	}
+	if err := fake.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := rdb.Page(ctx, fake, cmd, 0, 2); err == nil {
+		t.Fatal("expected error for page 0")
+	}
+}
+
+func TestPageClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID from Account LIMIT 2 OFFSET 0;").Returns(rdbtest.NewResult("ID").Row(1))
+	fake.Expect(`select count(*) from (select ID from Account) as "page_count";`).Returns(
+		rdbtest.NewResult("").Row(int64(1)),
+	)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	capacity := fake.Status().Available()
+	cmd := &rdb.Command{
+		SQL:       "select ID from Account;",
+		Converter: func(col rdb.Column, v interface{}) (interface{}, error) { return v, nil },
+	}
+	if _, _, err := rdb.Page(ctx, pool, cmd, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.Status().Available(); got != capacity {
+		t.Fatalf("got %d available after page, want %d", got, capacity)
+	}
+}
+
+type offsetFetchPool struct {
+	*rdbtest.Pool
+}
+
+func (offsetFetchPool) PageClause(offset, limit int) string {
+	return fmt.Sprintf("OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", offset, limit)
+}
+
+func TestPageDriverClause(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID from Account order by ID OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY;")
+	fake.Expect(`select count(*) from (select ID from Account order by ID) as "page_count";`).Returns(
+		rdbtest.NewResult("").Row(int32(0)),
+	)
+	rows, total, err := rdb.Page(ctx, offsetFetchPool{fake}, &rdb.Command{SQL: "select ID from Account order by ID"}, 3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows.Row) != 0 || total != 0 {
+		t.Fatalf("got %d rows, total %d", len(rows.Row), total)
+	}
+}
+
+// keysetTable is a Queryer over rows of (Day, ID) sorted by both that
+// answers the queries of Keyset.
+type keysetTable struct {
+	rows  [][2]int64
+	limit int
+	sql   []string
+}
+
+func (kt *keysetTable) Query(ctx context.Context, cmd *rdb.Command, params ...rdb.Param) rdb.Next {
+	kt.sql = append(kt.sql, cmd.SQL)
+	rs := rdbtest.NewResult("Day", "ID")
+	for _, row := range kt.rows {
+		if len(params) == 3 {
+			day, id := params[0].Value.(int64), params[2].Value.(int64)
+			if params[1].Value != day || !(row[0] > day || (row[0] == day && row[1] > id)) {
+				continue
+			}
+		}
+		if len(rs.Rows) == kt.limit {
+			break
+		}
+		rs.Row(row[0], row[1])
+	}
+	fake := rdbtest.New()
+	fake.Expect(cmd.SQL).Returns(rs)
+	return fake.Query(ctx, cmd, params...)
+}
+
+func TestKeyset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kt := &keysetTable{limit: 3}
+	for day := int64(1); day <= 4; day++ {
+		for id := int64(1); id <= day; id++ {
+			kt.rows = append(kt.rows, [2]int64{day, id})
+		}
+	}
+	base := &rdb.Command{SQL: "select Day, ID from Visit;"}
+	order := []string{"Day", "ID"}
+
+	var got [][2]int64
+	var after []interface{}
+	for page := 0; ; page++ {
+		if page > len(kt.rows) {
+			t.Fatal("paging did not end")
+		}
+		rows, cursor, err := rdb.Keyset(ctx, kt, base, order, after, kt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cursor == nil {
+			break
+		}
+		for _, row := range rows.Row {
+			got = append(got, [2]int64{row.Get("Day").(int64), row.Get("ID").(int64)})
+		}
+		after = cursor
+	}
+	if fmt.Sprint(got) != fmt.Sprint(kt.rows) {
+		t.Fatalf("got rows %v, want %v", got, kt.rows)
+	}
+
+	want := []string{
+		`select * from (select Day, ID from Visit) as "keyset_page" order by "Day", "ID" LIMIT 3;`,
+		`select * from (select Day, ID from Visit) as "keyset_page" where ("Day" > ? or ("Day" = ? and "ID" > ?)) order by "Day", "ID" LIMIT 3;`,
+	}
+	if kt.sql[0] != want[0] || kt.sql[1] != want[1] {
+		t.Fatalf("got SQL %q, want %q", kt.sql[:2], want)
+	}
+
+	if _, _, err := rdb.Keyset(ctx, kt, base, order, []interface{}{int64(1)}, 3); err == nil {
+		t.Fatal("expected error for a cursor without a value for each column")
+	}
+	if _, _, err := rdb.Keyset(ctx, kt, base, []string{"Missing"}, nil, 3); err == nil {
+		t.Fatal("expected error for an order column not in the result")
+	}
+}
+
+func TestKeysetClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect(`select * from (select ID from Account) as "keyset_page" order by "ID" LIMIT 2;`).Returns(
+		rdbtest.NewResult("ID").Row(int64(1)),
+	)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	capacity := fake.Status().Available()
+	if _, _, err := rdb.Keyset(ctx, pool, &rdb.Command{SQL: "select ID from Account;"}, []string{"ID"}, nil, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.Status().Available(); got != capacity {
+		t.Fatalf("got %d available after keyset, want %d", got, capacity)
+	}
+}
+
+func TestKeysetColumnMap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Quote = rdb.QuoteBracket
+	fake.Expect("select * from (select ID from Account) as [keyset_page] order by [ID] LIMIT 2;").Returns(
+		rdbtest.NewResult("ID").Row(int64(1)).Row(int64(2)),
+	)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	base := &rdb.Command{SQL: "select ID from Account;", ColumnMap: map[string]string{"ID": "AccountID"}}
+	rows, cursor, err := rdb.Keyset(ctx, pool, base, []string{"ID"}, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows.Row) != 2 || len(cursor) != 1 || cursor[0] != int64(2) {
+		t.Fatalf("got %d rows and cursor %v, want 2 rows and cursor [2]", len(rows.Row), cursor)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is returned in place of a panic recovered in a goroutine
+// started by rdb, such as a panic in a driver while streaming rows.
+type PanicError struct {
+	Value interface{} // Value passed to panic.
+	Stack []byte      // Stack of the goroutine that panicked.
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("rdb: panic: %v\n%s", err.Value, err.Stack)
+}
+
+// GoSafe runs fn in a new goroutine. The error returned by fn, or a
+// *PanicError if fn panics, is sent on errc if errc is not nil. If fn
+// panics cancel is called, if not nil, so callers waiting on the context
+// are released. Drivers may use it for the goroutines they start.
+func GoSafe(cancel func(), errc chan<- error, fn func() error) {
+	go func() {
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+				if cancel != nil {
+					cancel()
+				}
+			}
+			if errc != nil {
+				errc <- err
+			}
+		}()
+		err = fn()
+	}()
+}
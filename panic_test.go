@@ -0,0 +1,55 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestGoSafePanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errc := make(chan error, 1)
+	GoSafe(cancel, errc, func() error {
+		var p Pool
+		p.Status() // Nil driver.
+		return nil
+	})
+	err := <-errc
+	pe, is := err.(*PanicError)
+	if !is {
+		t.Fatalf("got %v, want *PanicError", err)
+	}
+	if !strings.Contains(string(pe.Stack), "TestGoSafePanic") {
+		t.Errorf("stack does not include the panicking function:\n%s", pe.Stack)
+	}
+	select {
+	case <-ctx.Done():
+	default:
+		t.Fatal("context not canceled after panic")
+	}
+}
+
+func TestGoSafeError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	want := errors.New("done")
+	errc := make(chan error, 1)
+	GoSafe(cancel, errc, func() error {
+		return want
+	})
+	if err := <-errc; err != want {
+		t.Fatalf("got %v, want %v", err, want)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("context canceled without a panic")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import "sync"
+
+// ParamSet is a reusable list of parameters for queries run in a loop.
+//
+// The slice returned from Params is reused by the next Reset and Add.
+// A query must be closed before the set is reset or released, and the
+// slice must not be retained after that.
+//
+//	set := rdb.NewParamSet()
+//	defer set.Release()
+//	for _, id := range ids {
+//		set.Reset()
+//		set.Add(rdb.Param{Name: "id", Value: id})
+//		err := pool.Query(ctx, cmd, set.Params()...).Close()
+//		...
+//	}
+type ParamSet struct {
+	list []Param
+}
+
+var paramSetPool = sync.Pool{
+	New: func() interface{} {
+		return &ParamSet{list: make([]Param, 0, 8)}
+	},
+}
+
+// NewParamSet returns an empty set taken from a shared pool. Call Release
+// when the set is no longer used.
+func NewParamSet() *ParamSet {
+	return paramSetPool.Get().(*ParamSet)
+}
+
+// Add appends the parameter to the set.
+func (s *ParamSet) Add(p Param) *ParamSet {
+	s.list = append(s.list, p)
+	return s
+}
+
+// Reset empties the set and keeps the storage for reuse.
+func (s *ParamSet) Reset() {
+	for i := range s.list {
+		s.list[i] = Param{}
+	}
+	s.list = s.list[:0]
+}
+
+// Params returns the parameters to pass to a query as params...
+func (s *ParamSet) Params() []Param {
+	return s.list
+}
+
+// Len returns the number of parameters in the set.
+func (s *ParamSet) Len() int {
+	return len(s.list)
+}
+
+// Release returns the set to the shared pool. The set and any slice
+// returned from Params must not be used after Release.
+func (s *ParamSet) Release() {
+	s.Reset()
+	paramSetPool.Put(s)
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+const accountByID = "select Name from Account where ID = ? and Kind = ?;"
+
+func TestParamSetReuse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect(accountByID)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	set := rdb.NewParamSet()
+	defer set.Release()
+	cmd := &rdb.Command{SQL: accountByID}
+	for i := 0; i < 3; i++ {
+		set.Reset()
+		set.Add(rdb.Param{Value: i})
+		if i != 1 {
+			set.Add(rdb.Param{Value: "user"})
+		} else {
+			set.Add(rdb.Param{Value: "admin"})
+		}
+		if err := pool.Query(ctx, cmd, set.Params()...).Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if set.Len() != 2 {
+		t.Errorf("got %d params, want 2", set.Len())
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("got %d calls, want 3", len(calls))
+	}
+	kinds := []string{"user", "admin", "user"}
+	for i, c := range calls {
+		if len(c.Params) != 2 || c.Params[0].Value != i || c.Params[1].Value != kinds[i] {
+			t.Errorf("call %d got params %+v", i, c.Params)
+		}
+	}
+}
+
+// sink keeps the benchmark from optimizing the parameters away.
+var sink []rdb.Param
+
+func BenchmarkParamSlice(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		params := make([]rdb.Param, 0, 2)
+		params = append(params, rdb.Param{Name: "id", Value: i}, rdb.Param{Name: "kind", Value: "user"})
+		sink = params
+	}
+}
+
+func BenchmarkParamSet(b *testing.B) {
+	set := rdb.NewParamSet()
+	defer set.Release()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		set.Reset()
+		set.Add(rdb.Param{Name: "id", Value: i}).Add(rdb.Param{Name: "kind", Value: "user"})
+		sink = set.Params()
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+// Peek reads the first row of the next result of next and returns it with
+// the result. The remaining rows may be streamed with Scan or buffered with
+// BufferRemaining. The row is nil if the result has no rows, and both are
+// nil if there is no next result.
+func Peek(next Next) (Row, Result, error) {
+	res, err := next.Result()
+	if res == nil || err != nil {
+		return nil, res, err
+	}
+	row, err := res.Scan()
+	if err != nil {
+		return nil, res, err
+	}
+	return row, res, nil
+}
+
+// BufferRemaining reads the rows of res not yet scanned into a Buffer.
+// Rows already scanned are not included. The result is not closed so a
+// later result of the query may still be read.
+func BufferRemaining(res Result) (*Buffer, error) {
+	b := &Buffer{Schema: res.Schema()}
+	for {
+		row, err := res.Scan()
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			return b, nil
+		}
+		b.Row = append(b.Row, row)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func openPeek(t *testing.T, ctx context.Context) (rdb.Pool, *rdb.Command) {
+	fake := rdbtest.New()
+	fake.Expect("select ID from Account;").Returns(rdbtest.NewResult("ID").Row(1).Row(2).Row(3))
+	fake.Expect("select ID from Account where 1=0;").Returns(rdbtest.NewResult("ID"))
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool, &rdb.Command{SQL: "select ID from Account;"}
+}
+
+func TestPeekStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool, cmd := openPeek(t, ctx)
+	defer pool.Close()
+	row, res, err := rdb.Peek(pool.Query(ctx, cmd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if row == nil || row.Get("ID") != 1 {
+		t.Fatalf("got first row %v", row)
+	}
+	var ids []interface{}
+	for {
+		row, err := res.Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row == nil {
+			break
+		}
+		ids = append(ids, row.Get("ID"))
+	}
+	if len(ids) != 2 || ids[0] != 2 || ids[1] != 3 {
+		t.Fatalf("got streamed %v", ids)
+	}
+}
+
+func TestPeekBuffer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool, cmd := openPeek(t, ctx)
+	defer pool.Close()
+	row, res, err := rdb.Peek(pool.Query(ctx, cmd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if row == nil || row.Get("ID") != 1 {
+		t.Fatalf("got first row %v", row)
+	}
+	b, err := rdb.BufferRemaining(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Schema) != 1 || len(b.Row) != 2 || b.Row[0].Get("ID") != 2 || b.Row[1].Get("ID") != 3 {
+		t.Fatalf("got buffer %+v", b)
+	}
+
+	row, res, err = rdb.Peek(pool.Query(ctx, &rdb.Command{SQL: "select ID from Account where 1=0;"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if row != nil {
+		t.Fatalf("got row %v from empty result", row)
+	}
+	if b, err := rdb.BufferRemaining(res); err != nil || len(b.Row) != 0 {
+		t.Fatalf("got buffer %+v, error %v", b, err)
+	}
+}
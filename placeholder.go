@@ -0,0 +1,377 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// PlaceholderStyle is the parameter placeholder syntax a driver expects.
+//
+// Command SQL may be written with "?" positional placeholders and "@name" or
+// ":name" named placeholders. Before the command is sent the SQL is
+// rewritten to the style of the driver and the parameters are ordered to
+// match. Placeholders inside string literals, quoted identifiers and
+// comments are left alone.
+type PlaceholderStyle byte
+
+// Placeholder styles declared by drivers.
+const (
+	PlaceholderQuestion PlaceholderStyle = iota // Positional "?", named references repeat the value.
+	PlaceholderDollar                           // Numbered "$1", named references share a number.
+	PlaceholderAtP                              // Named "@p1" or "@name".
+	PlaceholderColon                            // Named ":p1" or ":name".
+)
+
+// PlaceholderStyler may be implemented by a driver Pool to declare the
+// placeholder style it expects. Pools that do not implement it are assumed
+// to use PlaceholderQuestion.
+type PlaceholderStyler interface {
+	PlaceholderStyle() PlaceholderStyle
+}
+
+// NamedParamSupporter may be implemented by a driver Pool to declare if it
+// can bind parameters by name. Pools that do not implement it are assumed to
+// support named parameters if the placeholder style is named.
+type NamedParamSupporter interface {
+	NamedParams() bool
+}
+
+// native returns true if the style binds parameters by name.
+func (style PlaceholderStyle) native() bool {
+	return style == PlaceholderAtP || style == PlaceholderColon
+}
+
+// Rewrite returns a copy of cmd with the SQL in the placeholder style along
+// with the parameters ordered to match.
+func (style PlaceholderStyle) Rewrite(cmd *Command, params []Param) (*Command, []Param, error) {
+	return style.rewrite(cmd, params, false)
+}
+
+// RewritePositional is like Rewrite but every named reference is replaced
+// with a positional placeholder for drivers that cannot bind by name.
+// A name referenced more then once shares a number in numbered styles and
+// has its value repeated for "?".
+func (style PlaceholderStyle) RewritePositional(cmd *Command, params []Param) (*Command, []Param, error) {
+	return style.rewrite(cmd, params, true)
+}
+
+func (style PlaceholderStyle) rewrite(cmd *Command, params []Param, positional bool) (*Command, []Param, error) {
+	plan := style.plan(cmd.SQL, positional)
+	plan.unbound = cmd.AllowUnboundNames
+	ordered, err := plan.order(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := *cmd
+	out.SQL = plan.sql
+	return &out, ordered, nil
+}
+
+type placeholderRef struct {
+	name  string // Named reference, empty if positional.
+	index int    // Index of the positional reference.
+	bind  string // Name the parameter is bound as in native styles.
+}
+
+type placeholderPlan struct {
+	style      PlaceholderStyle
+	positional bool // Bind by position even in a named style.
+	sql        string
+	refs       []placeholderRef // Parameters in the order they are sent.
+	named      bool             // SQL contains named references.
+	args       int              // Number of "?" placeholders in the SQL.
+	unbound    bool             // Leave names without a parameter to the server.
+}
+
+// ArityError is returned when the parameters do not match the placeholders
+// in the command SQL.
+type ArityError struct {
+	Want int // Number of "?" placeholders.
+	Got  int // Number of unnamed parameters.
+
+	// Name of a named placeholder without a parameter, if any.
+	Name string
+}
+
+func (err *ArityError) Error() string {
+	if len(err.Name) != 0 {
+		return fmt.Sprintf("rdb: missing parameter %q", err.Name)
+	}
+	return fmt.Sprintf("rdb: command has %d positional placeholders but %d parameters were given", err.Want, err.Got)
+}
+
+// DuplicateParamError is returned when more then one parameter has the
+// same name, unless Command.AllowDuplicateParams is set.
+type DuplicateParamError struct {
+	Name string
+}
+
+func (err *DuplicateParamError) Error() string {
+	return fmt.Sprintf("rdb: duplicate parameter %q", err.Name)
+}
+
+// uniqueParams returns a *DuplicateParamError if two parameters share a
+// name. If allow is true the last parameter with the name is used and the
+// others are removed.
+func uniqueParams(params []Param, allow bool) ([]Param, error) {
+	var seen map[string]int
+	dup := false
+	for i, p := range params {
+		name := trimParamName(p.Name)
+		if len(name) == 0 {
+			continue
+		}
+		if seen == nil {
+			seen = make(map[string]int, len(params))
+		}
+		if _, found := seen[name]; found {
+			if !allow {
+				return nil, &DuplicateParamError{Name: name}
+			}
+			dup = true
+		}
+		seen[name] = i
+	}
+	if !dup {
+		return params, nil
+	}
+	out := make([]Param, 0, len(seen))
+	for i, p := range params {
+		if name := trimParamName(p.Name); len(name) == 0 || seen[name] == i {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// checkArgs returns an *ArityError if the number of unnamed parameters
+// does not match the placeholders of the SQL.
+func checkArgs(sql string, params []Param) error {
+	args := 0
+	scanPlaceholders(sql, PlaceholderQuestion, func(start, end int, name string) {
+		if len(name) == 0 {
+			args++
+		}
+	})
+	if args != len(params) {
+		return &ArityError{Want: args, Got: len(params)}
+	}
+	return nil
+}
+
+// byName returns true if parameters are bound by name.
+func (plan *placeholderPlan) byName() bool {
+	return plan.style.native() && !plan.positional
+}
+
+// plan rewrites the SQL and records the parameters the result refers to.
+func (style PlaceholderStyle) plan(sql string, positional bool) *placeholderPlan {
+	plan := &placeholderPlan{style: style, positional: positional}
+	buf := &bytes.Buffer{}
+	numbered := make(map[string]int)
+	positionalCount := 0
+	last := 0
+
+	var prefix string
+	switch style {
+	case PlaceholderDollar:
+		prefix = "$"
+	case PlaceholderAtP:
+		prefix = "@"
+	case PlaceholderColon:
+		prefix = ":"
+	}
+
+	scanPlaceholders(sql, style, func(start, end int, name string) {
+		buf.WriteString(sql[last:start])
+		last = end
+
+		ref := placeholderRef{name: name}
+		if len(name) == 0 {
+			ref.index = positionalCount
+			positionalCount++
+			ref.bind = "p" + strconv.Itoa(positionalCount)
+		} else {
+			plan.named = true
+			ref.bind = name
+		}
+
+		switch {
+		case style == PlaceholderQuestion:
+			buf.WriteRune('?')
+			plan.refs = append(plan.refs, ref)
+		case plan.byName():
+			buf.WriteString(prefix)
+			buf.WriteString(ref.bind)
+			if _, found := numbered[ref.bind]; !found {
+				numbered[ref.bind] = len(plan.refs)
+				plan.refs = append(plan.refs, ref)
+			}
+		default:
+			n, found := numbered[name]
+			if !found || len(name) == 0 {
+				plan.refs = append(plan.refs, ref)
+				n = len(plan.refs)
+				if len(name) != 0 {
+					numbered[name] = n
+				}
+			}
+			buf.WriteString(prefix)
+			if style == PlaceholderAtP {
+				buf.WriteRune('p')
+			}
+			buf.WriteString(strconv.Itoa(n))
+		}
+	})
+	buf.WriteString(sql[last:])
+	plan.sql = buf.String()
+	plan.args = positionalCount
+	return plan
+}
+
+// order returns the parameters in the order the rewritten SQL expects.
+// An *ArityError is returned if the unnamed parameters do not match the
+// "?" placeholders, parameters are given for SQL without placeholders, or
+// a named placeholder has no parameter. With Command.AllowUnboundNames a
+// name without a parameter in a named style is left for the server to
+// resolve, as it may be a variable declared in the SQL.
+func (plan *placeholderPlan) order(params []Param) ([]Param, error) {
+	if len(plan.refs) == 0 {
+		if len(params) != 0 {
+			return nil, &ArityError{Want: 0, Got: len(params)}
+		}
+		return params, nil
+	}
+	var positional []Param
+	named := make(map[string]Param)
+	for _, p := range params {
+		if len(p.Name) == 0 {
+			positional = append(positional, p)
+			continue
+		}
+		named[trimParamName(p.Name)] = p
+	}
+	if len(positional) != plan.args {
+		return nil, &ArityError{Want: plan.args, Got: len(positional)}
+	}
+
+	out := make([]Param, 0, len(plan.refs))
+	for _, ref := range plan.refs {
+		var p Param
+		if len(ref.name) == 0 {
+			p = positional[ref.index]
+		} else {
+			var found bool
+			p, found = named[ref.name]
+			if !found {
+				if plan.byName() && plan.unbound {
+					// Let the server resolve the name, it may be a variable.
+					continue
+				}
+				return nil, &ArityError{Want: plan.args, Got: len(positional), Name: ref.name}
+			}
+		}
+		if plan.byName() {
+			p.Name = ref.bind
+		} else {
+			p.Name = ""
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func trimParamName(name string) string {
+	if len(name) > 0 && (name[0] == '@' || name[0] == ':') {
+		return name[1:]
+	}
+	return name
+}
+
+// scanPlaceholders calls fn for each placeholder in the SQL outside of
+// literals, quoted identifiers and comments. In PlaceholderDollar style
+// dollar-quoted bodies such as $$ ... $$ are also skipped. Name is empty
+// for "?".
+func scanPlaceholders(sql string, style PlaceholderStyle, fn func(start, end int, name string)) {
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; c {
+		case '$':
+			if style == PlaceholderDollar {
+				i = skipDollarQuoted(sql, i)
+			}
+		case '\'', '"', '`':
+			i = skipQuoted(sql, i, c)
+		case '-':
+			if i+1 < len(sql) && sql[i+1] == '-' {
+				i = skipLine(sql, i)
+			}
+		case '/':
+			if i+1 < len(sql) && sql[i+1] == '*' {
+				i = skipBlockComment(sql, i)
+			}
+		case '?':
+			fn(i, i+1, "")
+		case '@', ':':
+			// Skip "@@global" variables and "::type" casts.
+			if i > 0 && sql[i-1] == c {
+				continue
+			}
+			end := i + 1
+			if end >= len(sql) || !isIdentStart(sql[end]) {
+				continue
+			}
+			for end < len(sql) && isIdentPart(sql[end]) {
+				end++
+			}
+			fn(i, end, sql[i+1:end])
+			i = end - 1
+		}
+	}
+}
+
+// skipQuoted returns the index of the closing quote. Doubled quotes are
+// treated as an escaped quote.
+func skipQuoted(sql string, i int, quote byte) int {
+	for i++; i < len(sql); i++ {
+		if sql[i] != quote {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == quote {
+			i++
+			continue
+		}
+		return i
+	}
+	return len(sql)
+}
+
+func skipLine(sql string, i int) int {
+	for ; i < len(sql); i++ {
+		if sql[i] == '\n' {
+			return i
+		}
+	}
+	return len(sql)
+}
+
+func skipBlockComment(sql string, i int) int {
+	for i += 2; i+1 < len(sql); i++ {
+		if sql[i] == '*' && sql[i+1] == '/' {
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
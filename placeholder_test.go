@@ -0,0 +1,402 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestPlaceholderRewrite(t *testing.T) {
+	const sql = `select * from T where A = ? and B = @id and C = '?' -- ?
+and D = ? and E = :id and F::text = @@rowcount /* ? */;`
+	params := []rdb.Param{
+		{Value: "a"},
+		{Name: "id", Value: 7},
+		{Value: "d"},
+	}
+	list := []struct {
+		style  rdb.PlaceholderStyle
+		sql    string
+		names  []string
+		values []interface{}
+	}{
+		{
+			style: rdb.PlaceholderQuestion,
+			sql: `select * from T where A = ? and B = ? and C = '?' -- ?
+and D = ? and E = ? and F::text = @@rowcount /* ? */;`,
+			names:  []string{"", "", "", ""},
+			values: []interface{}{"a", 7, "d", 7},
+		},
+		{
+			style: rdb.PlaceholderDollar,
+			sql: `select * from T where A = $1 and B = $2 and C = '?' -- ?
+and D = $3 and E = $2 and F::text = @@rowcount /* ? */;`,
+			names:  []string{"", "", ""},
+			values: []interface{}{"a", 7, "d"},
+		},
+		{
+			style: rdb.PlaceholderAtP,
+			sql: `select * from T where A = @p1 and B = @id and C = '?' -- ?
+and D = @p2 and E = @id and F::text = @@rowcount /* ? */;`,
+			names:  []string{"p1", "id", "p2"},
+			values: []interface{}{"a", 7, "d"},
+		},
+		{
+			style: rdb.PlaceholderColon,
+			sql: `select * from T where A = :p1 and B = :id and C = '?' -- ?
+and D = :p2 and E = :id and F::text = @@rowcount /* ? */;`,
+			names:  []string{"p1", "id", "p2"},
+			values: []interface{}{"a", 7, "d"},
+		},
+	}
+	for _, item := range list {
+		cmd, ordered, err := item.style.Rewrite(&rdb.Command{SQL: sql}, params)
+		if err != nil {
+			t.Errorf("style %d: %v", item.style, err)
+			continue
+		}
+		if cmd.SQL != item.sql {
+			t.Errorf("style %d: got SQL\n%s\nwant\n%s", item.style, cmd.SQL, item.sql)
+		}
+		if len(ordered) != len(item.values) {
+			t.Errorf("style %d: got %d params, want %d", item.style, len(ordered), len(item.values))
+			continue
+		}
+		for i, p := range ordered {
+			if p.Name != item.names[i] || p.Value != item.values[i] {
+				t.Errorf("style %d: param %d got %s=%v, want %s=%v", item.style, i, p.Name, p.Value, item.names[i], item.values[i])
+			}
+		}
+	}
+}
+
+func TestPlaceholderQuotedLiteral(t *testing.T) {
+	cmd, params, err := rdb.PlaceholderDollar.Rewrite(&rdb.Command{SQL: `select 'it''s ?', "col?" from T where A = ?;`}, []rdb.Param{{Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `select 'it''s ?', "col?" from T where A = $1;`; cmd.SQL != want {
+		t.Fatalf("got %s, want %s", cmd.SQL, want)
+	}
+	if len(params) != 1 {
+		t.Fatalf("got %d params", len(params))
+	}
+}
+
+func TestPlaceholderDollarQuoted(t *testing.T) {
+	const sql = "do $$ begin perform x ? y; end $$; select $tag$ ? $tag$, ?;"
+	cmd, params, err := rdb.PlaceholderDollar.Rewrite(&rdb.Command{SQL: sql}, []rdb.Param{{Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "do $$ begin perform x ? y; end $$; select $tag$ ? $tag$, $1;"; cmd.SQL != want {
+		t.Fatalf("got %s, want %s", cmd.SQL, want)
+	}
+	if len(params) != 1 {
+		t.Fatalf("got %d params", len(params))
+	}
+}
+
+func TestPlaceholderMissing(t *testing.T) {
+	_, _, err := rdb.PlaceholderDollar.Rewrite(&rdb.Command{SQL: `select ?, ?;`}, []rdb.Param{{Value: 1}})
+	if err == nil {
+		t.Fatal("expected missing positional error")
+	}
+	_, _, err = rdb.PlaceholderQuestion.Rewrite(&rdb.Command{SQL: `select @a;`}, nil)
+	if err == nil {
+		t.Fatal("expected missing named error")
+	}
+}
+
+func TestPlaceholderPool(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderDollar
+	fake.Expect("select $1, $2, $1;")
+
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pool.Query(ctx, &rdb.Command{SQL: "select :a, ?, :a;"}, rdb.Param{Name: "a", Value: 1}, rdb.Param{Value: 2}).Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	calls := fake.Calls()
+	if got := calls[0].Params; len(got) != 2 || got[0].Value != 1 || got[1].Value != 2 {
+		t.Fatalf("unexpected params %+v", got)
+	}
+}
+
+func TestPlaceholderPositional(t *testing.T) {
+	const sql = `select * from T where A = @id and B = ? and C = @id and D = @name;`
+	params := []rdb.Param{
+		{Name: "name", Value: "n"},
+		{Value: "b"},
+		{Name: "@id", Value: 7},
+	}
+	list := []struct {
+		style  rdb.PlaceholderStyle
+		sql    string
+		values []interface{}
+	}{
+		{rdb.PlaceholderQuestion, `select * from T where A = ? and B = ? and C = ? and D = ?;`, []interface{}{7, "b", 7, "n"}},
+		{rdb.PlaceholderDollar, `select * from T where A = $1 and B = $2 and C = $1 and D = $3;`, []interface{}{7, "b", "n"}},
+		{rdb.PlaceholderAtP, `select * from T where A = @p1 and B = @p2 and C = @p1 and D = @p3;`, []interface{}{7, "b", "n"}},
+		{rdb.PlaceholderColon, `select * from T where A = :1 and B = :2 and C = :1 and D = :3;`, []interface{}{7, "b", "n"}},
+	}
+	for _, item := range list {
+		cmd, ordered, err := item.style.RewritePositional(&rdb.Command{SQL: sql}, params)
+		if err != nil {
+			t.Errorf("style %d: %v", item.style, err)
+			continue
+		}
+		if cmd.SQL != item.sql {
+			t.Errorf("style %d: got SQL\n%s\nwant\n%s", item.style, cmd.SQL, item.sql)
+		}
+		if len(ordered) != len(item.values) {
+			t.Errorf("style %d: got %d params, want %d", item.style, len(ordered), len(item.values))
+			continue
+		}
+		for i, p := range ordered {
+			if p.Name != "" || p.Value != item.values[i] {
+				t.Errorf("style %d: param %d got %s=%v, want %v", item.style, i, p.Name, p.Value, item.values[i])
+			}
+		}
+	}
+}
+
+func TestPlaceholderPositionalPool(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderAtP
+	fake.Positional = true
+	fake.Expect("select @p1, @p2, @p1;")
+
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pool.Query(ctx, &rdb.Command{SQL: "select @id, @other, @id;"}, rdb.Param{Name: "other", Value: 2}, rdb.Param{Name: "id", Value: 1}).Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fake.Calls()[0].Params
+	if len(got) != 2 || got[0].Value != 1 || got[1].Value != 2 || got[0].Name != "" {
+		t.Fatalf("unexpected params %+v", got)
+	}
+}
+
+func TestPlaceholderArity(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ?, ?;")
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := pool.Prepare(ctx, &rdb.Command{SQL: "select ?, ?;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := []struct {
+		name   string
+		sql    string
+		params []rdb.Param
+		want   rdb.ArityError
+	}{
+		{"too few", "select ?, ?;", []rdb.Param{{Value: 1}}, rdb.ArityError{Want: 2, Got: 1}},
+		{"too many", "select ?, ?;", []rdb.Param{{Value: 1}, {Value: 2}, {Value: 3}}, rdb.ArityError{Want: 2, Got: 3}},
+		{"missing named", "select ?, @b;", []rdb.Param{{Value: 1}, {Name: "a", Value: 2}}, rdb.ArityError{Want: 1, Got: 1, Name: "b"}},
+		{"no placeholders", "select 1;", []rdb.Param{{Value: 1}}, rdb.ArityError{Want: 0, Got: 1}},
+	}
+	for _, item := range list {
+		err := pool.Query(ctx, &rdb.Command{SQL: item.sql}, item.params...).Close()
+		ae, ok := err.(*rdb.ArityError)
+		if !ok {
+			t.Errorf("%s: got %v, want *ArityError", item.name, err)
+			continue
+		}
+		if *ae != item.want {
+			t.Errorf("%s: got %+v, want %+v", item.name, *ae, item.want)
+		}
+	}
+	if _, ok := st.Exec(ctx, rdb.Param{Value: 1}).Close().(*rdb.ArityError); !ok {
+		t.Error("prepared statement did not check parameter count")
+	}
+	if err := pool.Query(ctx, &rdb.Command{SQL: "select ?, ?;"}, rdb.Param{Value: 1}, rdb.Param{Value: 2}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.Calls()); n != 2 {
+		t.Fatalf("got %d calls, invalid commands should not reach the driver", n)
+	}
+}
+
+func TestPlaceholderArityNamed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderAtP
+	fake.Expect("select @a, @b;")
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	cmd := &rdb.Command{SQL: "select @a, @b;"}
+	err = pool.Query(ctx, cmd, rdb.Param{Name: "a", Value: 1}).Close()
+	if ae, ok := err.(*rdb.ArityError); !ok || ae.Name != "b" {
+		t.Fatalf("got %v, want missing parameter b", err)
+	}
+	if n := len(fake.Calls()); n != 0 {
+		t.Fatalf("got %d calls, missing parameter should not reach the driver", n)
+	}
+
+	// With AllowUnboundNames @b is left for the server, such as a variable.
+	cmd.AllowUnboundNames = true
+	if err := pool.Query(ctx, cmd, rdb.Param{Name: "a", Value: 1}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	calls := fake.Calls()
+	if len(calls) != 1 || len(calls[0].Params) != 1 || calls[0].Params[0].Name != "a" {
+		t.Fatalf("unexpected calls %+v", calls)
+	}
+}
+
+func TestPlaceholderDuplicate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderDollar
+	fake.Expect("select $1, $2;")
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	params := []rdb.Param{{Name: "a", Value: 1}, {Name: "b", Value: 2}, {Name: "@a", Value: 3}}
+
+	err = pool.Query(ctx, &rdb.Command{SQL: "select @a, @b;"}, params...).Close()
+	if dup, ok := err.(*rdb.DuplicateParamError); !ok || dup.Name != "a" {
+		t.Fatalf("got %v, want duplicate parameter a", err)
+	}
+	st, err := pool.Prepare(ctx, &rdb.Command{SQL: "select @a, @b;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.Exec(ctx, params...).Close().(*rdb.DuplicateParamError); !ok {
+		t.Fatal("expected duplicate parameter error from statement")
+	}
+	if _, _, err := (&rdb.Command{SQL: "select @a, @b;"}).Rendered(rdb.PlaceholderDollar, params); err == nil {
+		t.Fatal("expected duplicate parameter error from Rendered")
+	}
+	if n := queryCount(fake); n != 0 {
+		t.Fatalf("got %d queries sent", n)
+	}
+
+	err = pool.Query(ctx, &rdb.Command{SQL: "select @a, @b;", AllowDuplicateParams: true}, params...).Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := fake.Calls()
+	if got := calls[len(calls)-1].Params; len(got) != 2 || got[0].Value != 3 || got[1].Value != 2 {
+		t.Fatalf("got params %+v, want the last a", got)
+	}
+}
+
+func TestPlaceholderPreRendered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "select @p1, @p2, @p1 where Name = '?';"
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderAtP
+	fake.Positional = true
+	fake.Expect(sql)
+
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	cmd := &rdb.Command{SQL: sql, PreRendered: true}
+	if err := pool.Query(ctx, cmd, rdb.Param{Value: 1}, rdb.Param{Value: 2}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	st, err := pool.Prepare(ctx, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Exec(ctx, rdb.Param{Value: 1}, rdb.Param{Value: 2}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range fake.Calls() {
+		if c.SQL != sql {
+			t.Fatalf("%v: got SQL %q, want %q", c.Op, c.SQL, sql)
+		}
+	}
+
+	// Without PreRendered @p1 is a named reference with no parameter.
+	if _, ok := pool.Query(ctx, &rdb.Command{SQL: sql}, rdb.Param{Value: 1}, rdb.Param{Value: 2}).Close().(*rdb.ArityError); !ok {
+		t.Fatal("expected *ArityError without PreRendered")
+	}
+}
+
+func benchmarkPreRendered(b *testing.B, preRendered bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderAtP
+	fake.Positional = true
+	fake.Expect("select * from Account where ID = @p1 and Name = @p2 and Kind = @p1;")
+
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer pool.Close()
+
+	cmd := &rdb.Command{SQL: "select * from Account where ID = @id and Name = @name and Kind = @id;"}
+	params := []rdb.Param{{Name: "id", Value: 1}, {Name: "name", Value: "Ann"}}
+	if preRendered {
+		cmd = &rdb.Command{SQL: "select * from Account where ID = @p1 and Name = @p2 and Kind = @p1;", PreRendered: true}
+		params = []rdb.Param{{Value: 1}, {Value: "Ann"}}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := pool.Query(ctx, cmd, params...).Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQueryRewrite(b *testing.B) {
+	benchmarkPreRendered(b, false)
+}
+
+func BenchmarkQueryPreRendered(b *testing.B) {
+	benchmarkPreRendered(b, true)
+}
@@ -0,0 +1,740 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ErrBadConn should be returned by a driver when a query fails because the
+// connection is no longer usable. The driver must discard the connection.
+// A query run on the Pool that fails with ErrBadConn before any result is
+// read is retried once on a new connection. Queries in a Transaction or on
+// a Connection are never retried.
+var ErrBadConn = errors.New("rdb: bad connection")
+
+// ErrPoolClosed is returned when a pool returned from Open, or a statement
+// prepared on it, is used after the pool is closed.
+var ErrPoolClosed = errors.New("rdb: pool closed")
+
+// IsBadConn returns true if err is ErrBadConn or has a BadConn method that
+// returns true.
+func IsBadConn(err error) bool {
+	if err == ErrBadConn {
+		return true
+	}
+	if bc, ok := err.(interface {
+		BadConn() bool
+	}); ok {
+		return bc.BadConn()
+	}
+	return false
+}
+
+// pool wraps a driver Pool returned from an Opener. Commands are processed
+// by the pool before they are handed to the driver.
+type pool struct {
+	Pool
+
+	conf   *Config
+	caps   Capabilities
+	closed int32 // Set to 1 when closed, accessed atomically.
+	health health
+}
+
+// newGuard returns a guard for a single connection, or nil if the driver
+// supports multiple active result sets.
+func (p *pool) newGuard() *busyGuard {
+	if p.caps.MultipleResultSets {
+		return nil
+	}
+	return &busyGuard{}
+}
+
+// isolation returns the isolation level to request from the driver.
+func (p *pool) isolation(iso Isolation) (Isolation, error) {
+	if iso == IsoDefault {
+		iso = p.conf.DefaultIsolation
+	}
+	return resolveIsolation(iso, p.caps.Isolations, p.conf.StrictIsolation)
+}
+
+func (p *pool) isClosed() bool {
+	return atomic.LoadInt32(&p.closed) != 0
+}
+
+func (p *pool) Close() {
+	if atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+		if p.health.stop != nil {
+			close(p.health.stop)
+		}
+		p.Pool.Close()
+	}
+}
+
+// driverQueryer is implemented by the wrappers around driver types.
+type driverQueryer interface {
+	driverPool() Pool
+}
+
+// driverOf returns the driver Pool behind q so optional interfaces
+// declared by the driver may be checked. If q is not a wrapper it is
+// returned as is.
+func driverOf(q Queryer) interface{} {
+	if w, ok := q.(driverQueryer); ok {
+		return w.driverPool()
+	}
+	return q
+}
+
+// driverNexter is implemented by the wrappers around a driver Next.
+type driverNexter interface {
+	driverNext() Next
+}
+
+// driverNextOf returns the driver Next behind n so optional interfaces
+// declared by the driver may be checked.
+func driverNextOf(n Next) Next {
+	for {
+		w, ok := n.(driverNexter)
+		if !ok {
+			return n
+		}
+		n = w.driverNext()
+	}
+}
+
+func newPool(conf *Config, driver Pool) *pool {
+	caps := driverCapabilities(driver)
+	if n := conf.MaxPacketSize; n > 0 && (caps.MaxPacketSize == 0 || n < caps.MaxPacketSize) {
+		caps.MaxPacketSize = n
+	}
+	p := &pool{
+		Pool: driver,
+		conf: conf,
+		caps: caps,
+	}
+	if conf.HealthCheckInterval > 0 {
+		p.health.stop = make(chan struct{})
+		go p.checkHealth(conf.HealthCheckInterval)
+	}
+	return p
+}
+
+// command returns the command and parameters as the driver expects them.
+func (p *pool) command(cmd *Command, params []Param) (*Command, []Param, error) {
+	return render(cmd, params, p.caps.PlaceholderStyle, !p.caps.NamedParams)
+}
+
+// render returns the command and parameters in the placeholder style.
+// If positional is true named references are replaced by position.
+func render(cmd *Command, params []Param, style PlaceholderStyle, positional bool) (*Command, []Param, error) {
+	if cmd.PreRendered {
+		return cmd, params, nil
+	}
+	params, err := expandParams(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	params, err = jsonParams(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	params, err = readerParams(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	params, err = uniqueParams(params, cmd.AllowDuplicateParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	if style == PlaceholderQuestion && !hasNamed(params) {
+		// Named references are left alone, they may be variables.
+		return cmd, params, checkArgs(cmd.SQL, params)
+	}
+	return style.rewrite(cmd, params, positional)
+}
+
+func (p *pool) driverPool() Pool {
+	return p.Pool
+}
+
+func hasNamed(params []Param) bool {
+	for _, p := range params {
+		if len(p.Name) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *pool) query(ctx context.Context, q Queryer, cmd *Command, params []Param) Next {
+	start := time.Now()
+	cmd = p.withDefaults(cmd)
+	cmd = withReadOnly(ctx, cmd)
+	ctx, cancel := withTimeout(ctx, cmd)
+	next, sql := p.send(ctx, q, cmd, params)
+	return p.wrap(ctx, next, cmd, sql, start, cancel, false)
+}
+
+// wrap applies the settings of the config and the command to the results
+// of a query or of a prepared statement. Cancel ends the context of the
+// command Timeout, if not nil.
+func (p *pool) wrap(ctx context.Context, next Next, cmd *Command, sql string, start time.Time, cancel func(), prepared bool) Next {
+	if cancel != nil {
+		next = &timeoutNext{Next: next, cancel: cancel}
+	}
+	if p.conf.MaxRowsPerQuery > 0 {
+		next = &limitNext{Next: next, max: p.conf.MaxRowsPerQuery}
+	}
+	if p.conf.OnQuery != nil {
+		next = newMetricNext(next, start, cmd.Name, sql, correlation(ctx, p.conf.CorrelationKey), prepared, p.conf.OnQuery)
+	}
+	if p.conf.Location != nil || len(p.conf.TimeLayouts) != 0 {
+		next = &locationNext{Next: next, loc: p.conf.Location, layouts: p.conf.TimeLayouts}
+	}
+	if len(cmd.ColumnMap) != 0 {
+		next = &columnMapNext{Next: next, colMap: cmd.ColumnMap}
+	}
+	if cmd.Converter != nil {
+		next = &convertNext{Next: next, conv: cmd.Converter, loc: p.conf.Location, layouts: p.conf.TimeLayouts}
+	}
+	if cmd.Discard {
+		next = discard(next)
+	}
+	return next
+}
+
+// send passes the command to Config.BeforeQuery, rewrites it and sends it
+// to the driver. It returns the SQL sent, or the SQL of the command if it
+// could not be rewritten.
+func (p *pool) send(ctx context.Context, q Queryer, cmd *Command, params []Param) (Next, string) {
+	if before := p.conf.BeforeQuery; before != nil {
+		bcmd, bparams, err := before(ctx, cmd, params)
+		if err != nil {
+			return &nextError{err: err}, cmd.SQL
+		}
+		cmd, params = bcmd, bparams
+	}
+	sent, params, err := p.command(cmd, params)
+	if err != nil {
+		return &nextError{err: err}, cmd.SQL
+	}
+	if p.conf.DryRun {
+		return &nextError{}, sent.SQL
+	}
+	next := q.Query(ctx, sent, params...)
+	return p.queryErrors(next, cmd.Name, sent.SQL, params), sent.SQL
+}
+
+// queryErrors wraps errors of the driver in a *QueryError if the pool is
+// configured to include parameters in errors.
+func (p *pool) queryErrors(next Next, name, sql string, params []Param) Next {
+	if !p.conf.IncludeParamsInErrors {
+		return next
+	}
+	return &queryErrorNext{Next: next, name: name, sql: sql, params: params, values: p.conf.UnsafeIncludeParamValues}
+}
+
+// Query runs the command. If the command sets an isolation level it is
+// run in an implicit transaction at that level so the isolation of the
+// session is left unchanged for the next query. An Atomic command is also
+// run in an implicit transaction. If the context is already done its error
+// is returned without taking a connection.
+func (p *pool) Query(ctx context.Context, cmd *Command, params ...Param) Next {
+	if p.isClosed() {
+		return &nextError{err: ErrPoolClosed}
+	}
+	if err := ctx.Err(); err != nil {
+		return &nextError{err: err}
+	}
+	cmd = withIsolation(ctx, cmd)
+	if p.conf.DryRun {
+		if _, err := p.isolation(cmd.Isolation); err != nil {
+			return &nextError{err: err}
+		}
+		return p.query(ctx, p.Pool, cmd, params)
+	}
+	if cmd.Isolation != IsoDefault || cmd.Atomic {
+		return p.isolatedQuery(ctx, cmd, params)
+	}
+	return &retryNext{
+		Next: p.query(ctx, p.Pool, cmd, params),
+		retry: func() Next {
+			return p.query(ctx, p.Pool, cmd, params)
+		},
+	}
+}
+
+func (p *pool) isolatedQuery(ctx context.Context, cmd *Command, params []Param) Next {
+	iso, err := p.isolation(cmd.Isolation)
+	if err != nil {
+		return &nextError{err: err}
+	}
+	txCtx, cancel := context.WithCancel(ctx)
+	tx, err := p.Pool.Begin(txCtx, iso)
+	if err != nil {
+		cancel()
+		return &nextError{err: err}
+	}
+	return &txNext{
+		Next:   p.query(ctx, tx, cmd, params),
+		ctx:    ctx,
+		tx:     tx,
+		cancel: cancel,
+	}
+}
+
+// txNext commits the implicit transaction of a query when the last result
+// has been read or the query is closed. If the query fails the transaction
+// is rolled back.
+type txNext struct {
+	Next
+
+	ctx     context.Context
+	tx      Transaction
+	cancel  func()
+	pending *txResult // Read when the previous result was exhausted.
+	done    bool
+	err     error
+}
+
+func (n *txNext) driverNext() Next {
+	return n.Next
+}
+
+// finish ends the transaction and returns the first error.
+func (n *txNext) finish(err error) error {
+	if n.done {
+		if err == nil {
+			err = n.err
+		}
+		return err
+	}
+	n.done = true
+	if cerr := n.Next.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = n.tx.Commit(n.ctx)
+	}
+	// Cancel rolls back the transaction if it was not committed.
+	n.cancel()
+	n.err = err
+	return err
+}
+
+// exhausted is called when a result has been read to the end. The next
+// result is read ahead and the transaction finished if there is none.
+func (n *txNext) exhausted() error {
+	if n.done || n.pending != nil {
+		return n.err
+	}
+	res, err := n.Next.Result()
+	if res == nil || err != nil {
+		return n.finish(err)
+	}
+	n.pending = &txResult{Result: res, next: n}
+	return nil
+}
+
+func (n *txNext) Result() (Result, error) {
+	if res := n.pending; res != nil {
+		n.pending = nil
+		return res, nil
+	}
+	res, err := n.Next.Result()
+	if res == nil || err != nil {
+		return res, n.finish(err)
+	}
+	return &txResult{Result: res, next: n}, nil
+}
+
+func (n *txNext) Buffer() (*Buffer, error) {
+	if res := n.pending; res != nil {
+		n.pending = nil
+		b, err := BufferRemaining(res.Result)
+		if err != nil {
+			return b, n.finish(err)
+		}
+		return b, nil
+	}
+	b, err := n.Next.Buffer()
+	if b == nil || err != nil {
+		return b, n.finish(err)
+	}
+	return b, nil
+}
+
+func (n *txNext) BufferSet() (BufferSet, error) {
+	var set BufferSet
+	if n.pending != nil {
+		b, err := n.Buffer()
+		if err != nil {
+			return set, err
+		}
+		set = append(set, b)
+	}
+	more, err := n.Next.BufferSet()
+	return append(set, more...), n.finish(err)
+}
+
+func (n *txNext) Close() error {
+	if n.done {
+		return nil
+	}
+	return n.finish(nil)
+}
+
+// txResult finishes the implicit transaction when the result is closed,
+// or when it is read to the end and is the last result.
+type txResult struct {
+	Result
+
+	next *txNext
+	end  bool
+}
+
+func (res *txResult) Prep(name string, value interface{}) Result {
+	res.Result.Prep(name, value)
+	return res
+}
+
+func (res *txResult) Prepx(index int, value interface{}) Result {
+	res.Result.Prepx(index, value)
+	return res
+}
+
+func (res *txResult) Scan() (Row, error) {
+	if res.end {
+		return nil, nil
+	}
+	row, err := res.Result.Scan()
+	if err != nil {
+		return nil, res.next.finish(err)
+	}
+	if row == nil {
+		res.end = true
+		return nil, res.next.exhausted()
+	}
+	return row, nil
+}
+
+func (res *txResult) ScanInto(row *ValueRow) (bool, error) {
+	if res.end {
+		return false, nil
+	}
+	ok, err := ScanInto(res.Result, row)
+	if err != nil {
+		return false, res.next.finish(err)
+	}
+	if !ok {
+		res.end = true
+		return false, res.next.exhausted()
+	}
+	return true, nil
+}
+
+func (res *txResult) Close() error {
+	return res.next.Close()
+}
+
+// retryNext runs the query again if the first read reports a bad connection.
+type retryNext struct {
+	Next
+
+	retry func() Next
+	read  bool
+}
+
+func (n *retryNext) driverNext() Next {
+	return n.Next
+}
+
+// retried returns true if the query was run again.
+func (n *retryNext) retried(err error) bool {
+	if n.read {
+		return false
+	}
+	n.read = true
+	if !IsBadConn(err) {
+		return false
+	}
+	n.Next.Close()
+	n.Next = n.retry()
+	return true
+}
+
+func (n *retryNext) Result() (Result, error) {
+	res, err := n.Next.Result()
+	if n.retried(err) {
+		return n.Next.Result()
+	}
+	return res, err
+}
+
+func (n *retryNext) Buffer() (*Buffer, error) {
+	b, err := n.Next.Buffer()
+	if n.retried(err) {
+		return n.Next.Buffer()
+	}
+	return b, err
+}
+
+func (n *retryNext) BufferSet() (BufferSet, error) {
+	set, err := n.Next.BufferSet()
+	if n.retried(err) {
+		return n.Next.BufferSet()
+	}
+	return set, err
+}
+
+func (p *pool) Prepare(ctx context.Context, cmd *Command) (Statement, error) {
+	if p.isClosed() {
+		return nil, ErrPoolClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cmd = p.withDefaults(cmd)
+	orig := cmd
+	style := p.caps.PlaceholderStyle
+	var plan *placeholderPlan
+	if !cmd.PreRendered {
+		plan = style.plan(cmd.SQL, !p.caps.NamedParams)
+		plan.unbound = cmd.AllowUnboundNames
+		if style == PlaceholderQuestion && !plan.named {
+			plan = nil
+		} else {
+			rewritten := *cmd
+			rewritten.SQL = plan.sql
+			cmd = &rewritten
+		}
+	}
+	var st Statement = dryStatement{}
+	if !p.conf.DryRun {
+		var err error
+		st, err = p.Pool.Prepare(ctx, cmd)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &statement{Statement: st, pool: p, cmd: orig, plan: plan, sql: cmd.SQL}, nil
+}
+
+// Ping pings the driver, or runs Config.ValidationQuery if set. It returns
+// ctx.Err() as soon as the context is done, even if the driver is still
+// blocked such as in a dial to an unreachable host.
+func (p *pool) Ping(ctx context.Context) error {
+	if p.isClosed() {
+		return ErrPoolClosed
+	}
+	if err := ctx.Err(); err != nil {
+		p.health.done(err)
+		return err
+	}
+	errc := make(chan error, 1)
+	GoSafe(nil, errc, func() error {
+		if len(p.conf.ValidationQuery) != 0 {
+			return p.validate(ctx)
+		}
+		return p.Pool.Ping(ctx)
+	})
+	select {
+	case err := <-errc:
+		p.health.ping(err)
+		return err
+	case <-ctx.Done():
+		err := ctx.Err()
+		p.health.done(err)
+		return err
+	}
+}
+
+// validate runs Config.ValidationQuery on the driver and reads its results.
+func (p *pool) validate(ctx context.Context) error {
+	next := p.Pool.Query(ctx, &Command{SQL: p.conf.ValidationQuery, Name: "validate"})
+	_, err := next.BufferSet()
+	if cerr := next.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (p *pool) Begin(ctx context.Context, iso Isolation) (Transaction, error) {
+	if p.isClosed() {
+		return nil, ErrPoolClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	iso, err := p.isolation(iso)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := p.Pool.Begin(ctx, iso)
+	if err != nil {
+		return nil, err
+	}
+	return &transaction{Transaction: tx, pool: p, iso: iso, guard: p.newGuard()}, nil
+}
+
+func (p *pool) BeginDistributed(ctx context.Context, iso Isolation, xid string) (Transaction, error) {
+	if p.isClosed() {
+		return nil, ErrPoolClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !p.caps.XA {
+		return nil, ErrNotSupported
+	}
+	iso, err := p.isolation(iso)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := BeginDistributed(ctx, p.Pool, iso, xid)
+	if err != nil {
+		return nil, err
+	}
+	return &transaction{Transaction: tx, pool: p, iso: iso, guard: p.newGuard()}, nil
+}
+
+func (p *pool) Connection(ctx context.Context) (Connection, error) {
+	if p.isClosed() {
+		return nil, ErrPoolClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	conn, err := p.Pool.Connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &connection{Connection: conn, pool: p, guard: p.newGuard()}, nil
+}
+
+type transaction struct {
+	Transaction
+
+	pool  *pool
+	iso   Isolation
+	guard *busyGuard // Nil if the driver supports multiple active results.
+}
+
+func (tx *transaction) Isolation() Isolation {
+	return tx.iso
+}
+
+func (tx *transaction) driverPool() Pool {
+	return tx.pool.Pool
+}
+
+func (tx *transaction) Query(ctx context.Context, cmd *Command, params ...Param) Next {
+	if err := ctx.Err(); err != nil {
+		return &nextError{err: err}
+	}
+	if tx.guard == nil {
+		return tx.pool.query(ctx, tx.Transaction, cmd, params)
+	}
+	return tx.guard.query(func() Next {
+		return tx.pool.query(ctx, tx.Transaction, cmd, params)
+	})
+}
+
+type connection struct {
+	Connection
+
+	pool  *pool
+	guard *busyGuard // Nil if the driver supports multiple active results.
+}
+
+func (conn *connection) driverPool() Pool {
+	return conn.pool.Pool
+}
+
+func (conn *connection) Query(ctx context.Context, cmd *Command, params ...Param) Next {
+	if err := ctx.Err(); err != nil {
+		return &nextError{err: err}
+	}
+	if conn.guard == nil {
+		return conn.pool.query(ctx, conn.Connection, cmd, params)
+	}
+	return conn.guard.query(func() Next {
+		return conn.pool.query(ctx, conn.Connection, cmd, params)
+	})
+}
+
+// dryStatement is the driver statement of a pool with Config.DryRun set.
+type dryStatement struct{}
+
+func (dryStatement) Exec(ctx context.Context, params ...Param) Next {
+	return &nextError{}
+}
+
+type statement struct {
+	Statement
+
+	pool *pool
+	cmd  *Command         // Command prepared, with the pool defaults.
+	plan *placeholderPlan // Nil if the SQL was not rewritten.
+	sql  string           // SQL sent to the driver.
+}
+
+func (st *statement) Exec(ctx context.Context, params ...Param) Next {
+	if st.pool.isClosed() {
+		return &nextError{err: ErrPoolClosed}
+	}
+	if err := ctx.Err(); err != nil {
+		return &nextError{err: err}
+	}
+	start := time.Now()
+	ctx, cancel := withTimeout(ctx, st.cmd)
+	next := st.exec(ctx, params)
+	return st.pool.wrap(ctx, next, st.cmd, st.sql, start, cancel, true)
+}
+
+func (st *statement) exec(ctx context.Context, params []Param) Next {
+	if before := st.pool.conf.BeforeQuery; before != nil {
+		// The statement is prepared, only the parameters may change.
+		_, bparams, err := before(ctx, st.cmd, params)
+		if err != nil {
+			return &nextError{err: err}
+		}
+		params = bparams
+	}
+	if st.cmd.PreRendered {
+		return st.pool.queryErrors(st.Statement.Exec(ctx, params...), st.cmd.Name, st.sql, params)
+	}
+	params, err := expandParams(params)
+	if err != nil {
+		return &nextError{err: err}
+	}
+	params, err = jsonParams(params)
+	if err != nil {
+		return &nextError{err: err}
+	}
+	params, err = readerParams(params)
+	if err != nil {
+		return &nextError{err: err}
+	}
+	params, err = uniqueParams(params, st.cmd.AllowDuplicateParams)
+	if err != nil {
+		return &nextError{err: err}
+	}
+	if st.plan != nil {
+		params, err = st.plan.order(params)
+	} else {
+		err = checkArgs(st.sql, params)
+	}
+	if err != nil {
+		return &nextError{err: err}
+	}
+	return st.pool.queryErrors(st.Statement.Exec(ctx, params...), st.cmd.Name, st.sql, params)
+}
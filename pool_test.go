@@ -0,0 +1,606 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func queryCount(fake *rdbtest.Pool) int {
+	n := 0
+	for _, c := range fake.Calls() {
+		if c.Op == rdbtest.OpQuery {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRetryBadConn(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select Name from Account;").Error(rdb.ErrBadConn).Once()
+	fake.Expect("select Name from Account;").Returns(rdbtest.NewResult("Name").Row("Ann"))
+
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := pool.Query(ctx, &rdb.Command{SQL: "select Name from Account;"}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Row) != 1 || b.Row[0].Get("Name") != "Ann" {
+		t.Fatalf("unexpected buffer %+v", b)
+	}
+	if n := queryCount(fake); n != 2 {
+		t.Fatalf("got %d queries, want 2", n)
+	}
+}
+
+func TestNoRetryInTransaction(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("update Account set Name = 'B';").Error(rdb.ErrBadConn).Once()
+	fake.Expect("update Account set Name = 'B';")
+
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := pool.Begin(ctx, rdb.IsoDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.Query(ctx, &rdb.Command{SQL: "update Account set Name = 'B';"}).Result()
+	if err != rdb.ErrBadConn {
+		t.Fatalf("got %v, want ErrBadConn", err)
+	}
+	if n := queryCount(fake); n != 1 {
+		t.Fatalf("got %d queries, want 1", n)
+	}
+}
+
+func TestPoolMaxQueriesPerConn(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select 1;")
+	conf := fake.Config()
+	conf.PoolMaxQueriesPerConn = 3
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 4; i++ {
+		if err := pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != nil {
+			t.Fatal(err)
+		}
+		conns := fake.Status().Connections()
+		switch i {
+		case 1, 2:
+			if len(conns) != 1 || conns[0].QueriesServed != int64(i) {
+				t.Fatalf("query %d: got connections %+v", i, conns)
+			}
+		case 3:
+			if len(conns) != 0 || fake.ClosedConnections() != 1 {
+				t.Fatalf("query 3: connection not retired, got %+v", conns)
+			}
+		case 4:
+			if len(conns) != 1 || conns[0].QueriesServed != 1 {
+				t.Fatalf("query 4: connection not replaced, got %+v", conns)
+			}
+		}
+	}
+}
+
+func TestPoolMaxIdle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select 1;")
+	conf := fake.Config()
+	conf.PoolMaxCapacity = 10
+	conf.PoolMaxIdle = 2
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Burst to five concurrent queries.
+	var burst []rdb.Next
+	for i := 0; i < 5; i++ {
+		burst = append(burst, pool.Query(ctx, &rdb.Command{SQL: "select 1;"}))
+	}
+	if got := len(fake.Status().Connections()); got != 5 {
+		t.Fatalf("got %d connections during burst, want 5", got)
+	}
+	for _, next := range burst {
+		if err := next.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conns := fake.Status().Connections()
+	if len(conns) != 2 {
+		t.Fatalf("got %d connections after burst, want 2", len(conns))
+	}
+	for _, c := range conns {
+		if !c.Idle {
+			t.Errorf("connection not idle %+v", c)
+		}
+	}
+	if got := fake.ClosedConnections(); got != 3 {
+		t.Errorf("got %d closed connections, want 3", got)
+	}
+}
+
+func TestPoolClock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := rdbtest.NewClock(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	fake := rdbtest.New()
+	fake.Expect("select 1;")
+	conf := fake.Config()
+	conf.Clock = clock
+	conf.PoolIdleTimeout = time.Minute
+	conf.PoolMaxLifetime = time.Hour
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	query := func() rdb.ConnInfo {
+		if err := pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != nil {
+			t.Fatal(err)
+		}
+		conns := fake.Status().Connections()
+		if len(conns) != 1 {
+			t.Fatalf("got connections %+v, want 1", conns)
+		}
+		return conns[0]
+	}
+
+	query()
+	clock.Advance(30 * time.Second)
+	if c := query(); c.Age != 30*time.Second || fake.ClosedConnections() != 0 {
+		t.Fatalf("connection not reused, got %+v", c)
+	}
+
+	// Idle for the idle timeout.
+	clock.Advance(time.Minute)
+	if c := query(); c.Age != 0 || fake.ClosedConnections() != 1 {
+		t.Fatalf("idle connection not closed, got %+v", c)
+	}
+
+	// Used often but older then the max lifetime.
+	for i := 0; i < 59; i++ {
+		clock.Advance(time.Minute - time.Second)
+		query()
+	}
+	if n := fake.ClosedConnections(); n != 1 {
+		t.Fatalf("got %d closed connections before max lifetime, want 1", n)
+	}
+	clock.Advance(time.Minute)
+	if c := query(); c.Age != 0 || fake.ClosedConnections() != 2 {
+		t.Fatalf("old connection not recycled, got %+v", c)
+	}
+}
+
+func TestPoolWaitTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select 1;")
+	conf := fake.Config()
+	conf.PoolMaxCapacity = 1
+	conf.PoolWaitTimeout = 50 * time.Millisecond
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	held := pool.Query(ctx, &rdb.Command{SQL: "select 1;"})
+	defer held.Close()
+
+	start := time.Now()
+	_, err = pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Buffer()
+	if err != rdb.ErrPoolTimeout {
+		t.Fatalf("got %v, want ErrPoolTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < conf.PoolWaitTimeout || elapsed > time.Second {
+		t.Fatalf("waited %v for a connection, want about %v", elapsed, conf.PoolWaitTimeout)
+	}
+
+	// A returned connection is handed to a waiting query.
+	done := make(chan error, 1)
+	go func() {
+		done <- pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	held.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolClosed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select 1;")
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := &rdb.Command{SQL: "select 1;"}
+	st, err := pool.Prepare(ctx, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Exec(ctx).Close(); err != nil {
+		t.Fatal(err)
+	}
+	before := len(fake.Calls())
+
+	pool.Close()
+	if err := st.Exec(ctx).Close(); err != rdb.ErrPoolClosed {
+		t.Fatalf("got %v from statement, want ErrPoolClosed", err)
+	}
+	if err := pool.Query(ctx, cmd).Close(); err != rdb.ErrPoolClosed {
+		t.Fatalf("got %v from query, want ErrPoolClosed", err)
+	}
+	if _, err := pool.Prepare(ctx, cmd); err != rdb.ErrPoolClosed {
+		t.Fatalf("got %v from prepare, want ErrPoolClosed", err)
+	}
+	if _, err := pool.Begin(ctx, rdb.IsoDefault); err != rdb.ErrPoolClosed {
+		t.Fatalf("got %v from begin, want ErrPoolClosed", err)
+	}
+	if after := len(fake.Calls()); after != before {
+		t.Fatalf("driver called %d times after close", after-before)
+	}
+	pool.Close()
+}
+
+func TestInitSQL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("SET ANSI_NULLS ON;")
+	fake.Expect("SET LOCK_TIMEOUT 1000;")
+	fake.Expect("select 1;")
+	conf := fake.Config()
+	conf.InitSQL = []string{"SET ANSI_NULLS ON;", "SET LOCK_TIMEOUT 1000;"}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// Two concurrent queries open two connections, the third reuses one.
+	first := pool.Query(ctx, &rdb.Command{SQL: "select 1;"})
+	second := pool.Query(ctx, &rdb.Command{SQL: "select 1;"})
+	first.Close()
+	second.Close()
+	if err := pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range fake.Calls() {
+		got = append(got, c.SQL)
+	}
+	want := []string{
+		"SET ANSI_NULLS ON;", "SET LOCK_TIMEOUT 1000;", "select 1;",
+		"SET ANSI_NULLS ON;", "SET LOCK_TIMEOUT 1000;", "select 1;",
+		"select 1;",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got calls %q, want %q", got, want)
+	}
+
+	errLock := errors.New("lock timeout not supported")
+	failing := rdbtest.New()
+	failing.Expect("SET ANSI_NULLS ON;")
+	failing.Expect("SET LOCK_TIMEOUT 1000;").Error(errLock)
+	failing.Expect("select 1;")
+	conf = failing.Config()
+	conf.InitSQL = []string{"SET ANSI_NULLS ON;", "SET LOCK_TIMEOUT 1000;"}
+	failPool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer failPool.Close()
+	if err := failPool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != errLock {
+		t.Fatalf("got %v, want %v", err, errLock)
+	}
+	if n := len(failing.Status().Connections()); n != 0 {
+		t.Fatalf("got %d connections in pool, want 0", n)
+	}
+	for _, c := range failing.Calls() {
+		if c.SQL == "select 1;" {
+			t.Fatal("query ran on a connection that failed to initialize")
+		}
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errDial := errors.New("connection refused")
+	fails := 4
+	fake := rdbtest.New()
+	fake.DialFunc = func() error {
+		if fails > 0 {
+			fails--
+			return errDial
+		}
+		return nil
+	}
+	fake.Expect("select 1;")
+	conf := fake.Config()
+	conf.ReconnectBackoff = rdb.Backoff{Initial: 20 * time.Millisecond, Max: 50 * time.Millisecond, Factor: 2}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	delays := []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond}
+	for i := 0; i < 4; i++ {
+		if err := pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != errDial {
+			t.Fatalf("attempt %d: got %v, want %v", i, err, errDial)
+		}
+		state := fake.Backoff()
+		if state.Failures() != i+1 || state.Delay() != delays[i] {
+			t.Fatalf("attempt %d: got %d failures, delay %v", i, state.Failures(), state.Delay())
+		}
+	}
+	if err := pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Backoff().Failures() != 0 {
+		t.Error("backoff not reset after a connection was established")
+	}
+
+	dials := fake.Dials()
+	if len(dials) != 5 {
+		t.Fatalf("got %d dials, want 5", len(dials))
+	}
+	for i, delay := range delays {
+		gap := dials[i+1].Sub(dials[i])
+		// Jitter shortens the delay by up to a tenth.
+		if gap < delay-delay/10 || gap > delay+25*time.Millisecond {
+			t.Errorf("dial %d: waited %v, want about %v", i+1, gap, delay)
+		}
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Upsert = rdb.UpsertOnConflict
+	fake.Expect("select 1;")
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	cmd := &rdb.Command{SQL: "select 1;"}
+	st, err := pool.Prepare(ctx, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := pool.Begin(ctx, rdb.IsoDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls, dials := len(fake.Calls()), len(fake.Dials())
+
+	canceled, cancelNow := context.WithCancel(ctx)
+	cancelNow()
+	list := []struct {
+		Name string
+		Call func() error
+	}{
+		{"Query", func() error { return pool.Query(canceled, cmd).Close() }},
+		{"Query Atomic", func() error { return pool.Query(canceled, &rdb.Command{SQL: "select 1;", Atomic: true}).Close() }},
+		{"Begin", func() error { _, err := pool.Begin(canceled, rdb.IsoDefault); return err }},
+		{"Ping", func() error { return pool.Ping(canceled) }},
+		{"Prepare", func() error { _, err := pool.Prepare(canceled, cmd); return err }},
+		{"Exec", func() error { return st.Exec(canceled).Close() }},
+		{"Connection", func() error { _, err := pool.Connection(canceled); return err }},
+		{"Transaction Query", func() error { return tx.Query(canceled, cmd).Close() }},
+		{"QueryArgs", func() error { _, err := rdb.QueryArgs(canceled, pool, "select 1;"); return err }},
+		{"Scalar", func() error { _, err := rdb.Scalar[int](canceled, pool, cmd); return err }},
+		{"Collect", func() error { _, err := rdb.Collect[int](canceled, pool, cmd); return err }},
+		{"InsertReturning", func() error {
+			_, err := rdb.InsertReturning(canceled, pool, &rdb.Command{SQL: "insert into Account (Name) values ('A')"}, []string{"ID"})
+			return err
+		}},
+		{"Upsert", func() error {
+			_, err := rdb.Upsert(canceled, pool, "Account", []string{"ID"}, []string{"Name"}, [][]interface{}{{1, "A"}})
+			return err
+		}},
+	}
+	for _, item := range list {
+		if err := item.Call(); err != context.Canceled {
+			t.Errorf("%s: got %v, want %v", item.Name, err, context.Canceled)
+		}
+	}
+	if n := len(fake.Calls()) - calls; n != 0 {
+		t.Errorf("driver called %d times with a canceled context", n)
+	}
+	if n := len(fake.Dials()) - dials; n != 0 {
+		t.Errorf("dialed %d connections with a canceled context", n)
+	}
+}
+
+type tenantKey struct{}
+
+func TestBeforeQuery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select * from Account where Active = 1 and Tenant = ?;")
+	conf := fake.Config()
+	conf.BeforeQuery = func(ctx context.Context, cmd *rdb.Command, params []rdb.Param) (*rdb.Command, []rdb.Param, error) {
+		tenant, ok := ctx.Value(tenantKey{}).(int)
+		if !ok {
+			return nil, nil, errors.New("no tenant")
+		}
+		filtered := *cmd
+		filtered.SQL = strings.TrimSuffix(cmd.SQL, ";") + " and Tenant = ?;"
+		return &filtered, append(params, rdb.Param{Value: tenant}), nil
+	}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	cmd := &rdb.Command{SQL: "select * from Account where Active = 1;"}
+	if err := pool.Query(context.WithValue(ctx, tenantKey{}, 7), cmd).Close(); err != nil {
+		t.Fatal(err)
+	}
+	calls := fake.Calls()
+	if len(calls) != 1 || len(calls[0].Params) != 1 || calls[0].Params[0].Value != 7 {
+		t.Fatalf("unexpected calls %+v", calls)
+	}
+	if cmd.SQL != "select * from Account where Active = 1;" {
+		t.Fatalf("command changed to %q", cmd.SQL)
+	}
+
+	// An error from the hook fails the query before it is sent.
+	if err := pool.Query(ctx, cmd).Close(); err == nil || err.Error() != "no tenant" {
+		t.Fatalf("got %v, want hook error", err)
+	}
+	if n := queryCount(fake); n != 1 {
+		t.Fatalf("got %d queries, aborted query should not reach the driver", n)
+	}
+}
+
+func TestValidationQuery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dead := errors.New("server closed the connection")
+	fake := rdbtest.New()
+	fake.Expect("select 1;").Error(dead).Once()
+	fake.Expect("select 1;")
+	fake.Expect("select * from Account;")
+	var sessions []string
+	conf := fake.Config()
+	conf.ValidationQuery = "select 1;"
+	conf.OnQuery = func(m rdb.QueryMetric) {
+		sessions = append(sessions, m.SessionID)
+	}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := pool.Query(ctx, &rdb.Command{SQL: "select * from Account;"}).Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sessions[0] == sessions[1] {
+		t.Fatalf("connection %s failed validation but was reused", sessions[0])
+	}
+	if n := fake.ClosedConnections(); n != 1 {
+		t.Fatalf("got %d closed connections, want 1", n)
+	}
+
+	// Ping runs the validation query rather then pinging the driver.
+	if err := pool.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range fake.Calls() {
+		if c.Op == rdbtest.OpPing {
+			t.Fatal("driver was pinged")
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	conf := fake.Config()
+	conf.DryRun = true
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	next := pool.Query(ctx, &rdb.Command{SQL: "select * from Account where ID = ?;"}, rdb.Param{Value: 1})
+	res, err := next.Result()
+	if res != nil || err != nil {
+		t.Fatalf("got result %v, error %v, want no result", res, err)
+	}
+	if err := next.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	list := []struct {
+		name   string
+		sql    string
+		params []rdb.Param
+		want   rdb.ArityError
+	}{
+		{"too few", "select ?, ?;", []rdb.Param{{Value: 1}}, rdb.ArityError{Want: 2, Got: 1}},
+		{"missing named", "select ?, @b;", []rdb.Param{{Value: 1}, {Name: "a", Value: 2}}, rdb.ArityError{Want: 1, Got: 1, Name: "b"}},
+	}
+	for _, item := range list {
+		err := pool.Query(ctx, &rdb.Command{SQL: item.sql, Atomic: true}, item.params...).Close()
+		if ae, ok := err.(*rdb.ArityError); !ok || *ae != item.want {
+			t.Errorf("%s: got %v, want %+v", item.name, err, item.want)
+		}
+	}
+
+	st, err := pool.Prepare(ctx, &rdb.Command{SQL: "select ?, ?;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.Exec(ctx, rdb.Param{Value: 1}).Close().(*rdb.ArityError); !ok {
+		t.Error("prepared statement did not check parameter count")
+	}
+	if err := st.Exec(ctx, rdb.Param{Value: 1}, rdb.Param{Value: 2}).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Fatalf("got driver calls %+v", calls)
+	}
+	if dials := fake.Dials(); len(dials) != 0 {
+		t.Fatalf("got %d connections, want none", len(dials))
+	}
+}
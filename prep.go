@@ -0,0 +1,76 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPrepInto is the panic value of Into and Intox on a Row returned from
+// Scan when the column is bound with Result.Prep. The bound destination
+// already holds the value.
+var ErrPrepInto = errors.New("rdb: column is bound with Prep, read the bound destination rather then calling Into")
+
+// PrepRow assigns the columns of a scanned row bound with Result.Prep to
+// their destinations, keyed by column index. It returns the row as a view
+// that panics with ErrPrepInto if Into or Intox is called for a bound
+// column. Drivers call it from Result.Scan. An error is returned if a
+// value cannot be assigned to its destination.
+func PrepRow(row Row, schema Schema, prep map[int]interface{}) (Row, error) {
+	if len(prep) == 0 {
+		return row, nil
+	}
+	for index, dest := range prep {
+		if err := intox(row, index, dest); err != nil {
+			return nil, err
+		}
+	}
+	return &prepRow{Row: row, schema: schema, prep: prep}, nil
+}
+
+// intox calls row.Intox and returns a panic as an error.
+func intox(row Row, index int, dest interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+				return
+			}
+			err = fmt.Errorf("rdb: %v", r)
+		}
+	}()
+	row.Intox(index, dest)
+	return nil
+}
+
+type prepRow struct {
+	Row
+
+	schema Schema
+	prep   map[int]interface{}
+}
+
+func (r *prepRow) nullAsZero() bool {
+	return rowNullAsZero(r.Row)
+}
+
+func (r *prepRow) Into(name string, value interface{}) Row {
+	for _, col := range r.schema {
+		if col.Name == name {
+			return r.Intox(col.Index, value)
+		}
+	}
+	r.Row.Into(name, value)
+	return r
+}
+
+func (r *prepRow) Intox(index int, value interface{}) Row {
+	if _, bound := r.prep[index]; bound {
+		panic(ErrPrepInto)
+	}
+	r.Row.Intox(index, value)
+	return r
+}
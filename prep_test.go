@@ -0,0 +1,114 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestResultPrep(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID, Name from Account;").Returns(rdbtest.NewResult("ID", "Name").Row(int64(1), "Ann").Row(int64(2), "Bob"))
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	res, err := pool.Query(ctx, &rdb.Command{SQL: "select ID, Name from Account;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	var name string
+	res.Prep("ID", &id).Prep("Name", &name)
+	var got []string
+	for {
+		row, err := res.Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row == nil {
+			break
+		}
+		got = append(got, name)
+		if id != int64(len(got)) {
+			t.Errorf("row %d: got ID %d", len(got), id)
+		}
+	}
+	res.Close()
+	if len(got) != 2 || got[0] != "Ann" || got[1] != "Bob" {
+		t.Fatalf("got names %q", got)
+	}
+}
+
+func TestResultPrepInto(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID, Name from Account;").Returns(rdbtest.NewResult("ID", "Name").Row(int64(1), "Ann"))
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	res, err := pool.Query(ctx, &rdb.Command{SQL: "select ID, Name from Account;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	var id int64
+	res.Prep("ID", &id)
+	row, err := res.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	row.Into("Name", &name)
+	if name != "Ann" {
+		t.Errorf("got unbound column %q", name)
+	}
+
+	defer func() {
+		if r := recover(); r != rdb.ErrPrepInto {
+			t.Fatalf("got panic %v, want ErrPrepInto", r)
+		}
+	}()
+	var again int64
+	row.Into("ID", &again)
+}
+
+func TestResultPrepError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select Name from Account;").Returns(rdbtest.NewResult("Name").Row("Ann"))
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	res, err := pool.Query(ctx, &rdb.Command{SQL: "select Name from Account;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	var id int64
+	res.Prep("Name", &id)
+	if row, err := res.Scan(); err == nil || row != nil {
+		t.Fatalf("got row %v, error %v, want an assignment error", row, err)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"bytes"
+	"reflect"
+
+	"golang.org/x/net/context"
+)
+
+// ProcCaller may be implemented by a driver Pool to provide the SQL that
+// calls a stored procedure with the parameters.
+type ProcCaller interface {
+	CallSQL(name string, params []Param) string
+}
+
+// ReturnCoder may be implemented by a driver Next to report the return
+// code of a stored procedure.
+type ReturnCoder interface {
+	ReturnCode() int
+}
+
+// ProcResult is the outcome of CallProc.
+type ProcResult struct {
+	Sets   BufferSet // Result sets returned by the procedure.
+	Output []Param   // Output parameters, populated through their Value pointers.
+
+	returnCode int
+}
+
+// ReturnCode returns the return code of the procedure, zero if the driver
+// does not report it.
+func (pr ProcResult) ReturnCode() int {
+	return pr.returnCode
+}
+
+// Out returns the value of the named output parameter, or nil if there is
+// no such output parameter.
+func (pr ProcResult) Out(name string) interface{} {
+	name = trimParamName(name)
+	for _, p := range pr.Output {
+		if trimParamName(p.Name) != name {
+			continue
+		}
+		v := reflect.ValueOf(p.Value)
+		if v.Kind() == reflect.Ptr && !v.IsNil() {
+			return v.Elem().Interface()
+		}
+		return p.Value
+	}
+	return nil
+}
+
+// CallProc calls the stored procedure and reads all of its result sets.
+// Output parameters are marked with Param.Out and have a pointer Value.
+//
+// The SQL is built by the driver if it implements ProcCaller, otherwise
+// "CALL name(...)" is used with a "?" placeholder for each unnamed
+// parameter and "@name" for each named parameter.
+func CallProc(ctx context.Context, q Queryer, name string, params ...Param) (ProcResult, error) {
+	var sql string
+	if pc, ok := driverOf(q).(ProcCaller); ok {
+		sql = pc.CallSQL(name, params)
+	} else {
+		sql = callSQL(name, params)
+	}
+	var pr ProcResult
+	for _, p := range params {
+		if p.Out {
+			pr.Output = append(pr.Output, p)
+		}
+	}
+
+	next := q.Query(ctx, &Command{SQL: sql, Name: name}, params...)
+	set, err := next.BufferSet()
+	pr.Sets = set
+	if err != nil {
+		return pr, err
+	}
+	if rc, ok := driverNextOf(next).(ReturnCoder); ok {
+		pr.returnCode = rc.ReturnCode()
+	}
+	return pr, nil
+}
+
+func callSQL(name string, params []Param) string {
+	buf := &bytes.Buffer{}
+	buf.WriteString("CALL ")
+	buf.WriteString(name)
+	buf.WriteByte('(')
+	for i, p := range params {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if n := trimParamName(p.Name); len(n) != 0 {
+			buf.WriteByte('@')
+			buf.WriteString(n)
+		} else {
+			buf.WriteByte('?')
+		}
+	}
+	buf.WriteString(");")
+	return buf.String()
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestCallProc(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("CALL Transfer(?, ?, ?, ?);").
+		Returns(rdbtest.NewResult("Account", "Balance").Row(int64(1), 90).Row(int64(2), 110)).
+		Output(int64(55), "ok").
+		ReturnCode(3)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var txID int64
+	var status string
+	pr, err := rdb.CallProc(ctx, pool, "Transfer",
+		rdb.Param{Name: "from", Value: 1},
+		rdb.Param{Name: "to", Value: 2},
+		rdb.Param{Name: "txid", Out: true, Value: &txID},
+		rdb.Param{Name: "status", Out: true, Value: &status},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.ReturnCode() != 3 {
+		t.Errorf("got return code %d, want 3", pr.ReturnCode())
+	}
+	if txID != 55 || status != "ok" {
+		t.Errorf("got outputs %d, %q", txID, status)
+	}
+	if pr.Out("txid") != int64(55) || pr.Out("@status") != "ok" || pr.Out("from") != nil {
+		t.Errorf("unexpected Out values %v, %v, %v", pr.Out("txid"), pr.Out("@status"), pr.Out("from"))
+	}
+	if len(pr.Output) != 2 {
+		t.Errorf("got %d output params, want 2", len(pr.Output))
+	}
+	if len(pr.Sets) != 1 || len(pr.Sets[0].Row) != 2 || pr.Sets[0].Row[1].Get("Balance") != 110 {
+		t.Errorf("unexpected result sets %+v", pr.Sets)
+	}
+	if err := fake.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// QueryArgs runs the SQL against the Queryer with each argument bound as an
+// unnamed positional parameter in the order given. The parameter type is
+// inferred from the Go type of the value. An argument that is already a Param
+// is used as is.
+func QueryArgs(ctx context.Context, q Queryer, sql string, args ...interface{}) (Next, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	params := make([]Param, len(args))
+	for i, arg := range args {
+		if p, is := arg.(Param); is {
+			params[i] = p
+			continue
+		}
+		params[i] = Param{
+			Type:  InferType(arg),
+			Value: arg,
+		}
+	}
+	return q.Query(ctx, &Command{SQL: sql}, params...), nil
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// InferType returns the generic Type that best represents the Go value.
+// Pointers are followed. TypeUnknown is returned if no generic type fits
+// and the driver should guess.
+func InferType(value interface{}) Type {
+	if value == nil {
+		return TypeUnknown
+	}
+	rt := reflect.TypeOf(value)
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	switch {
+	case rt == timeType:
+		return Time
+	case rt.ConvertibleTo(bytesType) && rt.Kind() == reflect.Slice:
+		return Binary
+	}
+	switch rt.Kind() {
+	case reflect.String:
+		return Text
+	case reflect.Bool:
+		return Bool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Integer
+	case reflect.Float32, reflect.Float64:
+		return Float
+	}
+	return TypeUnknown
+}
+
+// Explainer may be implemented by a driver Pool to provide the keyword
+// placed before a command to explain it.
+type Explainer interface {
+	ExplainPrefix(analyze bool) string
+}
+
+// Explain runs the command prefixed with the driver's explain keyword and
+// returns the plan text. Each plan row is written on its own line with
+// columns separated by a tab. If analyze is true the command is run and
+// the plan includes the actual execution statistics. If the driver does
+// not implement Explainer "EXPLAIN" or "EXPLAIN ANALYZE" is used.
+func Explain(ctx context.Context, q Queryer, cmd *Command, analyze bool, params ...Param) (string, error) {
+	var prefix string
+	if ex, ok := driverOf(q).(Explainer); ok {
+		prefix = ex.ExplainPrefix(analyze)
+	} else if analyze {
+		prefix = "EXPLAIN ANALYZE "
+	} else {
+		prefix = "EXPLAIN "
+	}
+	explain := *cmd
+	explain.SQL = prefix + cmd.SQL
+
+	set, err := q.Query(ctx, &explain, params...).BufferSet()
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	for _, b := range set {
+		for _, row := range b.Row {
+			if buf.Len() != 0 {
+				buf.WriteRune('\n')
+			}
+			for i := range b.Schema {
+				if i != 0 {
+					buf.WriteRune('\t')
+				}
+				fmt.Fprint(buf, row.Getx(i))
+			}
+		}
+	}
+	return buf.String(), nil
+}
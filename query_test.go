@@ -0,0 +1,90 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type recordQueryer struct {
+	cmd    *Command
+	params []Param
+}
+
+func (q *recordQueryer) Query(ctx context.Context, cmd *Command, params ...Param) Next {
+	q.cmd = cmd
+	q.params = params
+	return &nextError{}
+}
+
+func TestQueryArgs(t *testing.T) {
+	q := &recordQueryer{}
+	now := time.Now()
+	s := "ptr"
+	_, err := QueryArgs(context.Background(), q, "select ?, ?, ?, ?, ?, ?, ?, ?;",
+		int32(4), "hello", []byte{1}, true, 1.5, now, &s, Param{Name: "keep", Type: TypeJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.cmd.SQL != "select ?, ?, ?, ?, ?, ?, ?, ?;" {
+		t.Fatalf("unexpected SQL %q", q.cmd.SQL)
+	}
+	want := []struct {
+		Type  Type
+		Value interface{}
+	}{
+		{Integer, int32(4)},
+		{Text, "hello"},
+		{Binary, nil},
+		{Bool, true},
+		{Float, 1.5},
+		{Time, now},
+		{Text, &s},
+		{TypeJSON, nil},
+	}
+	if len(q.params) != len(want) {
+		t.Fatalf("got %d params, want %d", len(q.params), len(want))
+	}
+	for i, w := range want {
+		p := q.params[i]
+		if p.Name != "" && i != len(want)-1 {
+			t.Errorf("param %d: unexpected name %q", i, p.Name)
+		}
+		if p.Type != w.Type {
+			t.Errorf("param %d: got type %d, want %d", i, p.Type, w.Type)
+		}
+		if w.Value != nil && p.Value != w.Value {
+			t.Errorf("param %d: got value %v, want %v", i, p.Value, w.Value)
+		}
+	}
+	if q.params[len(want)-1].Name != "keep" {
+		t.Errorf("Param argument not passed through")
+	}
+}
+
+func TestQueryArgsCanceled(t *testing.T) {
+	q := &recordQueryer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := QueryArgs(ctx, q, "select 1;"); err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if q.cmd != nil {
+		t.Fatal("query should not have been sent")
+	}
+}
+
+func TestNextErrorCloseTwice(t *testing.T) {
+	next := Query(context.Background(), &Command{SQL: "select 1;"})
+	if err := next.Close(); err != errNoPoolContext {
+		t.Fatalf("got %v, want %v", err, errNoPoolContext)
+	}
+	if err := next.Close(); err != nil {
+		t.Fatalf("second close returned %v", err)
+	}
+}
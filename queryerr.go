@@ -0,0 +1,169 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+
+	"golang.org/x/net/context"
+)
+
+// QueryError wraps an error the driver returned for a query when
+// Config.IncludeParamsInErrors is set.
+type QueryError struct {
+	Name   string // Name of the command.
+	SQL    string // SQL sent to the driver.
+	Params string // Parameter names, types and lengths; values are masked.
+	Err    error  // Error returned by the driver.
+}
+
+func (err *QueryError) Error() string {
+	return fmt.Sprintf("rdb: query %q: %v\nsql: %s\nparams: %s", err.Name, err.Err, err.SQL, err.Params)
+}
+
+// Unwrap returns the error of the driver.
+func (err *QueryError) Unwrap() error {
+	return err.Err
+}
+
+// BadConn reports if the driver error is a bad connection, so the query
+// may still be retried.
+func (err *QueryError) BadConn() bool {
+	return IsBadConn(err.Err)
+}
+
+// Transient reports if the driver error is transient.
+func (err *QueryError) Transient() bool {
+	return IsTransient(err.Err)
+}
+
+// paramText renders the parameters for a QueryError. Values are only
+// included if values is true and the parameter is not NoTrace.
+func paramText(params []Param, values bool) string {
+	if len(params) == 0 {
+		return "none"
+	}
+	var buf bytes.Buffer
+	for i, p := range params {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if len(p.Name) != 0 {
+			buf.WriteString(p.Name)
+		} else {
+			buf.WriteString(strconv.Itoa(i + 1))
+		}
+		fmt.Fprintf(&buf, ": %T", p.Value)
+		length := p.Length
+		switch v := p.Value.(type) {
+		case string:
+			length = len(v)
+		case []byte:
+			length = len(v)
+		}
+		if length > 0 {
+			fmt.Fprintf(&buf, " len %d", length)
+		}
+		if p.Out {
+			buf.WriteString(" out")
+		}
+		if p.Value == nil {
+			continue
+		}
+		if _, ok := p.Value.(io.Reader); ok || !values || p.NoTrace {
+			buf.WriteString(" = ***")
+			continue
+		}
+		if s, ok := p.Value.(string); ok {
+			fmt.Fprintf(&buf, " = %q", s)
+			continue
+		}
+		fmt.Fprintf(&buf, " = %v", p.Value)
+	}
+	return buf.String()
+}
+
+// queryErrorNext wraps errors of the driver in a *QueryError.
+type queryErrorNext struct {
+	Next
+
+	name   string
+	sql    string
+	params []Param
+	values bool
+}
+
+func (n *queryErrorNext) driverNext() Next {
+	return n.Next
+}
+
+func (n *queryErrorNext) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*QueryError); ok {
+		return err
+	}
+	// Context errors are returned as is so they may still be compared.
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+	return &QueryError{Name: n.name, SQL: n.sql, Params: paramText(n.params, n.values), Err: err}
+}
+
+func (n *queryErrorNext) Result() (Result, error) {
+	res, err := n.Next.Result()
+	if res != nil {
+		res = &queryErrorResult{Result: res, next: n}
+	}
+	return res, n.wrap(err)
+}
+
+func (n *queryErrorNext) Buffer() (*Buffer, error) {
+	b, err := n.Next.Buffer()
+	return b, n.wrap(err)
+}
+
+func (n *queryErrorNext) BufferSet() (BufferSet, error) {
+	set, err := n.Next.BufferSet()
+	return set, n.wrap(err)
+}
+
+func (n *queryErrorNext) Close() error {
+	return n.wrap(n.Next.Close())
+}
+
+type queryErrorResult struct {
+	Result
+
+	next *queryErrorNext
+}
+
+func (res *queryErrorResult) Prep(name string, value interface{}) Result {
+	res.Result.Prep(name, value)
+	return res
+}
+
+func (res *queryErrorResult) Prepx(index int, value interface{}) Result {
+	res.Result.Prepx(index, value)
+	return res
+}
+
+func (res *queryErrorResult) Scan() (Row, error) {
+	row, err := res.Result.Scan()
+	return row, res.next.wrap(err)
+}
+
+func (res *queryErrorResult) ScanInto(row *ValueRow) (bool, error) {
+	ok, err := ScanInto(res.Result, row)
+	return ok, res.next.wrap(err)
+}
+
+func (res *queryErrorResult) Close() error {
+	return res.next.wrap(res.Result.Close())
+}
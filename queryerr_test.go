@@ -0,0 +1,95 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestQueryErrorParams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errFail := errors.New("duplicate key")
+	const sql = "insert into Account (ID, Name, Secret) values (?, ?, ?);"
+	params := []rdb.Param{
+		{Value: int64(7)},
+		{Value: "Ann Smith"},
+		{Value: "hunter2", NoTrace: true},
+	}
+	queryErr := func(include, values bool) error {
+		fake := rdbtest.New()
+		fake.Expect(sql).Error(errFail)
+		conf := fake.Config()
+		conf.IncludeParamsInErrors = include
+		conf.UnsafeIncludeParamValues = values
+		pool, err := rdb.Open(ctx, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pool.Close()
+		next := pool.Query(ctx, &rdb.Command{SQL: sql, Name: "addAccount"}, params...)
+		defer next.Close()
+		_, err = next.Buffer()
+		return err
+	}
+
+	if err := queryErr(false, false); err != errFail {
+		t.Fatalf("got %v, want driver error unchanged", err)
+	}
+
+	err := queryErr(true, false)
+	qerr, ok := err.(*rdb.QueryError)
+	if !ok || qerr.Unwrap() != errFail || qerr.Name != "addAccount" || qerr.SQL != sql {
+		t.Fatalf("got error %#v", err)
+	}
+	msg := err.Error()
+	for _, want := range []string{"addAccount", sql, "duplicate key", "1: int64", "2: string len 9", "3: string len 7"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("error %q does not contain %q", msg, want)
+		}
+	}
+	for _, secret := range []string{"Ann Smith", "hunter2", "= 7"} {
+		if strings.Contains(msg, secret) {
+			t.Fatalf("error %q contains value %q", msg, secret)
+		}
+	}
+
+	msg = queryErr(true, true).Error()
+	if !strings.Contains(msg, `2: string len 9 = "Ann Smith"`) || !strings.Contains(msg, "1: int64 = 7") {
+		t.Fatalf("error %q does not contain values", msg)
+	}
+	if strings.Contains(msg, "hunter2") {
+		t.Fatalf("error %q contains NoTrace value", msg)
+	}
+}
+
+func TestQueryErrorContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, want := range []error{context.Canceled, context.DeadlineExceeded} {
+		fake := rdbtest.New()
+		fake.Expect("select 1;").Error(want)
+		conf := fake.Config()
+		conf.IncludeParamsInErrors = true
+		pool, err := rdb.Open(ctx, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := pool.Query(ctx, &rdb.Command{SQL: "select 1;"})
+		if _, err := next.Buffer(); err != want {
+			t.Errorf("got %v, want %v unwrapped", err, want)
+		}
+		next.Close()
+		pool.Close()
+	}
+}
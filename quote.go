@@ -0,0 +1,76 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// QuoteStyle is the quoting syntax a driver uses for identifiers and
+// literals.
+type QuoteStyle byte
+
+// Quote styles declared by drivers.
+const (
+	QuoteANSI     QuoteStyle = iota // Identifiers in "double quotes", PostgreSQL, SQLite and Oracle.
+	QuoteBacktick                   // Identifiers in `backticks`, backslashes escaped in literals, MySQL.
+	QuoteBracket                    // Identifiers in [brackets], SQL Server.
+)
+
+var (
+	errQuoteEmpty   = errors.New("rdb: cannot quote an empty identifier")
+	errQuoteNUL     = errors.New("rdb: cannot quote a value with a NUL byte")
+	errQuoteEncoded = errors.New("rdb: cannot quote a value that is not valid UTF-8")
+)
+
+// QuoteIdentifier returns name quoted as a single identifier, such as a
+// table or column name, using the Quote style of the driver behind q.
+// Embedded quote characters are doubled. A qualified name such as
+// "schema.table" must have each part quoted separately.
+//
+// An error is returned if name is empty, contains a NUL byte or is not
+// valid UTF-8.
+func QuoteIdentifier(q Queryer, name string) (string, error) {
+	if len(name) == 0 {
+		return "", errQuoteEmpty
+	}
+	if err := checkQuote(name); err != nil {
+		return "", err
+	}
+	switch CapabilitiesOf(q).Quote {
+	case QuoteBacktick:
+		return "`" + strings.Replace(name, "`", "``", -1) + "`", nil
+	case QuoteBracket:
+		return "[" + strings.Replace(name, "]", "]]", -1) + "]", nil
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`, nil
+}
+
+// QuoteLiteral returns s as a quoted string literal using the Quote style
+// of the driver behind q. Embedded single quotes are doubled. Parameters
+// should be used for values whenever possible.
+//
+// An error is returned if s contains a NUL byte or is not valid UTF-8.
+func QuoteLiteral(q Queryer, s string) (string, error) {
+	if err := checkQuote(s); err != nil {
+		return "", err
+	}
+	if CapabilitiesOf(q).Quote == QuoteBacktick {
+		s = strings.Replace(s, `\`, `\\`, -1)
+	}
+	return "'" + strings.Replace(s, "'", "''", -1) + "'", nil
+}
+
+func checkQuote(s string) error {
+	if strings.IndexByte(s, 0) >= 0 {
+		return errQuoteNUL
+	}
+	if !utf8.ValidString(s) {
+		return errQuoteEncoded
+	}
+	return nil
+}
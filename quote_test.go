@@ -0,0 +1,58 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+)
+
+func TestQuote(t *testing.T) {
+	list := []struct {
+		style         rdb.QuoteStyle
+		ident, idents string
+		lit, lits     string
+	}{
+		{
+			style: rdb.QuoteANSI,
+			ident: `my"table`, idents: `"my""table"`,
+			lit: `it's a\b`, lits: `'it''s a\b'`,
+		},
+		{
+			style: rdb.QuoteBacktick,
+			ident: "my`table", idents: "`my``table`",
+			lit: `it's a\b`, lits: `'it''s a\\b'`,
+		},
+		{
+			style: rdb.QuoteBracket,
+			ident: "my]table", idents: "[my]]table]",
+			lit: `it's a\b`, lits: `'it''s a\b'`,
+		},
+	}
+	for _, item := range list {
+		fake := rdbtest.New()
+		fake.Quote = item.style
+		got, err := rdb.QuoteIdentifier(fake, item.ident)
+		if err != nil || got != item.idents {
+			t.Errorf("style %d: got identifier %s, error %v, want %s", item.style, got, err, item.idents)
+		}
+		got, err = rdb.QuoteLiteral(fake, item.lit)
+		if err != nil || got != item.lits {
+			t.Errorf("style %d: got literal %s, error %v, want %s", item.style, got, err, item.lits)
+		}
+		for _, bad := range []string{"", "a\x00b", "a\xffb"} {
+			if got, err := rdb.QuoteIdentifier(fake, bad); err == nil {
+				t.Errorf("style %d: identifier %q quoted as %s", item.style, bad, got)
+			}
+		}
+		for _, bad := range []string{"a\x00b", "a\xffb"} {
+			if got, err := rdb.QuoteLiteral(fake, bad); err == nil {
+				t.Errorf("style %d: literal %q quoted as %s", item.style, bad, got)
+			}
+		}
+	}
+}
@@ -12,6 +12,8 @@ package rdb // import "github.com/kardianos/rdb"
 
 import (
 	"bytes"
+	"errors"
+	"time"
 
 	"golang.org/x/net/context"
 )
@@ -80,6 +82,17 @@ type SQLError interface {
 	ErrorCode() int
 }
 
+// InfoMessage is an informational message sent by the server during a
+// query that is not an error, such as from PRINT in SQL Server.
+type InfoMessage struct {
+	Message   string
+	Severity  int
+	State     int
+	Server    string
+	Procedure string
+	Line      int
+}
+
 // ErrorList represents a list of errors.
 type ErrorList struct {
 	List []error
@@ -97,6 +110,13 @@ func (err ErrorList) Error() string {
 	return buf.String()
 }
 
+// ErrNotSupported is returned when the driver does not support a feature.
+var ErrNotSupported = errors.New("rdb: not supported by driver")
+
+// ErrPoolTimeout is returned by drivers when a connection did not become
+// available within Config.PoolWaitTimeout.
+var ErrPoolTimeout = errors.New("rdb: timeout waiting for a connection")
+
 // Connection represents a single connection to the database.
 type Connection interface {
 	// Close returns the connection to the connection pool
@@ -118,6 +138,24 @@ type Transaction interface {
 
 	// Commit the transaction.
 	Commit(ctx context.Context) error
+
+	// Isolation returns the isolation level the transaction was started
+	// with. For a transaction from a pool returned from Open it is the
+	// level resolved for the driver, see Config.StrictIsolation.
+	Isolation() Isolation
+
+	// Prepare the transaction to commit as the first phase of a two-phase
+	// commit. After Prepare only Commit may be called. Drivers that do
+	// not support distributed transactions return ErrNotSupported.
+	Prepare(ctx context.Context) error
+}
+
+// DistributedBeginner may be implemented by a Pool that supports
+// distributed (XA) transactions.
+type DistributedBeginner interface {
+	// BeginDistributed starts a Transaction enlisted in the distributed
+	// transaction identified by xid.
+	BeginDistributed(ctx context.Context, iso Isolation, xid string) (Transaction, error)
 }
 
 // Statement represents a prepared statement. On most systems this takes out
@@ -132,6 +170,18 @@ type Statement interface {
 type PoolStatus interface {
 	Capacity() int
 	Available() int
+
+	// Connections returns the state of each open connection. Drivers that
+	// cannot report connections return nil.
+	Connections() []ConnInfo
+}
+
+// ConnInfo describes a single connection in a pool.
+type ConnInfo struct {
+	Age           time.Duration // Time since the connection was established.
+	QueriesServed int64         // Number of queries run on the connection.
+	Idle          bool          // True if the connection is in the pool.
+	LastUsed      time.Time     // Time the connection was last returned to the pool.
 }
 
 // Row is a way to access data from a cached row.
@@ -157,18 +207,26 @@ type Next interface {
 	// Any subsequent calls to Result or Buffer will return an error.
 	// If the query context is cancelled the result is also closed and the
 	// connection returned to the pool.
+	//
+	// Close is idempotent. Calls after the first return nil and do not
+	// return the connection to the pool again.
 	Close() error
 }
 
 // Result provides a way to iterate over a query result.
 type Result interface {
-	// Prep and Prepx should be called before Scan. If value is a io.Writer
-	// and the driver supports it, the driver may write directly into the value.
-	// Prepared values are not written to the Row buffer returned in Scan.
+	// Prep and Prepx bind a column to a destination pointer for every
+	// row of the result and should be called before the first Scan. If
+	// value is a io.Writer and the driver supports it, the driver may write
+	// directly into the value. Prepared values are not written to the Row
+	// buffer returned in Scan.
 	Prep(name string, value interface{}) Result
 	Prepx(index int, value interface{}) Result
 
-	// Scan will read a Row, populate any values used in Prep.
+	// Scan will read a Row and assign each column bound with Prep to its
+	// destination, returning an error if a value cannot be assigned.
+	// Calling Into or Intox on the Row for a bound column panics with
+	// ErrPrepInto. Drivers may use PrepRow to implement this.
 	// Row will be nil when last row has been read.
 	Scan() (Row, error)
 
@@ -176,7 +234,7 @@ type Result interface {
 	Schema() Schema
 
 	// Close will allow any connection to return to the pool.
-	// Same as calling Next.Close().
+	// Same as calling Next.Close(). Close may be called more then once.
 	Close() error
 }
 
@@ -189,6 +247,9 @@ type Param struct {
 
 	// Parameter Type. Drivers may be able to infer this type.
 	// Check the driver documentation used for more information.
+	// Through a pool returned from Open the Value of a JSON type, see
+	// RegisterJSONType, that is not a string or []byte is marshaled with
+	// encoding/json.
 	Type Type
 
 	// Set to true if the parameter is an output parameter.
@@ -198,11 +259,19 @@ type Param struct {
 	// Do not send this value to the trace.
 	NoTrace bool
 
+	// TruncLongText overrides Command.TruncLongText for the parameter
+	// unless it is FlagDefault.
+	TruncLongText Flag
+
 	// Paremeter Length. Useful for variable length types that may check truncation.
+	// For an io.Reader value it is the number of bytes to stream.
 	Length int
 
 	// Value for input parameter.
 	// If the value is an io.Reader it will read the value directly to the wire.
+	// Through a pool returned from Open exactly Length bytes are read, or
+	// a *ShortReadError is returned. If Length is zero and the reader is an
+	// io.Seeker, Length is set to the bytes remaining.
 	Value interface{}
 }
 
@@ -221,9 +290,93 @@ type Command struct {
 	// If this is set to false text truncation will result in an error.
 	TruncLongText bool
 
-	// Set the isolation level for the query or transaction.
+	// Set the isolation level for the query or transaction. Through a pool
+	// returned from Open IsoDefault uses the level of a context from
+	// WithIsolation.
 	Isolation Isolation
 
+	// ReadOnly declares the command does not write. Drivers may run it on
+	// a read replica or in a read-only transaction. Through a pool returned
+	// from Open it is set if the context is from WithReadOnly.
+	ReadOnly bool
+
+	// Prepare asks the driver to prepare the command on the connection and
+	// reuse it for later commands with the same SQL. Drivers that cannot
+	// prepare ignore it. FlagDefault uses Config.DefaultCommand.
+	Prepare Flag
+
+	// Timeout ends the query with the context deadline error if it does
+	// not finish in time. Zero uses Config.DefaultCommand.
+	Timeout time.Duration
+
+	// Atomic runs the statements of the command in an implicit transaction
+	// that is committed after the last result is read and rolled back if
+	// any statement fails. It has no effect on a command run in a
+	// Transaction or on a Connection. A command with an Isolation level
+	// set is always run in an implicit transaction.
+	Atomic bool
+
+	// Discard reads and drops every result of the command before Query
+	// returns, without keeping the rows, so the returned Next only reports
+	// the error of the command when closed.
+	Discard bool
+
+	// PreRendered sends the SQL and parameters to the driver as is. The
+	// caller has already written them in the native form of the driver, so
+	// placeholders are not rewritten, parameters are not expanded and the
+	// parameter count is not checked. Misuse is left to the driver to
+	// report.
+	PreRendered bool
+
+	// AllowDuplicateParams uses the last of the parameters with the same
+	// name rather then failing with a *DuplicateParamError.
+	AllowDuplicateParams bool
+
+	// AllowUnboundNames leaves a named placeholder without a parameter for
+	// the server to resolve, such as a variable declared in the SQL, when
+	// the driver binds parameters by name. Otherwise a *ArityError is
+	// returned.
+	AllowUnboundNames bool
+
+	// ExpectSingleRow fails Scalar with ErrTooManyRows if the command
+	// returns more then one row rather then ignoring the other rows.
+	ExpectSingleRow bool
+
 	// Optional name of the command. May be used if logging.
 	Name string
+
+	// ColumnMap renames result columns from the name returned by the
+	// database to a logical name. It is applied to the Schema of each
+	// Result and Buffer so Map and IntoStruct see the logical name.
+	ColumnMap map[string]string
+
+	// Converter, if set, is called through a pool returned from Open with
+	// each column value of each row read, after ColumnMap is applied, and
+	// the value it returns is read from the row in its place. An error
+	// fails the Scan or Buffer that read the row. Columns bound with Prep
+	// are set the converted value.
+	Converter Converter
+
+	// ScanMode sets how Collect handles columns without a struct field and
+	// fields without a column, see IntoStructMode.
+	ScanMode ScanMode
+
+	// NullAsZero sets NULL columns to the zero value when scanned into a
+	// scalar destination such as a string rather then failing. Pointer,
+	// slice and sql.Scanner destinations always receive the NULL.
+	NullAsZero bool
+
+	// Hints are driver specific query hints, such as optimizer options.
+	// The driver decides how to apply each hint and ignores hints it does
+	// not know. See the Hint constants for common keys.
+	Hints map[string]string
 }
+
+// Common keys for Command.Hints. Drivers may define their own keys.
+const (
+	HintForceIndex      = "force_index"       // Index name the query should use.
+	HintMaxGrantPercent = "max_grant_percent" // Memory grant limit in percent.
+	HintMaxDOP          = "maxdop"            // Max degree of parallelism.
+	HintRecompile       = "recompile"         // Compile a new plan each time, value ignored.
+	HintTimeout         = "timeout"           // Server side statement timeout in milliseconds.
+)
@@ -0,0 +1,331 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+// Package rdbarrow reads rdb results into Apache Arrow record batches.
+//
+// It is a separate package so the core rdb package does not depend on Arrow.
+package rdbarrow
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/kardianos/rdb"
+)
+
+// DefaultChunkSize is the number of rows per record if the chunk size
+// given to ToArrow is not positive.
+const DefaultChunkSize = 1024
+
+// Reader reads a Result as a sequence of Arrow records.
+// It implements array.RecordReader.
+type Reader struct {
+	res    rdb.Result
+	schema *arrow.Schema
+	chunk  int
+	build  *array.RecordBuilder
+	row    *rdb.ValueRow
+
+	cur  arrow.Record
+	err  error
+	done bool
+	refs int
+}
+
+var _ array.RecordReader = &Reader{}
+
+// ToArrow returns a Reader that reads up to chunkSize rows of the result
+// into each record. The Arrow schema is derived from the result Schema,
+// see FieldType. NULL values are recorded in the validity bitmap.
+//
+// The Reader does not close the result.
+func ToArrow(res rdb.Result, chunkSize int) (*Reader, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	sch := res.Schema()
+	fields := make([]arrow.Field, len(sch))
+	for i, col := range sch {
+		fields[i] = arrow.Field{
+			Name:     col.Name,
+			Type:     FieldType(col),
+			Nullable: true,
+		}
+	}
+	schema := arrow.NewSchema(fields, nil)
+	return &Reader{
+		res:    res,
+		schema: schema,
+		chunk:  chunkSize,
+		build:  array.NewRecordBuilder(memory.DefaultAllocator, schema),
+		row:    rdb.NewValueRow(sch),
+		refs:   1,
+	}, nil
+}
+
+// FieldType returns the Arrow type used for the column. The column Type
+// is used if set, otherwise the Generic type. Decimal, UUID and unknown
+// types are read as text. Times are stored as UTC microseconds.
+func FieldType(col rdb.Column) arrow.DataType {
+	t := col.Type
+	if t == rdb.TypeUnknown {
+		t = col.Generic
+	}
+	switch t {
+	case rdb.Binary, rdb.TypeBinary:
+		return arrow.BinaryTypes.Binary
+	case rdb.Bool, rdb.TypeBool:
+		return arrow.FixedWidthTypes.Boolean
+	case rdb.TypeUint8:
+		return arrow.PrimitiveTypes.Uint8
+	case rdb.TypeUint16:
+		return arrow.PrimitiveTypes.Uint16
+	case rdb.TypeUint32:
+		return arrow.PrimitiveTypes.Uint32
+	case rdb.TypeUint64:
+		return arrow.PrimitiveTypes.Uint64
+	case rdb.TypeInt8:
+		return arrow.PrimitiveTypes.Int8
+	case rdb.TypeInt16, rdb.TypeSerial16:
+		return arrow.PrimitiveTypes.Int16
+	case rdb.TypeInt32, rdb.TypeSerial32:
+		return arrow.PrimitiveTypes.Int32
+	case rdb.Integer, rdb.TypeInt64, rdb.TypeSerial64:
+		return arrow.PrimitiveTypes.Int64
+	case rdb.TypeFloat32:
+		return arrow.PrimitiveTypes.Float32
+	case rdb.Float, rdb.TypeFloat64:
+		return arrow.PrimitiveTypes.Float64
+	case rdb.Time, rdb.TypeTimestampz, rdb.TypeTimestamp:
+		return arrow.FixedWidthTypes.Timestamp_us
+	case rdb.TypeDate:
+		return arrow.FixedWidthTypes.Date32
+	case rdb.TypeTime:
+		return arrow.FixedWidthTypes.Time64us
+	case rdb.TypeDuration:
+		return arrow.FixedWidthTypes.Duration_us
+	}
+	return arrow.BinaryTypes.String
+}
+
+// Schema returns the Arrow schema of the records.
+func (r *Reader) Schema() *arrow.Schema {
+	return r.schema
+}
+
+// Next reads the next record. It returns false when the result has no more
+// rows or on error.
+func (r *Reader) Next() bool {
+	if r.cur != nil {
+		r.cur.Release()
+		r.cur = nil
+	}
+	if r.done {
+		return false
+	}
+	n := 0
+	for n < r.chunk {
+		ok, err := rdb.ScanInto(r.res, r.row)
+		if err != nil {
+			r.err = err
+			r.done = true
+			return false
+		}
+		if !ok {
+			r.done = true
+			break
+		}
+		for i, v := range r.row.Values {
+			if err := appendValue(r.build.Field(i), v); err != nil {
+				r.err = fmt.Errorf("rdbarrow: column %q: %v", r.schema.Field(i).Name, err)
+				r.done = true
+				return false
+			}
+		}
+		n++
+	}
+	if n == 0 {
+		return false
+	}
+	r.cur = r.build.NewRecord()
+	return true
+}
+
+// Record returns the current record. It is valid until the next call to
+// Next or Release. Call Retain on the record to keep it longer.
+func (r *Reader) Record() arrow.Record {
+	return r.cur
+}
+
+// Err returns the error that stopped Next, if any.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Retain increases the reference count of the Reader.
+func (r *Reader) Retain() {
+	r.refs++
+}
+
+// Release decreases the reference count of the Reader and frees its
+// resources when it reaches zero.
+func (r *Reader) Release() {
+	r.refs--
+	if r.refs > 0 {
+		return
+	}
+	if r.cur != nil {
+		r.cur.Release()
+		r.cur = nil
+	}
+	r.build.Release()
+	r.row.Release()
+	r.done = true
+}
+
+func appendValue(b array.Builder, v interface{}) error {
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			b.AppendNull()
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	v = rv.Interface()
+
+	switch b := b.(type) {
+	case *array.StringBuilder:
+		switch v := v.(type) {
+		case string:
+			b.Append(v)
+		case []byte:
+			b.Append(string(v))
+		default:
+			b.Append(fmt.Sprint(v))
+		}
+		return nil
+	case *array.BinaryBuilder:
+		switch v := v.(type) {
+		case []byte:
+			b.Append(v)
+		case string:
+			b.Append([]byte(v))
+		default:
+			return fmt.Errorf("cannot store %T as binary", v)
+		}
+		return nil
+	case *array.BooleanBuilder:
+		if rv.Kind() != reflect.Bool {
+			return fmt.Errorf("cannot store %T as bool", v)
+		}
+		b.Append(rv.Bool())
+		return nil
+	case *array.TimestampBuilder:
+		t, ok := v.(time.Time)
+		if !ok {
+			return fmt.Errorf("cannot store %T as timestamp", v)
+		}
+		b.Append(arrow.Timestamp(t.UnixNano() / int64(time.Microsecond)))
+		return nil
+	case *array.Date32Builder:
+		t, ok := v.(time.Time)
+		if !ok {
+			return fmt.Errorf("cannot store %T as date", v)
+		}
+		y, m, d := t.Date()
+		b.Append(arrow.Date32FromTime(time.Date(y, m, d, 0, 0, 0, 0, time.UTC)))
+		return nil
+	case *array.Time64Builder:
+		var d time.Duration
+		switch v := v.(type) {
+		case time.Time:
+			y, m, day := v.Date()
+			d = v.Sub(time.Date(y, m, day, 0, 0, 0, 0, v.Location()))
+		case time.Duration:
+			d = v
+		default:
+			return fmt.Errorf("cannot store %T as time of day", v)
+		}
+		b.Append(arrow.Time64(d / time.Microsecond))
+		return nil
+	case *array.DurationBuilder:
+		d, ok := v.(time.Duration)
+		if !ok {
+			return fmt.Errorf("cannot store %T as duration", v)
+		}
+		b.Append(arrow.Duration(d / time.Microsecond))
+		return nil
+	case *array.Float32Builder:
+		f, err := toFloat(rv)
+		if err != nil {
+			return err
+		}
+		b.Append(float32(f))
+		return nil
+	case *array.Float64Builder:
+		f, err := toFloat(rv)
+		if err != nil {
+			return err
+		}
+		b.Append(f)
+		return nil
+	}
+
+	i, u, err := toInt(rv)
+	if err != nil {
+		return err
+	}
+	switch b := b.(type) {
+	case *array.Int8Builder:
+		b.Append(int8(i))
+	case *array.Int16Builder:
+		b.Append(int16(i))
+	case *array.Int32Builder:
+		b.Append(int32(i))
+	case *array.Int64Builder:
+		b.Append(i)
+	case *array.Uint8Builder:
+		b.Append(uint8(u))
+	case *array.Uint16Builder:
+		b.Append(uint16(u))
+	case *array.Uint32Builder:
+		b.Append(uint32(u))
+	case *array.Uint64Builder:
+		b.Append(u)
+	default:
+		return fmt.Errorf("unsupported builder %T", b)
+	}
+	return nil
+}
+
+func toInt(rv reflect.Value) (int64, uint64, error) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), uint64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(rv.Uint()), rv.Uint(), nil
+	}
+	return 0, 0, fmt.Errorf("cannot store %s as integer", rv.Type())
+}
+
+func toFloat(rv reflect.Value) (float64, error) {
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	}
+	return 0, fmt.Errorf("cannot store %s as float", rv.Type())
+}
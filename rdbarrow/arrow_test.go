@@ -0,0 +1,130 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdbarrow_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbarrow"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestToArrow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	at := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+	set := rdbtest.NewResult("ID", "Name", "Score", "At").
+		Row(int64(1), "Ann", 1.5, at).
+		Row(int64(2), nil, 2.5, at).
+		Row(int64(3), "Cal", nil, at)
+	set.Schema[0].Type = rdb.TypeInt64
+	set.Schema[1].Type = rdb.TypeText
+	set.Schema[2].Type = rdb.TypeFloat64
+	set.Schema[3].Generic = rdb.Time
+
+	pool := rdbtest.New()
+	pool.Expect("select * from Account;").Returns(set)
+	res, err := pool.Query(ctx, &rdb.Command{SQL: "select * from Account;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+
+	r, err := rdbarrow.ToArrow(res, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+
+	wantTypes := []arrow.DataType{
+		arrow.PrimitiveTypes.Int64,
+		arrow.BinaryTypes.String,
+		arrow.PrimitiveTypes.Float64,
+		arrow.FixedWidthTypes.Timestamp_us,
+	}
+	for i, f := range r.Schema().Fields() {
+		if f.Type != wantTypes[i] || !f.Nullable {
+			t.Errorf("field %d: got %s nullable %t", i, f.Type.Name(), f.Nullable)
+		}
+	}
+
+	var sizes []int64
+	var ids []int64
+	var names []string
+	var scores []float64
+	for r.Next() {
+		rec := r.Record()
+		sizes = append(sizes, rec.NumRows())
+		id := rec.Column(0).(*array.Int64)
+		name := rec.Column(1).(*array.String)
+		score := rec.Column(2).(*array.Float64)
+		ts := rec.Column(3).(*array.Timestamp)
+		for i := 0; i < int(rec.NumRows()); i++ {
+			ids = append(ids, id.Value(i))
+			if name.IsNull(i) {
+				names = append(names, "<null>")
+			} else {
+				names = append(names, name.Value(i))
+			}
+			if score.IsNull(i) {
+				scores = append(scores, -1)
+			} else {
+				scores = append(scores, score.Value(i))
+			}
+			if got := ts.Value(i); got != arrow.Timestamp(at.UnixNano()/1000) {
+				t.Errorf("row %d: got timestamp %d", i, got)
+			}
+		}
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 2 || sizes[0] != 2 || sizes[1] != 1 {
+		t.Errorf("got record sizes %v, want [2 1]", sizes)
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[2] != 3 {
+		t.Errorf("got IDs %v", ids)
+	}
+	if want := []string{"Ann", "<null>", "Cal"}; len(names) != 3 || names[0] != want[0] || names[1] != want[1] || names[2] != want[2] {
+		t.Errorf("got names %v, want %v", names, want)
+	}
+	if want := []float64{1.5, 2.5, -1}; len(scores) != 3 || scores[0] != want[0] || scores[1] != want[1] || scores[2] != want[2] {
+		t.Errorf("got scores %v, want %v", scores, want)
+	}
+}
+
+func TestToArrowTypeMismatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	set := rdbtest.NewResult("N").Row("not a number")
+	set.Schema[0].Type = rdb.TypeInt32
+
+	pool := rdbtest.New()
+	pool.Expect("select N;").Returns(set)
+	res, err := pool.Query(ctx, &rdb.Command{SQL: "select N;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+
+	r, err := rdbarrow.ToArrow(res, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+	if r.Next() {
+		t.Fatal("expected Next to fail")
+	}
+	if r.Err() == nil {
+		t.Fatal("expected conversion error")
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdbtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kardianos/rdb"
+)
+
+// Clock is an rdb.Clock that only moves when advanced. Set it as the
+// Config.Clock of a pool to age its connections without waiting.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+var _ rdb.Clock = &Clock{}
+
+// NewClock returns a clock stopped at start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
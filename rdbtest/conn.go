@@ -0,0 +1,265 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdbtest
+
+import (
+	"time"
+
+	"github.com/kardianos/rdb"
+	"golang.org/x/net/context"
+)
+
+// conn is a simulated physical connection.
+type conn struct {
+	id       int // Session ID, numbered from 1 in the order opened.
+	created  time.Time
+	lastUsed time.Time
+	queries  int64
+	idle     bool
+	prepared map[interface{}]bool // Statement commands or SQL prepared on the connection.
+	schemas  rdb.SchemaCache      // Result schemas of the prepared commands.
+}
+
+// full returns true if the pool is at the PoolMaxCapacity it was opened
+// with. The caller must hold p.mu.
+func (p *Pool) full() bool {
+	return p.opened != nil && p.opened.PoolMaxCapacity > 0 && p.open >= p.opened.PoolMaxCapacity
+}
+
+// acquire takes the most recently used idle connection or opens a new one.
+// If the pool is full it waits for a connection to be returned until the
+// context is done or the PoolWaitTimeout it was opened with elapses.
+func (p *Pool) acquire(ctx context.Context) (*conn, error) {
+	var timeout <-chan time.Time
+	p.mu.Lock()
+	for p.full() {
+		if timeout == nil && p.opened.PoolWaitTimeout > 0 {
+			t := time.NewTimer(p.opened.PoolWaitTimeout)
+			defer t.Stop()
+			timeout = t.C
+		}
+		wait := make(chan struct{})
+		p.waiters = append(p.waiters, wait)
+		p.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			return nil, rdb.ErrPoolTimeout
+		}
+		p.mu.Lock()
+	}
+	conf := p.opened
+	p.reapLocked(conf)
+	var c *conn
+	if n := len(p.idle); n > 0 {
+		c = p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		c.idle = false
+		p.open++
+		p.mu.Unlock()
+		if err := p.validate(conf); err != nil {
+			// The connection is dead, close it and take another.
+			p.mu.Lock()
+			p.open--
+			p.closeConn(c)
+			p.mu.Unlock()
+			return p.acquire(ctx)
+		}
+		return c, nil
+	}
+	p.nextConn++
+	c = &conn{id: p.nextConn, created: conf.Now()}
+	p.conns = append(p.conns, c)
+	p.open++
+	p.mu.Unlock()
+
+	if err := p.connect(ctx, conf); err != nil {
+		p.mu.Lock()
+		p.open--
+		p.wake()
+		p.closeConn(c)
+		p.mu.Unlock()
+		return nil, err
+	}
+	return c, nil
+}
+
+// sessionSQL returns the statements run on each new connection for the
+// configuration.
+func sessionSQL(conf *rdb.Config) []string {
+	if conf == nil {
+		return nil
+	}
+	var list []string
+	if len(conf.Database) != 0 {
+		list = append(list, "USE "+conf.Database+";")
+	}
+	if len(conf.Schema) != 0 {
+		list = append(list, "SET search_path TO "+conf.Schema+";")
+	}
+	return append(list, conf.InitSQL...)
+}
+
+// connect dials a new connection and runs the session statements on it.
+// They are matched against the expectations like any other query.
+func (p *Pool) connect(ctx context.Context, conf *rdb.Config) error {
+	if err := p.dial(ctx, conf); err != nil {
+		return err
+	}
+	for _, sql := range sessionSQL(conf) {
+		e, err := p.match(Call{Op: OpQuery, SQL: sql})
+		if err != nil {
+			return err
+		}
+		if e.err != nil {
+			return e.err
+		}
+	}
+	return nil
+}
+
+// validate runs the validation query of the configuration, if any, on an
+// idle connection before it is handed out. It is matched against the
+// expectations like any other query.
+func (p *Pool) validate(conf *rdb.Config) error {
+	if conf == nil || len(conf.ValidationQuery) == 0 {
+		return nil
+	}
+	e, err := p.match(Call{Op: OpQuery, SQL: conf.ValidationQuery})
+	if err != nil {
+		return err
+	}
+	return e.err
+}
+
+// putConn returns the connection to the idle list, or closes it if the
+// opened configuration retires it or the idle list is full. The caller must hold p.mu.
+func (p *Pool) putConn(c *conn) {
+	p.open--
+	p.wake()
+	if conf := p.opened; conf != nil {
+		if conf.PoolMaxQueriesPerConn > 0 && c.queries >= int64(conf.PoolMaxQueriesPerConn) {
+			p.closeConn(c)
+			return
+		}
+		if n := conf.MaxIdle(); n > 0 && len(p.idle) >= n {
+			p.closeConn(c)
+			return
+		}
+		if max := conf.PoolMaxLifetime; max > 0 && conf.Now().Sub(c.created) >= max {
+			p.closeConn(c)
+			return
+		}
+	}
+	c.idle = true
+	c.lastUsed = p.opened.Now()
+	p.idle = append(p.idle, c)
+}
+
+// reapLocked closes the idle connections that have been idle for the
+// PoolIdleTimeout or are older then the PoolMaxLifetime of the
+// configuration. The caller must hold p.mu.
+func (p *Pool) reapLocked(conf *rdb.Config) {
+	if conf == nil || (conf.PoolIdleTimeout <= 0 && conf.PoolMaxLifetime <= 0) {
+		return
+	}
+	now := conf.Now()
+	idle := p.idle[:0]
+	for _, c := range p.idle {
+		if (conf.PoolIdleTimeout > 0 && now.Sub(c.lastUsed) >= conf.PoolIdleTimeout) ||
+			(conf.PoolMaxLifetime > 0 && now.Sub(c.created) >= conf.PoolMaxLifetime) {
+			p.closeConn(c)
+			continue
+		}
+		idle = append(idle, c)
+	}
+	for i := len(idle); i < len(p.idle); i++ {
+		p.idle[i] = nil
+	}
+	p.idle = idle
+}
+
+// dial simulates establishing a connection. After a failed attempt the
+// next attempt waits for the reconnect backoff.
+func (p *Pool) dial(ctx context.Context, conf *rdb.Config) error {
+	p.mu.Lock()
+	if p.backoff == nil {
+		var policy rdb.Backoff
+		if conf != nil {
+			policy = conf.ReconnectBackoff
+		}
+		p.backoff = rdb.NewBackoffState(policy)
+	}
+	wait := p.retryAt.Sub(conf.Now())
+	p.mu.Unlock()
+
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+	p.mu.Lock()
+	p.dials = append(p.dials, conf.Now())
+	p.mu.Unlock()
+
+	var err error
+	if p.DialFunc != nil {
+		err = p.DialFunc()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialErr = err
+	if err != nil {
+		p.retryAt = conf.Now().Add(p.backoff.Fail())
+		return err
+	}
+	p.backoff.Succeed()
+	p.retryAt = time.Time{}
+	return nil
+}
+
+// wake signals the callers waiting for a connection.
+// The caller must hold p.mu.
+func (p *Pool) wake() {
+	for _, wait := range p.waiters {
+		close(wait)
+	}
+	p.waiters = nil
+}
+
+// closeConn removes the connection from the pool.
+// The caller must hold p.mu.
+func (p *Pool) closeConn(c *conn) {
+	for i, x := range p.conns {
+		if x == c {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			break
+		}
+	}
+	p.stopListenersLocked(c)
+	p.closedConns++
+}
+
+// connInfo reports the state of every open connection.
+// The caller must hold p.mu.
+func (p *Pool) connInfo() []rdb.ConnInfo {
+	now := p.opened.Now()
+	list := make([]rdb.ConnInfo, len(p.conns))
+	for i, c := range p.conns {
+		list[i] = rdb.ConnInfo{
+			Age:           now.Sub(c.created),
+			QueriesServed: c.queries,
+			Idle:          c.idle,
+			LastUsed:      c.lastUsed,
+		}
+	}
+	return list
+}
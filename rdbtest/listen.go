@@ -0,0 +1,121 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdbtest
+
+import (
+	"sync"
+
+	"github.com/kardianos/rdb"
+	"golang.org/x/net/context"
+)
+
+// listener is a channel subscription of a dedicated connection.
+type listener struct {
+	conn    *conn
+	channel string
+	out     chan rdb.Notification
+	done    chan struct{} // Closed when the subscription ends.
+
+	once   sync.Once
+	mu     sync.Mutex // Held while sending to out.
+	closed bool
+}
+
+// end wakes a pending send and the subscription goroutine.
+func (l *listener) end() {
+	l.once.Do(func() { close(l.done) })
+}
+
+// stop ends the subscription and closes out once no send is in progress.
+func (l *listener) stop() {
+	l.end()
+	l.mu.Lock()
+	l.closed = true
+	close(l.out)
+	l.mu.Unlock()
+}
+
+func (l *listener) send(n rdb.Notification) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	select {
+	case l.out <- n:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+// Listen subscribes the connection to notifications sent with Notify.
+func (c *connection) Listen(ctx context.Context, channel string) (<-chan rdb.Notification, error) {
+	l := &listener{
+		conn:    c.conn,
+		channel: channel,
+		out:     make(chan rdb.Notification),
+		done:    make(chan struct{}),
+	}
+	p := c.pool
+	p.mu.Lock()
+	p.listeners = append(p.listeners, l)
+	p.mu.Unlock()
+	rdb.GoSafe(nil, nil, func() error {
+		select {
+		case <-ctx.Done():
+		case <-l.done:
+		}
+		p.mu.Lock()
+		p.removeListenerLocked(l)
+		p.mu.Unlock()
+		l.stop()
+		return nil
+	})
+	return l.out, nil
+}
+
+// Notify sends the payload to every connection listening on the channel,
+// waiting until each has received it. It returns the number of listeners
+// notified.
+func (p *Pool) Notify(channel, payload string) int {
+	p.mu.Lock()
+	var list []*listener
+	for _, l := range p.listeners {
+		if l.channel == channel {
+			list = append(list, l)
+		}
+	}
+	p.mu.Unlock()
+
+	n := rdb.Notification{Channel: channel, Payload: payload}
+	count := 0
+	for _, l := range list {
+		if l.send(n) {
+			count++
+		}
+	}
+	return count
+}
+
+// removeListenerLocked removes the subscription. The caller must hold p.mu.
+func (p *Pool) removeListenerLocked(l *listener) {
+	for i, item := range p.listeners {
+		if item == l {
+			p.listeners = append(p.listeners[:i], p.listeners[i+1:]...)
+			return
+		}
+	}
+}
+
+// stopListenersLocked ends the subscriptions of a connection that is
+// released or lost. The caller must hold p.mu.
+func (p *Pool) stopListenersLocked(c *conn) {
+	for _, l := range p.listeners {
+		if l.conn == c {
+			l.end()
+		}
+	}
+}
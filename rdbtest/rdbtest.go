@@ -0,0 +1,932 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+// Package rdbtest provides a programmable in-memory rdb.Pool for tests.
+//
+// Register the commands the code under test is expected to run along with
+// the result sets or errors they should produce, run the code, then assert
+// the expectations were met and inspect the recorded calls.
+//
+//	pool := rdbtest.New()
+//	pool.Expect("select ID, Name from Account;").Returns(
+//	    rdbtest.NewResult("ID", "Name").Row(int64(1), "Ann"),
+//	)
+//	... run code with pool ...
+//	if err := pool.ExpectationsWereMet(); err != nil {
+//	    t.Fatal(err)
+//	}
+package rdbtest // import "github.com/kardianos/rdb/rdbtest"
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kardianos/rdb"
+	"golang.org/x/net/context"
+)
+
+// Op is the kind of operation recorded in a Call.
+type Op byte
+
+// Operations recorded by the Pool.
+const (
+	OpQuery Op = iota
+	OpPrepare
+	OpBegin
+	OpSavePoint
+	OpRollbackTo
+	OpCommit
+	OpRollback
+	OpConnection
+	OpPing
+	OpPrepareTx
+	OpReleaseSavePoint
+	OpUnprepare
+)
+
+var opNames = [...]string{
+	OpQuery:            "query",
+	OpPrepare:          "prepare",
+	OpBegin:            "begin",
+	OpSavePoint:        "savepoint",
+	OpRollbackTo:       "rollback to",
+	OpCommit:           "commit",
+	OpRollback:         "rollback",
+	OpConnection:       "connection",
+	OpPing:             "ping",
+	OpPrepareTx:        "prepare transaction",
+	OpReleaseSavePoint: "release savepoint",
+	OpUnprepare:        "unprepare",
+}
+
+func (op Op) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return fmt.Sprintf("op(%d)", byte(op))
+}
+
+// Call is a single recorded operation against the Pool.
+type Call struct {
+	Op Op
+
+	// SQL of the command for OpQuery, OpPrepare and OpUnprepare.
+	SQL    string
+	Params []rdb.Param
+
+	// Name of the savepoint for OpSavePoint, OpRollbackTo and
+	// OpReleaseSavePoint.
+	Name string
+
+	// Isolation requested for OpBegin.
+	Isolation rdb.Isolation
+
+	// Tx is the transaction number the call was made in, zero if none.
+	Tx int
+
+	// XID is the distributed transaction ID for OpBegin.
+	XID string
+
+	// Hints of the command for OpQuery and OpPrepare.
+	Hints map[string]string
+
+	// Command as received for OpQuery.
+	Command *rdb.Command
+}
+
+// Expectation is a registered command and the response to give it.
+type Expectation struct {
+	sql      string
+	sets     []*ResultSet
+	err      error
+	lateErr  error
+	once     bool
+	affected int64
+	delay    time.Duration
+	block    bool
+	outputs  []interface{}
+	code     int
+	lastID   int64
+	info     []rdb.InfoMessage
+
+	called int
+}
+
+// Returns sets the result sets returned in order by the command.
+func (e *Expectation) Returns(sets ...*ResultSet) *Expectation {
+	e.sets = sets
+	return e
+}
+
+// Error causes the command to fail with err.
+func (e *Expectation) Error(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// ErrorAfter causes the command to fail with err once the result sets
+// set with Returns have been read, like a later statement of a batch
+// failing.
+func (e *Expectation) ErrorAfter(err error) *Expectation {
+	e.lateErr = err
+	return e
+}
+
+// Affected sets the rows affected reported by the command.
+func (e *Expectation) Affected(n int64) *Expectation {
+	e.affected = n
+	return e
+}
+
+// Output sets the values of the output parameters of the command in the
+// order they are passed. Each output parameter Value must be a pointer to
+// a type the value is assignable to.
+func (e *Expectation) Output(values ...interface{}) *Expectation {
+	e.outputs = values
+	return e
+}
+
+// ReturnCode sets the stored procedure return code reported by the command.
+func (e *Expectation) ReturnCode(code int) *Expectation {
+	e.code = code
+	return e
+}
+
+// LastInsertID sets the generated ID reported by the command.
+func (e *Expectation) LastInsertID(id int64) *Expectation {
+	e.lastID = id
+	return e
+}
+
+// Info sets the informational messages sent to Config.OnInfo while the
+// command runs.
+func (e *Expectation) Info(msgs ...rdb.InfoMessage) *Expectation {
+	e.info = msgs
+	return e
+}
+
+// Delay makes the command take d before it returns, or until the context
+// is done.
+func (e *Expectation) Delay(d time.Duration) *Expectation {
+	e.delay = d
+	return e
+}
+
+// Block makes reading the first result of the command wait until the
+// query is canceled with rdb.CancelQuery, closed, or its context is done,
+// like a long running statement.
+func (e *Expectation) Block() *Expectation {
+	e.block = true
+	return e
+}
+
+// Once removes the expectation after it has been matched once.
+func (e *Expectation) Once() *Expectation {
+	e.once = true
+	return e
+}
+
+// Called returns the number of times the expectation was matched.
+func (e *Expectation) Called() int {
+	return e.called
+}
+
+// ErrUnexpected is returned when a command is run that has no expectation.
+type ErrUnexpected struct {
+	SQL string
+}
+
+func (err ErrUnexpected) Error() string {
+	return fmt.Sprintf("rdbtest: unexpected command %q", err.SQL)
+}
+
+var errClosed = fmt.Errorf("rdbtest: pool closed")
+
+// DriverName is the rdb.Config.DriverName the rdbtest opener responds to.
+const DriverName = "rdbtest"
+
+var registry = struct {
+	sync.Mutex
+	count int
+	pools map[string]*Pool
+}{
+	pools: make(map[string]*Pool),
+}
+
+func init() {
+	rdb.RegisterOpener(opener{})
+}
+
+type opener struct{}
+
+func (opener) CanOpen(config *rdb.Config) bool {
+	return config.DriverName == DriverName
+}
+
+func (opener) Open(ctx context.Context, config *rdb.Config) (rdb.Pool, error) {
+	registry.Lock()
+	p, found := registry.pools[config.Instance]
+	registry.Unlock()
+	if !found {
+		return nil, fmt.Errorf("rdbtest: no pool named %q", config.Instance)
+	}
+	if p.OpenFunc != nil {
+		if err := p.OpenFunc(); err != nil {
+			return nil, err
+		}
+	}
+	p.mu.Lock()
+	p.opened = config
+	p.backoff = nil
+	p.mu.Unlock()
+	return p, nil
+}
+
+// Pool is an in-memory rdb.Pool that responds to registered expectations.
+// It is safe for concurrent use.
+type Pool struct {
+	// PingError is returned from Ping.
+	PingError error
+
+	// PingFunc, if set, is called by Ping instead of returning PingError.
+	PingFunc func(ctx context.Context) error
+
+	// DialFunc, if set, is called each time a new connection is
+	// established. An error fails the connection and the next attempt
+	// waits for the ReconnectBackoff the pool was opened with.
+	DialFunc func() error
+
+	// OpenFunc, if set, is called each time the pool is opened. An error
+	// fails the open, like a driver that cannot reach the server.
+	OpenFunc func() error
+
+	// Capacity reported by Status.
+	Capacity int
+
+	// Style is the placeholder style the pool declares.
+	Style rdb.PlaceholderStyle
+
+	// Positional declares the pool cannot bind parameters by name.
+	Positional bool
+
+	// XA declares the pool supports distributed transactions.
+	XA bool
+
+	// MARS declares connections support multiple active result sets.
+	MARS bool
+
+	// Upsert is the upsert syntax the pool declares.
+	Upsert rdb.UpsertSyntax
+
+	// BulkCopy declares the pool supports bulk copy.
+	BulkCopy bool
+
+	// Returning declares the pool supports a RETURNING clause.
+	Returning bool
+
+	// Quote is the quote style the pool declares.
+	Quote rdb.QuoteStyle
+
+	// Isolations are the isolation levels the pool declares, all levels
+	// if empty.
+	Isolations rdb.IsolationSet
+
+	// InfoSQL is the server info query the pool declares, not supported
+	// if empty.
+	InfoSQL string
+
+	// StrictLength fails a query with a *rdb.TruncError if a text
+	// parameter is longer then its Length and may not be truncated.
+	StrictLength bool
+
+	// Comments are the column descriptions by column name, set on result
+	// columns if the pool is opened with FetchColumnComments.
+	Comments map[string]string
+
+	name string
+
+	mu     sync.Mutex
+	opened *rdb.Config
+	expect []*Expectation
+	calls  []Call
+	open   int // Connections in use.
+	conns  []*conn
+	idle   []*conn
+
+	waiters   []chan struct{} // Closed when a connection is returned.
+	listeners []*listener
+
+	backoff *rdb.BackoffState
+	retryAt time.Time   // Earliest time of the next dial after a failure.
+	dialErr error       // Error of the last dial, nil if it succeeded.
+	dials   []time.Time // Start of each dial attempt.
+
+	closedConns int
+	describes   int
+	nextConn    int
+	nextTx      int
+	closed      bool
+}
+
+var _ rdb.Pool = &Pool{}
+
+// New returns a new Pool with no expectations.
+func New() *Pool {
+	p := &Pool{
+		Capacity: 10,
+	}
+	registry.Lock()
+	registry.count++
+	p.name = fmt.Sprintf("pool%d", registry.count)
+	registry.pools[p.name] = p
+	registry.Unlock()
+	return p
+}
+
+// Config returns a configuration that opens the pool with rdb.Open.
+// Commands run through the opened pool are processed by rdb before
+// they reach this pool.
+func (p *Pool) Config() *rdb.Config {
+	return &rdb.Config{
+		DriverName: DriverName,
+		Instance:   p.name,
+	}
+}
+
+// Dials returns the start time of each attempt to establish a connection.
+func (p *Pool) Dials() []time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]time.Time(nil), p.dials...)
+}
+
+// Backoff returns a copy of the reconnect backoff state.
+func (p *Pool) Backoff() *rdb.BackoffState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.backoff == nil {
+		return &rdb.BackoffState{}
+	}
+	state := *p.backoff
+	return &state
+}
+
+// Opened returns the configuration the pool was last opened with by
+// rdb.Open, or nil if it has not been opened.
+func (p *Pool) Opened() *rdb.Config {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.opened
+}
+
+// ClosedConnections returns the number of connections the pool has closed.
+// Connections are closed when retired by the configuration the pool was
+// opened with.
+func (p *Pool) ClosedConnections() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closedConns
+}
+
+// DriverName returns DriverName.
+func (p *Pool) DriverName() string {
+	return DriverName
+}
+
+// Capabilities returns the capabilities declared by the pool fields.
+// Savepoints are always supported.
+func (p *Pool) Capabilities() rdb.Capabilities {
+	return rdb.Capabilities{
+		PlaceholderStyle:   p.Style,
+		NamedParams:        !p.Positional,
+		MultipleResultSets: p.MARS,
+		BulkCopy:           p.BulkCopy,
+		Savepoints:         true,
+		ReturningClause:    p.Returning,
+		XA:                 p.XA,
+		Upsert:             p.Upsert,
+		Quote:              p.Quote,
+		Isolations:         p.Isolations,
+	}
+}
+
+// ServerInfoSQL returns InfoSQL.
+func (p *Pool) ServerInfoSQL() string {
+	return p.InfoSQL
+}
+
+// Expect registers the SQL as an expected command. By default the command
+// returns no result sets and may be matched any number of times.
+func (p *Pool) Expect(sql string) *Expectation {
+	e := &Expectation{sql: sql}
+	p.mu.Lock()
+	p.expect = append(p.expect, e)
+	p.mu.Unlock()
+	return e
+}
+
+// ExpectationsWereMet returns an error if any expectation was never matched.
+func (p *Pool) ExpectationsWereMet() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var list []error
+	for _, e := range p.expect {
+		if e.called == 0 {
+			list = append(list, fmt.Errorf("rdbtest: expected command %q was not run", e.sql))
+		}
+	}
+	switch len(list) {
+	case 0:
+		return nil
+	case 1:
+		return list[0]
+	}
+	return rdb.ErrorList{List: list}
+}
+
+// Calls returns a copy of the operations run against the pool in order.
+func (p *Pool) Calls() []Call {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	calls := make([]Call, len(p.calls))
+	copy(calls, p.calls)
+	return calls
+}
+
+func (p *Pool) record(c Call) {
+	p.mu.Lock()
+	p.calls = append(p.calls, c)
+	p.mu.Unlock()
+}
+
+// match finds the expectation for the SQL and records the call.
+func (p *Pool) match(c Call) (*Expectation, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Copy the parameters, the caller may reuse the slice once the query
+	// is closed.
+	c.Params = append([]rdb.Param(nil), c.Params...)
+	p.calls = append(p.calls, c)
+	if p.closed {
+		return nil, errClosed
+	}
+	for _, e := range p.expect {
+		if e.sql != c.SQL {
+			continue
+		}
+		if e.once && e.called > 0 {
+			continue
+		}
+		e.called++
+		return e, nil
+	}
+	return nil, ErrUnexpected{SQL: c.SQL}
+}
+
+// query runs the command. If pooled is true a connection is taken from the
+// pool until the result is closed, otherwise the query is counted against
+// the dedicated connection if not nil. If prepared is not nil the command
+// is cached under it on the pooled connection and the result reports if it
+// already was.
+func (p *Pool) query(ctx context.Context, tx int, pooled bool, prepared interface{}, dedicated *conn, cmd *rdb.Command, params []rdb.Param) rdb.Next {
+	if err := ctx.Err(); err != nil {
+		return &next{err: err}
+	}
+	var release func()
+	var queued time.Duration
+	var cacheHit bool
+	var session *conn
+	var schemas *rdb.SchemaCache
+	switch {
+	case pooled:
+		// Acquire first so the session statements of a new connection
+		// are recorded before the query.
+		start := time.Now()
+		c, err := p.acquire(ctx)
+		if err != nil {
+			return &next{err: err}
+		}
+		queued = time.Since(start)
+		session = c
+		p.mu.Lock()
+		c.queries++
+		if prepared != nil {
+			cacheHit = c.prepared[prepared]
+			if c.prepared == nil {
+				c.prepared = make(map[interface{}]bool)
+			}
+			c.prepared[prepared] = true
+			if !cacheHit {
+				c.schemas.Invalidate(prepared)
+			}
+			if p.opened != nil && p.opened.CacheSchema {
+				schemas = &c.schemas
+			}
+		}
+		p.mu.Unlock()
+		release = func() {
+			p.mu.Lock()
+			p.putConn(c)
+			p.mu.Unlock()
+		}
+	case dedicated != nil:
+		session = dedicated
+		p.mu.Lock()
+		dedicated.queries++
+		p.mu.Unlock()
+	}
+	params, err := p.truncate(cmd, params)
+	if err != nil {
+		if release != nil {
+			release()
+		}
+		return &next{err: err}
+	}
+	e, err := p.match(Call{Op: OpQuery, SQL: cmd.SQL, Params: params, Tx: tx, Hints: cmd.Hints, Command: cmd})
+	if err != nil {
+		if release != nil {
+			release()
+		}
+		return &next{err: err}
+	}
+	if e.delay > 0 {
+		t := time.NewTimer(e.delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+		}
+	}
+	p.mu.Lock()
+	conf := p.opened
+	p.mu.Unlock()
+	if conf != nil && conf.OnInfo != nil {
+		for _, msg := range e.info {
+			conf.OnInfo(msg)
+		}
+	}
+	err = e.err
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		if release != nil {
+			release()
+		}
+		return &next{err: err, queued: queued}
+	}
+	if err := setOutputs(params, e.outputs); err != nil {
+		if release != nil {
+			release()
+		}
+		return &next{err: err}
+	}
+	n := newNext(ctx, cmd, e, release)
+	n.queued = queued
+	n.cacheHit = cacheHit
+	n.describe = func(index int, rs *ResultSet) rdb.Schema {
+		if schemas == nil {
+			return p.describeSchema(rs)
+		}
+		if sch, ok := schemas.Get(prepared, index); ok {
+			return sch
+		}
+		sch := p.describeSchema(rs)
+		schemas.Put(prepared, index, sch)
+		return sch
+	}
+	if session != nil {
+		n.session = strconv.Itoa(session.id)
+	}
+	return n
+}
+
+// truncate returns the params with text values cut to the Length of the
+// parameter if rdb.TruncLongText allows it, like a driver fitting them to
+// their columns. Otherwise text longer then the Length is an error if
+// StrictLength is set.
+func (p *Pool) truncate(cmd *rdb.Command, params []rdb.Param) ([]rdb.Param, error) {
+	p.mu.Lock()
+	conf := p.opened
+	p.mu.Unlock()
+	if conf == nil {
+		conf = &rdb.Config{}
+	}
+	var out []rdb.Param
+	for i, param := range params {
+		text, ok := param.Value.(string)
+		if !ok || param.Length <= 0 {
+			continue
+		}
+		if !rdb.TruncLongText(cmd, param) {
+			if n := utf8.RuneCountInString(text); p.StrictLength && n > param.Length {
+				return nil, &rdb.TruncError{Column: param.Name, Length: n, Max: param.Length}
+			}
+			continue
+		}
+		cut := conf.TruncText(param.Name, text, param.Length)
+		if len(cut) == len(text) {
+			continue
+		}
+		if out == nil {
+			out = append([]rdb.Param(nil), params...)
+		}
+		out[i].Value = cut
+	}
+	if out == nil {
+		return params, nil
+	}
+	return out, nil
+}
+
+// describeSchema returns a copy of the schema of the result set, like a
+// driver reading the column metadata sent by the server.
+func (p *Pool) describeSchema(rs *ResultSet) rdb.Schema {
+	p.mu.Lock()
+	p.describes++
+	comments := p.opened != nil && p.opened.FetchColumnComments
+	p.mu.Unlock()
+	sch := append(rdb.Schema(nil), rs.Schema...)
+	if comments {
+		for i := range sch {
+			sch[i].Comment = p.Comments[sch[i].Name]
+		}
+	}
+	return sch
+}
+
+// Describes returns the number of result schemas described, which does
+// not include schemas taken from the SchemaCache of a connection.
+func (p *Pool) Describes() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.describes
+}
+
+// Unprepare drops the statements prepared on every connection, like a
+// server discarding its plans after a schema change. The next execution
+// prepares the statement again and describes its results.
+func (p *Pool) Unprepare() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.conns {
+		c.prepared = nil
+	}
+}
+
+// setOutputs assigns the values to the output parameters in order.
+func setOutputs(params []rdb.Param, values []interface{}) error {
+	i := 0
+	for _, p := range params {
+		if !p.Out || i >= len(values) {
+			continue
+		}
+		dest := reflect.ValueOf(p.Value)
+		if dest.Kind() != reflect.Ptr || dest.IsNil() {
+			return fmt.Errorf("rdbtest: output parameter %q value is not a pointer", p.Name)
+		}
+		if values[i] == nil {
+			dest.Elem().Set(reflect.Zero(dest.Elem().Type()))
+		} else {
+			v := reflect.ValueOf(values[i])
+			if !v.Type().AssignableTo(dest.Elem().Type()) {
+				return fmt.Errorf("rdbtest: cannot assign output %T to %s", values[i], dest.Elem().Type())
+			}
+			dest.Elem().Set(v)
+		}
+		i++
+	}
+	return nil
+}
+
+// Query runs the command against the registered expectations. A command
+// with Prepare set to rdb.FlagTrue is prepared on the connection by its SQL
+// and reused by later commands with the same SQL.
+func (p *Pool) Query(ctx context.Context, cmd *rdb.Command, params ...rdb.Param) rdb.Next {
+	var prepared interface{}
+	if cmd.Prepare == rdb.FlagTrue {
+		prepared = cmd.SQL
+	}
+	return p.query(ctx, 0, true, prepared, nil, cmd, params)
+}
+
+// Prepare records the command and returns a statement that runs it.
+// The command does not need to be expected until it is executed.
+func (p *Pool) Prepare(ctx context.Context, cmd *rdb.Command) (rdb.Statement, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p.record(Call{Op: OpPrepare, SQL: cmd.SQL, Hints: cmd.Hints})
+	if ctx.Done() != nil {
+		rdb.GoSafe(nil, nil, func() error {
+			<-ctx.Done()
+			p.unprepare(cmd)
+			return nil
+		})
+	}
+	return &statement{pool: p, cmd: cmd, ctx: ctx}, nil
+}
+
+// unprepare removes the closed statement from every connection.
+func (p *Pool) unprepare(cmd *rdb.Command) {
+	p.mu.Lock()
+	for _, c := range p.conns {
+		delete(c.prepared, cmd)
+		c.schemas.Invalidate(cmd)
+	}
+	p.mu.Unlock()
+	p.record(Call{Op: OpUnprepare, SQL: cmd.SQL})
+}
+
+// Prepared returns the number of connections the SQL is prepared on.
+func (p *Pool) Prepared(sql string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, c := range p.conns {
+		for key := range c.prepared {
+			if cmd, ok := key.(*rdb.Command); ok {
+				key = cmd.SQL
+			}
+			if key == sql {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// Begin starts a new transaction.
+func (p *Pool) Begin(ctx context.Context, iso rdb.Isolation) (rdb.Transaction, error) {
+	return p.begin(ctx, iso, "")
+}
+
+// BeginDistributed starts a transaction enlisted in xid if XA is set.
+func (p *Pool) BeginDistributed(ctx context.Context, iso rdb.Isolation, xid string) (rdb.Transaction, error) {
+	if !p.XA {
+		return nil, rdb.ErrNotSupported
+	}
+	return p.begin(ctx, iso, xid)
+}
+
+func (p *Pool) begin(ctx context.Context, iso rdb.Isolation, xid string) (rdb.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errClosed
+	}
+	p.nextTx++
+	tx := &transaction{pool: p, id: p.nextTx, iso: iso, xid: xid}
+	p.calls = append(p.calls, Call{Op: OpBegin, Isolation: iso, Tx: tx.id, XID: xid})
+	p.mu.Unlock()
+
+	rdb.GoSafe(nil, nil, func() error {
+		<-ctx.Done()
+		tx.rollback()
+		return nil
+	})
+	return tx, nil
+}
+
+// Connection returns a dedicated connection. It counts against the
+// capacity of the pool until it is closed.
+func (p *Pool) Connection(ctx context.Context) (rdb.Connection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errClosed
+	}
+	p.calls = append(p.calls, Call{Op: OpConnection})
+	p.mu.Unlock()
+
+	dedicated, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := &connection{pool: p, conn: dedicated}
+
+	rdb.GoSafe(nil, nil, func() error {
+		<-ctx.Done()
+		c.Close()
+		return nil
+	})
+	return c, nil
+}
+
+// Healthy returns false if the pool is closed, or if the last dial failed
+// and no connection is open.
+func (p *Pool) Healthy() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false, rdb.ErrPoolClosed
+	}
+	if p.dialErr != nil && len(p.conns) == 0 {
+		return false, p.dialErr
+	}
+	return true, nil
+}
+
+// Ping returns PingError or the result of PingFunc.
+func (p *Pool) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.record(Call{Op: OpPing})
+	if p.PingFunc != nil {
+		return p.PingFunc(ctx)
+	}
+	return p.PingError
+}
+
+// Close the pool. Subsequent operations return an error.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+}
+
+// Status of the pool.
+func (p *Pool) Status() rdb.PoolStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return status{capacity: p.Capacity, available: p.Capacity - p.open, conns: p.connInfo()}
+}
+
+type status struct {
+	capacity  int
+	available int
+	conns     []rdb.ConnInfo
+}
+
+func (s status) Capacity() int               { return s.capacity }
+func (s status) Available() int              { return s.available }
+func (s status) Connections() []rdb.ConnInfo { return s.conns }
+
+type connection struct {
+	pool *Pool
+	conn *conn
+
+	once sync.Once
+}
+
+func (c *connection) Query(ctx context.Context, cmd *rdb.Command, params ...rdb.Param) rdb.Next {
+	return c.pool.query(ctx, 0, false, nil, c.conn, cmd, params)
+}
+
+// DriverName returns DriverName.
+func (c *connection) DriverName() string {
+	return DriverName
+}
+
+// Capabilities returns the capabilities of the pool of the connection.
+func (c *connection) Capabilities() rdb.Capabilities {
+	return c.pool.Capabilities()
+}
+
+// SessionID returns the number of the connection in the order opened.
+func (c *connection) SessionID() (string, error) {
+	return strconv.Itoa(c.conn.id), nil
+}
+
+func (c *connection) Close() {
+	c.once.Do(func() {
+		c.pool.mu.Lock()
+		c.pool.stopListenersLocked(c.conn)
+		c.pool.putConn(c.conn)
+		c.pool.mu.Unlock()
+	})
+}
+
+type statement struct {
+	pool *Pool
+	cmd  *rdb.Command
+	ctx  context.Context // Done when the statement is closed.
+}
+
+var errStmtClosed = fmt.Errorf("rdbtest: statement closed")
+
+func (s *statement) Exec(ctx context.Context, params ...rdb.Param) rdb.Next {
+	if s.ctx.Err() != nil {
+		return &next{err: errStmtClosed}
+	}
+	return s.pool.query(ctx, 0, true, s.cmd, nil, s.cmd, params)
+}
@@ -0,0 +1,246 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdbtest_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestQuery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := rdbtest.New()
+	pool.Expect("select ID, Name from Account where ID > ?;").Returns(
+		rdbtest.NewResult("ID", "Name").
+			Row(int64(1), "Ann").
+			Row(int64(2), nil),
+	)
+
+	res, err := pool.Query(ctx, &rdb.Command{SQL: "select ID, Name from Account where ID > ?;"}, rdb.Param{Value: 0}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+
+	var ids []int64
+	var names []*string
+	for {
+		row, err := res.Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row == nil {
+			break
+		}
+		var id int64
+		var name *string
+		row.Into("ID", &id).Into("Name", &name)
+		ids = append(ids, id)
+		names = append(names, name)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Errorf("got IDs %v", ids)
+	}
+	if names[0] == nil || *names[0] != "Ann" || names[1] != nil {
+		t.Errorf("got names %v", names)
+	}
+	if err := pool.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	calls := pool.Calls()
+	if len(calls) != 1 || calls[0].Op != rdbtest.OpQuery || len(calls[0].Params) != 1 {
+		t.Fatalf("unexpected calls %+v", calls)
+	}
+}
+
+func TestMultipleResultSets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := rdbtest.New()
+	pool.Expect("exec Report;").Returns(
+		rdbtest.NewResult("A").Row(1).Row(2),
+		rdbtest.NewResult("B", "C").Row("x", "y"),
+	)
+	set, err := pool.Query(ctx, &rdb.Command{SQL: "exec Report;"}).BufferSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 2 {
+		t.Fatalf("got %d buffers, want 2", len(set))
+	}
+	if len(set[0].Row) != 2 || set[0].Row[1].Get("A") != 2 {
+		t.Errorf("unexpected first buffer %+v", set[0])
+	}
+	if len(set[1].Schema) != 2 || set[1].Row[0].Getx(1) != "y" {
+		t.Errorf("unexpected second buffer %+v", set[1])
+	}
+}
+
+func TestTransactionSavePoint(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := rdbtest.New()
+	pool.Expect("insert into Log values (1);")
+	pool.Expect("insert into Log values (2);")
+
+	tx, err := pool.Begin(ctx, rdb.IsoSerializable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(sql string) {
+		if err := tx.Query(ctx, &rdb.Command{SQL: sql}).Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("insert into Log values (1);")
+	if err := tx.SavePoint(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	run("insert into Log values (2);")
+	if err := tx.RollbackTo(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.RollbackTo(ctx, "missing"); err == nil {
+		t.Fatal("expected error rolling back to missing savepoint")
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(ctx); err == nil {
+		t.Fatal("expected error committing twice")
+	}
+
+	var ops []rdbtest.Op
+	for _, c := range pool.Calls() {
+		if c.Tx != 1 {
+			t.Errorf("call %v not in transaction", c.Op)
+		}
+		ops = append(ops, c.Op)
+	}
+	want := []rdbtest.Op{
+		rdbtest.OpBegin,
+		rdbtest.OpQuery,
+		rdbtest.OpSavePoint,
+		rdbtest.OpQuery,
+		rdbtest.OpRollbackTo,
+		rdbtest.OpCommit,
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("got ops %v, want %v", ops, want)
+	}
+}
+
+func TestErrorInjection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	injected := errors.New("deadlock victim")
+	pool := rdbtest.New()
+	pool.Expect("update Account set Name = 'B';").Error(injected)
+
+	_, err := pool.Query(ctx, &rdb.Command{SQL: "update Account set Name = 'B';"}).Buffer()
+	if err != injected {
+		t.Fatalf("got %v, want injected error", err)
+	}
+
+	_, err = pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Buffer()
+	if _, is := err.(rdbtest.ErrUnexpected); !is {
+		t.Fatalf("got %v, want ErrUnexpected", err)
+	}
+
+	pool.Expect("never run;")
+	if err := pool.ExpectationsWereMet(); err == nil {
+		t.Fatal("expected unmet expectation error")
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := rdbtest.New()
+	pool.Expect("select 1;").Returns(rdbtest.NewResult("V").Row(1))
+
+	capacity := pool.Status().Available()
+	res, err := pool.Query(ctx, &rdb.Command{SQL: "select 1;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pool.Status().Available(); got != capacity-1 {
+		t.Fatalf("got %d available during query, want %d", got, capacity-1)
+	}
+	if err := res.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := res.Close(); err != nil {
+		t.Fatalf("second close returned %v", err)
+	}
+	if got := pool.Status().Available(); got != capacity {
+		t.Fatalf("got %d available after close, want %d", got, capacity)
+	}
+}
+
+func TestConnections(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := rdbtest.New()
+	pool.Capacity = 2
+	pool.Expect("select 1;")
+
+	run := func() rdb.Next {
+		return pool.Query(ctx, &rdb.Command{SQL: "select 1;"})
+	}
+	if conns := pool.Status().Connections(); len(conns) != 0 {
+		t.Fatalf("got %d connections before first query", len(conns))
+	}
+
+	// Sequential queries reuse the same connection.
+	for i := 0; i < 3; i++ {
+		if err := run().Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conns := pool.Status().Connections()
+	if len(conns) != 1 || conns[0].QueriesServed != 3 || !conns[0].Idle {
+		t.Fatalf("after sequential queries got %+v", conns)
+	}
+	firstUsed := conns[0].LastUsed
+	firstAge := conns[0].Age
+
+	// Two concurrent queries need a second connection.
+	time.Sleep(time.Millisecond)
+	a, b := run(), run()
+	conns = pool.Status().Connections()
+	if len(conns) != 2 || conns[0].Idle || conns[1].Idle {
+		t.Fatalf("during concurrent queries got %+v", conns)
+	}
+	a.Close()
+	b.Close()
+
+	conns = pool.Status().Connections()
+	if conns[0].QueriesServed+conns[1].QueriesServed != 5 {
+		t.Errorf("got %d and %d queries served, want 5 total", conns[0].QueriesServed, conns[1].QueriesServed)
+	}
+	if conns[0].Age <= firstAge || conns[1].Age >= conns[0].Age {
+		t.Errorf("unexpected ages %v and %v", conns[0].Age, conns[1].Age)
+	}
+	if !conns[0].LastUsed.After(firstUsed) {
+		t.Errorf("last used not updated: %v", conns[0].LastUsed)
+	}
+	if !conns[0].Idle || !conns[1].Idle {
+		t.Errorf("connections not idle after close %+v", conns)
+	}
+}
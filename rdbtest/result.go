@@ -0,0 +1,443 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdbtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"golang.org/x/net/context"
+)
+
+// ResultSet is a scripted result returned by an Expectation.
+type ResultSet struct {
+	Name   string
+	Schema rdb.Schema
+	Rows   [][]interface{}
+
+	read int64 // Rows read by all queries, accessed atomically.
+}
+
+// Read returns the number of rows of the set read by all queries, through
+// Scan or Buffer.
+func (rs *ResultSet) Read() int {
+	return int(atomic.LoadInt64(&rs.read))
+}
+
+// NewResult creates a ResultSet with the named columns.
+func NewResult(columns ...string) *ResultSet {
+	sch := make(rdb.Schema, len(columns))
+	for i, name := range columns {
+		sch[i] = rdb.Column{
+			Name:  name,
+			Index: i,
+		}
+	}
+	return &ResultSet{Schema: sch}
+}
+
+// Row appends a row of values to the result set. The number of values
+// must match the number of columns.
+func (rs *ResultSet) Row(values ...interface{}) *ResultSet {
+	if len(values) != len(rs.Schema) {
+		panic(fmt.Sprintf("rdbtest: row has %d values, result has %d columns", len(values), len(rs.Schema)))
+	}
+	rs.Rows = append(rs.Rows, values)
+	return rs
+}
+
+var errNextClosed = fmt.Errorf("rdbtest: result closed")
+
+type next struct {
+	err error
+	cmd *rdb.Command
+
+	mu       sync.Mutex
+	sets     []*ResultSet
+	lateErr  error
+	index    int
+	affected int64
+	queued   time.Duration
+	code     int
+	lastID   int64
+	cacheHit bool
+	session  string
+	closed   bool
+	block    bool
+	stop     chan struct{} // Closed when the query is canceled or closed.
+	describe func(index int, rs *ResultSet) rdb.Schema
+	ctx      context.Context
+	cancel   func()
+	release  func() // Return the connection to the pool.
+}
+
+func newNext(ctx context.Context, cmd *rdb.Command, e *Expectation, release func()) *next {
+	n := &next{
+		cmd:      cmd,
+		sets:     e.sets,
+		lateErr:  e.lateErr,
+		affected: e.affected,
+		code:     e.code,
+		lastID:   e.lastID,
+		block:    e.block,
+		stop:     make(chan struct{}),
+		ctx:      ctx,
+		release:  release,
+	}
+	ctx, n.cancel = context.WithCancel(ctx)
+	rdb.GoSafe(nil, nil, func() error {
+		<-ctx.Done()
+		return n.Close()
+	})
+	return n
+}
+
+// wait blocks the first read of a blocking query until it is stopped.
+func (n *next) wait() {
+	n.mu.Lock()
+	block := n.block
+	n.block = false
+	n.mu.Unlock()
+	if !block {
+		return
+	}
+	select {
+	case <-n.stop:
+	case <-n.ctx.Done():
+	}
+	n.mu.Lock()
+	if n.err == nil {
+		n.err = n.ctx.Err()
+	}
+	n.mu.Unlock()
+}
+
+// stopLocked wakes a blocked read. The caller must hold n.mu.
+func (n *next) stopLocked() {
+	if n.stop == nil {
+		return
+	}
+	select {
+	case <-n.stop:
+	default:
+		close(n.stop)
+	}
+}
+
+// advance returns the next result set and its index or nil when none
+// remain.
+func (n *next) advance() (*ResultSet, int, error) {
+	n.wait()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.err != nil {
+		return nil, 0, n.err
+	}
+	if n.closed {
+		return nil, 0, errNextClosed
+	}
+	if n.index >= len(n.sets) {
+		n.err = n.lateErr
+		return nil, 0, n.err
+	}
+	rs := n.sets[n.index]
+	n.index++
+	return rs, n.index - 1, nil
+}
+
+// schema returns the described schema of the result set at index.
+func (n *next) schema(index int, rs *ResultSet) rdb.Schema {
+	if n.describe == nil {
+		return rs.Schema
+	}
+	return n.describe(index, rs)
+}
+
+func (n *next) Result() (rdb.Result, error) {
+	rs, index, err := n.advance()
+	if rs == nil {
+		if err == nil {
+			n.Close()
+		}
+		return nil, err
+	}
+	return &result{next: n, set: rs, schema: n.schema(index, rs)}, nil
+}
+
+func (n *next) Buffer() (*rdb.Buffer, error) {
+	rs, index, err := n.advance()
+	if rs == nil {
+		if err == nil {
+			n.Close()
+		}
+		return nil, err
+	}
+	sch := n.schema(index, rs)
+	atomic.AddInt64(&rs.read, int64(len(rs.Rows)))
+	buf := &rdb.Buffer{
+		Name:   rs.Name,
+		Schema: sch,
+		Row:    make([]rdb.Row, len(rs.Rows)),
+	}
+	for i, values := range rs.Rows {
+		vr := rdb.NewValueRow(sch)
+		vr.NullAsZero = n.cmd.NullAsZero
+		copy(vr.Values, values)
+		buf.Row[i] = vr
+	}
+	return buf, nil
+}
+
+func (n *next) BufferSet() (rdb.BufferSet, error) {
+	var set rdb.BufferSet
+	for {
+		buf, err := n.Buffer()
+		if err != nil {
+			return set, err
+		}
+		if buf == nil {
+			return set, nil
+		}
+		set = append(set, buf)
+	}
+}
+
+func (n *next) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return nil
+	}
+	n.closed = true
+	n.stopLocked()
+	if n.cancel != nil {
+		n.cancel()
+	}
+	if n.release != nil {
+		n.release()
+	}
+	return n.err
+}
+
+// Discard skips the remaining result sets without building their rows.
+func (n *next) Discard() error {
+	for {
+		rs, _, err := n.advance()
+		if rs == nil {
+			return err
+		}
+	}
+}
+
+// Cancel fails the query with rdb.ErrCanceled.
+func (n *next) Cancel() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return nil
+	}
+	if n.err == nil {
+		n.err = rdb.ErrCanceled
+	}
+	n.stopLocked()
+	return nil
+}
+
+// RowsAffected returns the affected count set on the Expectation.
+func (n *next) RowsAffected() int64 {
+	return n.affected
+}
+
+// ReturnCode returns the return code set on the Expectation.
+func (n *next) ReturnCode() int {
+	return n.code
+}
+
+// LastInsertID returns the ID set on the Expectation.
+func (n *next) LastInsertID() (int64, error) {
+	return n.lastID, nil
+}
+
+// PreparedCacheHit returns true if the statement was already prepared on
+// the connection.
+func (n *next) PreparedCacheHit() bool {
+	return n.cacheHit
+}
+
+// SessionID returns the session of the connection the query ran on, empty
+// in a transaction.
+func (n *next) SessionID() (string, error) {
+	return n.session, nil
+}
+
+// Queued returns the time the query waited for a connection.
+func (n *next) Queued() time.Duration {
+	return n.queued
+}
+
+type result struct {
+	next   *next
+	set    *ResultSet
+	schema rdb.Schema
+	pos    int
+
+	prep map[int]interface{}
+	raw  []byte // Wire buffer shared by the rows of the result.
+}
+
+func (r *result) Prep(name string, value interface{}) rdb.Result {
+	for _, col := range r.schema {
+		if col.Name == name {
+			return r.Prepx(col.Index, value)
+		}
+	}
+	panic(fmt.Sprintf("rdbtest: column %q not in result", name))
+}
+
+func (r *result) Prepx(index int, value interface{}) rdb.Result {
+	if r.prep == nil {
+		r.prep = make(map[int]interface{})
+	}
+	r.prep[index] = value
+	return r
+}
+
+// values returns the next scripted row or nil after the last row.
+func (r *result) values() ([]interface{}, error) {
+	r.next.mu.Lock()
+	closed := r.next.closed
+	r.next.mu.Unlock()
+	if closed {
+		return nil, errNextClosed
+	}
+	if r.pos >= len(r.set.Rows) {
+		return nil, nil
+	}
+	values := r.set.Rows[r.pos]
+	r.pos++
+	atomic.AddInt64(&r.set.read, 1)
+	return values, nil
+}
+
+func (r *result) Scan() (rdb.Row, error) {
+	values, err := r.values()
+	if values == nil {
+		return nil, err
+	}
+	return rdb.PrepRow(newRow(r, values), r.schema, r.prep)
+}
+
+// ScanInto copies the next row into the caller's row without allocating.
+func (r *result) ScanInto(row *rdb.ValueRow) (bool, error) {
+	values, err := r.values()
+	if values == nil {
+		return false, err
+	}
+	row.Schema = r.schema
+	row.Values = append(row.Values[:0], values...)
+	row.NullAsZero = r.next.cmd.NullAsZero
+	for index, dest := range r.prep {
+		row.Intox(index, dest)
+	}
+	return true, nil
+}
+
+func (r *result) Schema() rdb.Schema {
+	return r.schema
+}
+
+func (r *result) Close() error {
+	return r.next.Close()
+}
+
+// RowsAffected returns the affected count set on the Expectation.
+func (r *result) RowsAffected() int64 {
+	return r.next.affected
+}
+
+type row struct {
+	*rdb.ValueRow
+
+	res *result
+}
+
+func newRow(res *result, values []interface{}) *row {
+	return &row{
+		ValueRow: &rdb.ValueRow{
+			Schema:     res.schema,
+			Values:     values,
+			NullAsZero: res.next.cmd.NullAsZero,
+		},
+		res: res,
+	}
+}
+
+// Raw returns the text form of the column in a buffer that is reused by
+// every row of the result, like a driver reading from the wire.
+func (r *row) Raw(name string) ([]byte, error) {
+	for i, col := range r.Schema {
+		if col.Name == name {
+			return r.Rawx(i)
+		}
+	}
+	return nil, fmt.Errorf("rdbtest: column %q not in result", name)
+}
+
+// Rawx returns the text form of the column at index.
+func (r *row) Rawx(index int) ([]byte, error) {
+	raw := r.res.raw[:0]
+	if raw == nil {
+		raw = make([]byte, 0, 64)
+	}
+	switch v := r.Values[index].(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		raw = append(raw, v...)
+	case string:
+		raw = append(raw, v...)
+	default:
+		raw = append(raw, fmt.Sprint(v)...)
+	}
+	r.res.raw = raw
+	return raw, nil
+}
+
+// GetReader streams the column if the scripted value is an io.Reader.
+func (r *row) GetReader(name string) (io.ReadCloser, error) {
+	for i, col := range r.Schema {
+		if col.Name == name {
+			return r.GetReaderx(i)
+		}
+	}
+	return nil, fmt.Errorf("rdbtest: column %q not in result", name)
+}
+
+// GetReaderx streams the column if the scripted value is an io.Reader.
+func (r *row) GetReaderx(index int) (io.ReadCloser, error) {
+	switch v := r.Values[index].(type) {
+	case io.ReadCloser:
+		return v, nil
+	case io.Reader:
+		return ioutil.NopCloser(v), nil
+	case []byte:
+		return ioutil.NopCloser(bytes.NewReader(v)), nil
+	case string:
+		return ioutil.NopCloser(strings.NewReader(v)), nil
+	case nil:
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	return nil, fmt.Errorf("rdbtest: cannot read column value of type %T", r.Values[index])
+}
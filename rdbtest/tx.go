@@ -0,0 +1,144 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdbtest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/kardianos/rdb"
+	"golang.org/x/net/context"
+)
+
+var (
+	errTxDone     = fmt.Errorf("rdbtest: transaction already committed or rolled back")
+	errTxPrepared = fmt.Errorf("rdbtest: transaction prepared, only commit allowed")
+)
+
+type transaction struct {
+	pool *Pool
+	id   int
+	iso  rdb.Isolation
+	xid  string
+
+	mu         sync.Mutex
+	done       bool
+	prepared   bool
+	savepoints []string
+}
+
+func (tx *transaction) Query(ctx context.Context, cmd *rdb.Command, params ...rdb.Param) rdb.Next {
+	tx.mu.Lock()
+	done, prepared := tx.done, tx.prepared
+	tx.mu.Unlock()
+	if done {
+		return &next{err: errTxDone}
+	}
+	if prepared {
+		return &next{err: errTxPrepared}
+	}
+	return tx.pool.query(ctx, tx.id, false, nil, nil, cmd, params)
+}
+
+// Isolation returns the level the transaction was started with.
+func (tx *transaction) Isolation() rdb.Isolation {
+	return tx.iso
+}
+
+func (tx *transaction) SavePoint(ctx context.Context, name string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return errTxDone
+	}
+	if tx.prepared {
+		return errTxPrepared
+	}
+	tx.savepoints = append(tx.savepoints, name)
+	tx.pool.record(Call{Op: OpSavePoint, Name: name, Tx: tx.id})
+	return nil
+}
+
+func (tx *transaction) RollbackTo(ctx context.Context, name string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return errTxDone
+	}
+	if tx.prepared {
+		return errTxPrepared
+	}
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i] == name {
+			tx.savepoints = tx.savepoints[:i+1]
+			tx.pool.record(Call{Op: OpRollbackTo, Name: name, Tx: tx.id})
+			return nil
+		}
+	}
+	return fmt.Errorf("rdbtest: savepoint %q does not exist", name)
+}
+
+// ReleaseSavePoint removes the savepoint and those created after it.
+func (tx *transaction) ReleaseSavePoint(ctx context.Context, name string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return errTxDone
+	}
+	if tx.prepared {
+		return errTxPrepared
+	}
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i] == name {
+			tx.savepoints = tx.savepoints[:i]
+			tx.pool.record(Call{Op: OpReleaseSavePoint, Name: name, Tx: tx.id})
+			return nil
+		}
+	}
+	return fmt.Errorf("rdbtest: savepoint %q does not exist", name)
+}
+
+func (tx *transaction) Commit(ctx context.Context) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return errTxDone
+	}
+	tx.done = true
+	tx.pool.record(Call{Op: OpCommit, Tx: tx.id})
+	return nil
+}
+
+// Prepare the transaction for commit if the pool sets XA.
+func (tx *transaction) Prepare(ctx context.Context) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if !tx.pool.XA {
+		return rdb.ErrNotSupported
+	}
+	if tx.done {
+		return errTxDone
+	}
+	tx.prepared = true
+	tx.pool.record(Call{Op: OpPrepareTx, Tx: tx.id})
+	return nil
+}
+
+// rollback is called when the transaction context is done.
+func (tx *transaction) rollback() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return
+	}
+	tx.done = true
+	tx.pool.record(Call{Op: OpRollback, Tx: tx.id})
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"fmt"
+	"io"
+)
+
+// ShortReadError is returned when the io.Reader value of a parameter ends
+// before Length bytes are read.
+type ShortReadError struct {
+	Name   string // Name of the parameter.
+	Length int64  // Length of the parameter.
+	Read   int64  // Bytes read before the reader ended.
+}
+
+func (err *ShortReadError) Error() string {
+	return fmt.Sprintf("rdb: parameter %q reader ended after %d of %d bytes", err.Name, err.Read, err.Length)
+}
+
+// readerParams returns the params with each io.Reader value limited to
+// Length bytes. The Length of a reader that is also an io.Seeker is set to
+// the bytes remaining if it is zero. The params are copied if changed.
+func readerParams(params []Param) ([]Param, error) {
+	var out []Param
+	for i, p := range params {
+		r, ok := p.Value.(io.Reader)
+		if !ok || p.Out {
+			continue
+		}
+		if _, ok := r.(*lengthReader); ok {
+			continue
+		}
+		length := int64(p.Length)
+		if length == 0 {
+			s, ok := r.(io.Seeker)
+			if !ok {
+				continue
+			}
+			var err error
+			length, err = seekLength(s)
+			if err != nil {
+				return nil, fmt.Errorf("rdb: parameter %q: %v", p.Name, err)
+			}
+		}
+		if out == nil {
+			out = append([]Param(nil), params...)
+		}
+		out[i].Length = int(length)
+		out[i].Value = &lengthReader{r: r, name: p.Name, length: length, left: length}
+	}
+	if out == nil {
+		return params, nil
+	}
+	return out, nil
+}
+
+// seekLength returns the bytes from the current offset to the end and
+// leaves the offset unchanged.
+func seekLength(s io.Seeker) (int64, error) {
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.Seek(cur, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return end - cur, nil
+}
+
+// lengthReader reads exactly length bytes from r.
+type lengthReader struct {
+	r      io.Reader
+	name   string
+	length int64
+	left   int64
+}
+
+func (lr *lengthReader) Read(p []byte) (int, error) {
+	if lr.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > lr.left {
+		p = p[:lr.left]
+	}
+	n, err := lr.r.Read(p)
+	lr.left -= int64(n)
+	if err == io.EOF {
+		if lr.left > 0 {
+			return n, &ShortReadError{Name: lr.name, Length: lr.length, Read: lr.length - lr.left}
+		}
+		err = nil
+	}
+	return n, err
+}
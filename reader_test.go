@@ -0,0 +1,66 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestReaderParam(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "insert into Blob (Data) values (?);"
+	fake := rdbtest.New()
+	fake.Expect(sql)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// sent returns the parameter the driver received and its bytes.
+	sent := func(p rdb.Param) (rdb.Param, []byte, error) {
+		if err := pool.Query(ctx, &rdb.Command{SQL: sql}, p).Close(); err != nil {
+			t.Fatal(err)
+		}
+		calls := fake.Calls()
+		got := calls[len(calls)-1].Params[0]
+		b, err := ioutil.ReadAll(got.Value.(io.Reader))
+		return got, b, err
+	}
+
+	got, b, err := sent(rdb.Param{Value: bytes.NewReader([]byte("hello world")), Length: 5})
+	if err != nil || string(b) != "hello" || got.Length != 5 {
+		t.Fatalf("explicit length: got %q, length %d, error %v", b, got.Length, err)
+	}
+
+	r := bytes.NewReader([]byte("hello world"))
+	r.Seek(2, io.SeekStart)
+	got, b, err = sent(rdb.Param{Value: r})
+	if err != nil || string(b) != "llo world" || got.Length != 9 {
+		t.Fatalf("seek length: got %q, length %d, error %v", b, got.Length, err)
+	}
+
+	// A reader that cannot seek is streamed until it ends.
+	got, b, err = sent(rdb.Param{Value: io.MultiReader(strings.NewReader("abc"))})
+	if err != nil || string(b) != "abc" || got.Length != 0 {
+		t.Fatalf("unknown length: got %q, length %d, error %v", b, got.Length, err)
+	}
+
+	_, b, err = sent(rdb.Param{Value: io.MultiReader(strings.NewReader("short")), Length: 20})
+	serr, ok := err.(*rdb.ShortReadError)
+	if !ok || serr.Read != 5 || serr.Length != 20 || string(b) != "short" {
+		t.Fatalf("short read: got %q, error %v", b, err)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// Returner may be implemented by a driver Pool to add the clause that
+// returns the columns from an insert, such as an OUTPUT clause that is not
+// placed at the end of the statement.
+type Returner interface {
+	ReturningSQL(sql string, columns []string) string
+}
+
+// LastInsertIDer may be implemented by a driver Next to report the ID
+// generated by an insert.
+type LastInsertIDer interface {
+	LastInsertID() (int64, error)
+}
+
+var errNoReturning = errors.New("rdb: insert did not return a row")
+
+// InsertReturning runs the insert command and returns the values of the
+// returning columns of the inserted row, such as a generated key.
+//
+// If the driver declares Capabilities.ReturningClause the SQL is passed
+// to the driver if it implements Returner, otherwise "RETURNING columns"
+// is appended, and the first returned row is read. Otherwise the command
+// is run as is and the single returning column is set from the last insert
+// ID reported by the driver. ErrNotSupported is returned if the driver
+// can do neither.
+func InsertReturning(ctx context.Context, q Queryer, cmd *Command, returning []string, params ...Param) (Row, error) {
+	if len(returning) == 0 {
+		return nil, errors.New("rdb: no returning columns")
+	}
+	if !CapabilitiesOf(q).ReturningClause {
+		return lastInsertRow(ctx, q, cmd, returning, params)
+	}
+	sql := strings.TrimRight(strings.TrimSpace(cmd.SQL), ";")
+	if r, ok := driverOf(q).(Returner); ok {
+		sql = r.ReturningSQL(sql, returning)
+	} else {
+		sql = appendSQL(sql, "RETURNING "+strings.Join(returning, ", ")) + ";"
+	}
+	insertCmd := *cmd
+	insertCmd.SQL = sql
+	next := q.Query(ctx, &insertCmd, params...)
+	defer next.Close()
+	b, err := next.Buffer()
+	if err != nil {
+		return nil, err
+	}
+	if b == nil || len(b.Row) == 0 {
+		return nil, errNoReturning
+	}
+	return b.Row[0], nil
+}
+
+func lastInsertRow(ctx context.Context, q Queryer, cmd *Command, returning []string, params []Param) (Row, error) {
+	if len(returning) != 1 {
+		return nil, ErrNotSupported
+	}
+	next := q.Query(ctx, cmd, params...)
+	if _, err := next.BufferSet(); err != nil {
+		return nil, err
+	}
+	li, ok := driverNextOf(next).(LastInsertIDer)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	id, err := li.LastInsertID()
+	if err != nil {
+		return nil, err
+	}
+	return &ValueRow{
+		Schema: Schema{{Name: returning[0], Type: TypeInt64, Generic: Integer, Serial: true}},
+		Values: []interface{}{id},
+	}, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestInsertReturning(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := &rdb.Command{SQL: "insert into Account (Name) values (?);"}
+	name := rdb.Param{Value: "Ann"}
+
+	fake := rdbtest.New()
+	fake.Returning = true
+	fake.Expect("insert into Account (Name) values (?) RETURNING ID, Created;").Returns(
+		rdbtest.NewResult("ID", "Created").Row(int64(7), "today"),
+	)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := rdb.InsertReturning(ctx, pool, cmd, []string{"ID", "Created"}, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Get("ID") != int64(7) || row.Get("Created") != "today" {
+		t.Errorf("unexpected row %v, %v", row.Get("ID"), row.Get("Created"))
+	}
+	pool.Close()
+
+	fake = rdbtest.New()
+	fake.Expect(cmd.SQL).Affected(1).LastInsertID(12)
+	pool, err = rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	row, err = rdb.InsertReturning(ctx, pool, cmd, []string{"ID"}, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	row.Into("ID", &id)
+	if id != 12 {
+		t.Errorf("got ID %d, want 12", id)
+	}
+	if _, err := rdb.InsertReturning(ctx, pool, cmd, []string{"ID", "Created"}, name); err != rdb.ErrNotSupported {
+		t.Errorf("got %v, want ErrNotSupported", err)
+	}
+	if len(fake.Calls()) != 1 {
+		t.Errorf("got %d calls, want 1", len(fake.Calls()))
+	}
+}
@@ -0,0 +1,470 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ValueRow is a Row backed by a slice of column values in schema order.
+// Drivers may use it for buffered rows.
+type ValueRow struct {
+	Schema Schema
+	Values []interface{}
+
+	// NullAsZero sets a NULL column to the zero value of a scalar
+	// destination rather then failing. Set from Command.NullAsZero.
+	NullAsZero bool
+
+	// Set by a pool returned from Open to parse text read into a time.Time.
+	layouts []string
+	loc     *time.Location
+}
+
+var _ Row = &ValueRow{}
+
+var valuesPool = sync.Pool{
+	New: func() interface{} {
+		return make([]interface{}, 0, 8)
+	},
+}
+
+// NewValueRow returns a row for the schema with the value slice taken from
+// a shared pool. Call Release when the row is no longer used to reuse the
+// value slice.
+func NewValueRow(schema Schema) *ValueRow {
+	values := valuesPool.Get().([]interface{})
+	if cap(values) < len(schema) {
+		values = make([]interface{}, len(schema))
+	}
+	return &ValueRow{
+		Schema: schema,
+		Values: values[:len(schema)],
+	}
+}
+
+// Release returns the value slice to the shared pool. The row and any
+// values previously returned from it must not be used after Release.
+func (r *ValueRow) Release() {
+	if r.Values == nil {
+		return
+	}
+	for i := range r.Values {
+		r.Values[i] = nil
+	}
+	valuesPool.Put(r.Values[:0])
+	r.Values = nil
+}
+
+func (r *ValueRow) index(name string) int {
+	for i, col := range r.Schema {
+		if col.Name == name {
+			return i
+		}
+	}
+	panic(fmt.Sprintf("rdb: column %q not in row", name))
+}
+
+// Get returns the value of the named column.
+func (r *ValueRow) Get(name string) interface{} {
+	return r.Getx(r.index(name))
+}
+
+// Getx returns the value of the column at index. A NULL column returns nil
+// and an empty binary column returns a non-nil empty []byte.
+func (r *ValueRow) Getx(index int) interface{} {
+	if b, ok := r.Values[index].([]byte); ok && b == nil {
+		return []byte{}
+	}
+	return r.Values[index]
+}
+
+// Into sets value to the named column. Value must be a pointer.
+func (r *ValueRow) Into(name string, value interface{}) Row {
+	return r.Intox(r.index(name), value)
+}
+
+// Intox sets value to the column at index. Value must be a pointer.
+// A NULL column sets a pointer, slice, map or interface destination to nil
+// and a sql.Scanner is passed the NULL. An empty binary column sets a
+// []byte destination to a non-nil empty slice, so NULL and empty may be
+// told apart. A NULL column is an error for
+// other destinations unless NullAsZero is set. Pointer destinations are
+// allocated as needed. Text read into a *time.Time is parsed with
+// Config.TimeLayouts, RFC 3339 or a common SQL layout. A JSON column, see
+// RegisterJSONType, read into a struct, map, slice or array other then a
+// []byte is unmarshaled with encoding/json. Into panics if the column
+// cannot be assigned to value.
+func (r *ValueRow) Intox(index int, value interface{}) Row {
+	if ok, err := assignTime(value, r.Values[index], r.layouts, r.loc); ok {
+		if err != nil {
+			panic(err)
+		}
+		return r
+	}
+	if index < len(r.Schema) {
+		if ok, err := assignJSON(value, r.Values[index], r.Schema[index].Type); ok {
+			if err != nil {
+				panic(err)
+			}
+			return r
+		}
+	}
+	if err := assign(value, r.Values[index], r.NullAsZero); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func (r *ValueRow) nullAsZero() bool {
+	return r.NullAsZero
+}
+
+// nullAsZeroer is implemented by rows that may set NULL to the zero value.
+type nullAsZeroer interface {
+	nullAsZero() bool
+}
+
+// rowNullAsZero returns true if NULL columns of the row may be set to the
+// zero value of scalar destinations.
+func rowNullAsZero(row Row) bool {
+	if nz, ok := row.(nullAsZeroer); ok {
+		return nz.nullAsZero()
+	}
+	return false
+}
+
+var (
+	scannerType         = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// assign sets the value pointed to by dest to src.
+//
+// Destinations that implement sql.Scanner are passed src as is, including
+// NULL. Destinations that implement encoding.TextUnmarshaler are passed
+// text and binary values that cannot be assigned directly.
+func assign(dest, src interface{}, nullAsZero bool) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("rdb: destination %T is not a non-nil pointer", dest)
+	}
+	ev := dv.Elem()
+	if src == nil {
+		if ev.Kind() != reflect.Ptr && dv.Type().Implements(scannerType) {
+			return dest.(sql.Scanner).Scan(nil)
+		}
+		switch ev.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		default:
+			if !nullAsZero {
+				return fmt.Errorf("rdb: cannot assign NULL to %s", ev.Type())
+			}
+		}
+		ev.Set(reflect.Zero(ev.Type()))
+		return nil
+	}
+	sv := reflect.ValueOf(src)
+	for ev.Kind() == reflect.Ptr && !sv.Type().AssignableTo(ev.Type()) {
+		if ev.IsNil() {
+			ev.Set(reflect.New(ev.Type().Elem()))
+		}
+		ev = ev.Elem()
+	}
+	pt := ev.Addr().Type()
+	if pt.Implements(scannerType) {
+		return ev.Addr().Interface().(sql.Scanner).Scan(src)
+	}
+	if sv.Type().AssignableTo(ev.Type()) {
+		if b, ok := src.([]byte); ok && b == nil {
+			// Only NULL may set a []byte to nil.
+			sv = reflect.ValueOf([]byte{})
+		}
+		ev.Set(sv)
+		return nil
+	}
+	if pt.Implements(textUnmarshalerType) {
+		switch v := src.(type) {
+		case []byte:
+			return ev.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(v)
+		case string:
+			return ev.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(v))
+		}
+	}
+	if convert(ev, sv) {
+		return nil
+	}
+	return fmt.Errorf("rdb: cannot assign %T to %s", src, ev.Type())
+}
+
+// convert sets ev to sv if sv has the same kind as ev, is text or binary
+// assigned to text or binary, or is a number that ev holds exactly. It
+// returns false rather then lose or change the value.
+func convert(ev, sv reflect.Value) bool {
+	if !sv.Type().ConvertibleTo(ev.Type()) {
+		return false
+	}
+	sk, ek := kindOf(sv.Type()), kindOf(ev.Type())
+	switch {
+	case sv.Kind() == ev.Kind() && sk != kindNumber:
+	case sk == kindText && ek == kindText:
+	case sk == kindNumber && ek == kindNumber:
+		if !exact(ev, sv) {
+			return false
+		}
+	default:
+		return false
+	}
+	ev.Set(sv.Convert(ev.Type()))
+	return true
+}
+
+const (
+	kindOther = iota
+	kindNumber
+	kindText
+)
+
+func kindOf(t reflect.Type) int {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return kindNumber
+	case reflect.String:
+		return kindText
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return kindText
+		}
+	}
+	return kindOther
+}
+
+// exact reports if the number sv converted to the type of ev keeps its
+// value: no overflow, no lost fraction and no lost float precision.
+func exact(ev, sv reflect.Value) bool {
+	switch sv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return exactInt(ev, sv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := sv.Uint()
+		if u > math.MaxInt64 {
+			switch ev.Kind() {
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+				return !ev.OverflowUint(u)
+			case reflect.Float32, reflect.Float64:
+				f := float64(u)
+				return f < 1<<64 && uint64(f) == u && !ev.OverflowFloat(f) && exactFloat(ev, f)
+			}
+			return false
+		}
+		return exactInt(ev, int64(u))
+	}
+	f := sv.Float()
+	switch ev.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return exactFloat(ev, f)
+	}
+	if f != math.Trunc(f) || f < -(1<<63) || f >= 1<<63 {
+		return false
+	}
+	return exactInt(ev, int64(f))
+}
+
+func exactInt(ev reflect.Value, i int64) bool {
+	switch ev.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return !ev.OverflowInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return i >= 0 && !ev.OverflowUint(uint64(i))
+	}
+	f := float64(i)
+	if f >= 1<<63 || int64(f) != i {
+		return false
+	}
+	return exactFloat(ev, f)
+}
+
+func exactFloat(ev reflect.Value, f float64) bool {
+	if ev.Kind() == reflect.Float32 {
+		return float64(float32(f)) == f || math.IsNaN(f)
+	}
+	return true
+}
+
+// RowScanner may be implemented by a driver Result to read rows into a
+// caller supplied row without allocating a new row each time.
+type RowScanner interface {
+	ScanInto(row *ValueRow) (bool, error)
+}
+
+// ScanInto reads the next row of the result into row, reusing the storage
+// of row. It returns false when the last row has been read. Values in row
+// are only valid until the next call to ScanInto. Use Result.Scan to
+// allocate a new row for each iteration if rows are retained.
+func ScanInto(res Result, row *ValueRow) (bool, error) {
+	if rs, ok := res.(RowScanner); ok {
+		return rs.ScanInto(row)
+	}
+	scanned, err := res.Scan()
+	if err != nil || scanned == nil {
+		return false, err
+	}
+	row.Schema = res.Schema()
+	row.Values = row.Values[:0]
+	for i := range row.Schema {
+		row.Values = append(row.Values, scanned.Getx(i))
+	}
+	return true, nil
+}
+
+// ScanValues reads the next row of the result and returns its values in
+// column order, appended to dest[:0] so the slice of the previous row may
+// be passed to reuse it. The values are only valid until the next call. It
+// returns nil when the last row has been read. If the driver implements
+// RowScanner no Row is allocated.
+func ScanValues(res Result, dest []interface{}) ([]interface{}, error) {
+	row := ValueRow{Values: dest[:0]}
+	ok, err := ScanInto(res, &row)
+	if !ok {
+		return nil, err
+	}
+	if row.Values == nil {
+		row.Values = []interface{}{}
+	}
+	return row.Values, nil
+}
+
+// RowReader may be implemented by a driver Row that can stream large
+// binary or text columns directly from the wire.
+type RowReader interface {
+	GetReader(name string) (io.ReadCloser, error)
+	GetReaderx(index int) (io.ReadCloser, error)
+}
+
+// GetReader returns a reader for the named column. If the driver row
+// implements RowReader the column is streamed, otherwise the buffered
+// value is wrapped. A streamed reader must be read and closed before
+// the next row is scanned. A NULL value returns a reader with no data.
+func GetReader(row Row, name string) (io.ReadCloser, error) {
+	if rr, ok := row.(RowReader); ok {
+		return rr.GetReader(name)
+	}
+	return valueReader(row.Get(name))
+}
+
+// GetReaderx returns a reader for the column at index.
+// See GetReader for details.
+func GetReaderx(row Row, index int) (io.ReadCloser, error) {
+	if rr, ok := row.(RowReader); ok {
+		return rr.GetReaderx(index)
+	}
+	return valueReader(row.Getx(index))
+}
+
+func valueReader(value interface{}) (io.ReadCloser, error) {
+	switch v := value.(type) {
+	case nil:
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	case []byte:
+		return ioutil.NopCloser(bytes.NewReader(v)), nil
+	case string:
+		return ioutil.NopCloser(strings.NewReader(v)), nil
+	case io.ReadCloser:
+		return v, nil
+	case io.Reader:
+		return ioutil.NopCloser(v), nil
+	}
+	return nil, fmt.Errorf("rdb: cannot read column value of type %T", value)
+}
+
+// WriteColumn copies the named column to w and returns the number of bytes
+// written. The column is streamed if the driver supports it.
+func WriteColumn(row Row, name string, w io.Writer) (int64, error) {
+	rc, err := GetReader(row, name)
+	if err != nil {
+		return 0, err
+	}
+	return copyColumn(w, rc)
+}
+
+// WriteColumnx copies the column at index to w.
+// See WriteColumn for details.
+func WriteColumnx(row Row, index int, w io.Writer) (int64, error) {
+	rc, err := GetReaderx(row, index)
+	if err != nil {
+		return 0, err
+	}
+	return copyColumn(w, rc)
+}
+
+func copyColumn(w io.Writer, rc io.ReadCloser) (int64, error) {
+	n, err := io.Copy(w, rc)
+	if cerr := rc.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// RawRow may be implemented by a driver Row to return the unconverted
+// bytes of a column as read from the wire.
+type RawRow interface {
+	Raw(name string) ([]byte, error)
+	Rawx(index int) ([]byte, error)
+}
+
+// Raw returns the unconverted bytes of the named column. The returned
+// slice is only valid until the next row is scanned and must be copied to
+// be retained. A NULL value returns nil, use IsNull to tell it apart from
+// an empty value. If the driver row does not implement RawRow, text and
+// binary values are returned as is.
+func Raw(row Row, name string) ([]byte, error) {
+	if rr, ok := row.(RawRow); ok {
+		return rr.Raw(name)
+	}
+	return rawValue(row.Get(name))
+}
+
+// Rawx returns the unconverted bytes of the column at index.
+// See Raw for details.
+func Rawx(row Row, index int) ([]byte, error) {
+	if rr, ok := row.(RawRow); ok {
+		return rr.Rawx(index)
+	}
+	return rawValue(row.Getx(index))
+}
+
+func rawValue(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("rdb: raw bytes not available for column value of type %T", value)
+}
+
+// IsNull returns true if the named column is NULL.
+func IsNull(row Row, name string) bool {
+	return row.Get(name) == nil
+}
+
+// IsNullx returns true if the column at index is NULL.
+func IsNullx(row Row, index int) bool {
+	return row.Getx(index) == nil
+}
@@ -0,0 +1,525 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+// blobRow is a Row that does not stream.
+type blobRow struct {
+	rdb.Row
+	value []byte
+}
+
+func (r blobRow) Get(name string) interface{} { return r.value }
+func (r blobRow) Getx(index int) interface{}  { return r.value }
+
+func TestGetReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	blob := make([]byte, 3<<20+17)
+	rand.New(rand.NewSource(1)).Read(blob)
+
+	fake := rdbtest.New()
+	fake.Expect("select Data from File;").Returns(
+		rdbtest.NewResult("Data").Row(bytes.NewReader(blob)),
+	)
+	res, err := fake.Query(ctx, &rdb.Command{SQL: "select Data from File;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	row, err := res.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(name string, rc io.ReadCloser, err error) {
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		defer rc.Close()
+		got := &bytes.Buffer{}
+		chunk := make([]byte, 32<<10)
+		for {
+			n, err := rc.Read(chunk)
+			got.Write(chunk[:n])
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if !bytes.Equal(got.Bytes(), blob) {
+			t.Fatalf("%s: read %d bytes, not equal to blob of %d bytes", name, got.Len(), len(blob))
+		}
+	}
+
+	rc, err := rdb.GetReader(row, "Data")
+	check("stream", rc, err)
+
+	rc, err = rdb.GetReaderx(blobRow{value: blob}, 0)
+	check("buffered", rc, err)
+}
+
+func TestWriteColumn(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	content := bytes.Repeat([]byte("stored file content\n"), 5000)
+	fake := rdbtest.New()
+	fake.Expect("select Name, Data from File;").Returns(
+		rdbtest.NewResult("Name", "Data").Row("a.txt", content),
+	)
+	b, err := fake.Query(ctx, &rdb.Command{SQL: "select Name, Data from File;"}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	n, err := rdb.WriteColumn(b.Row[0], "Data", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(content)) {
+		t.Errorf("wrote %d bytes, want %d", n, len(content))
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Error("written content does not match")
+	}
+
+	out.Reset()
+	n, err = rdb.WriteColumnx(b.Row[0], 0, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || out.String() != "a.txt" {
+		t.Errorf("got %d bytes %q", n, out.String())
+	}
+}
+
+func scanResult(b testing.TB, fake *rdbtest.Pool) rdb.Result {
+	res, err := fake.Query(context.Background(), &rdb.Command{SQL: "select ID, Name from Account;"}).Result()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return res
+}
+
+func accountPool(rows int) *rdbtest.Pool {
+	set := rdbtest.NewResult("ID", "Name")
+	for i := 0; i < rows; i++ {
+		set.Row(int64(i), "name")
+	}
+	fake := rdbtest.New()
+	fake.Expect("select ID, Name from Account;").Returns(set)
+	return fake
+}
+
+func TestScanIntoReuse(t *testing.T) {
+	fake := accountPool(100)
+	res := scanResult(t, fake)
+	defer res.Close()
+
+	row := &rdb.ValueRow{}
+	var ids []int64
+	var first *rdb.ValueRow
+	for {
+		ok, err := rdb.ScanInto(res, row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		if first == nil {
+			first = row
+		} else if first != row {
+			t.Fatal("row was not reused")
+		}
+		var id int64
+		row.Into("ID", &id)
+		ids = append(ids, id)
+	}
+	if len(ids) != 100 {
+		t.Fatalf("got %d rows, want 100", len(ids))
+	}
+	for i, id := range ids {
+		if id != int64(i) {
+			t.Fatalf("row %d has ID %d", i, id)
+		}
+	}
+
+	// Buffers released to the pool must not corrupt rows of other buffers.
+	a, err := accountPool(3).Query(context.Background(), &rdb.Command{SQL: "select ID, Name from Account;"}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Release()
+	b, err := accountPool(3).Query(context.Background(), &rdb.Command{SQL: "select ID, Name from Account;"}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range b.Row {
+		if r.Get("ID") != int64(i) || r.Get("Name") != "name" {
+			t.Fatalf("row %d corrupted: %v", i, r.(*rdb.ValueRow).Values)
+		}
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	fake := accountPool(b.N)
+	res := scanResult(b, fake)
+	defer res.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var id int64
+	for {
+		row, err := res.Scan()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if row == nil {
+			break
+		}
+		row.Intox(0, &id)
+	}
+}
+
+func BenchmarkScanInto(b *testing.B) {
+	fake := accountPool(b.N)
+	res := scanResult(b, fake)
+	defer res.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var id int64
+	row := &rdb.ValueRow{}
+	for {
+		ok, err := rdb.ScanInto(res, row)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		row.Intox(0, &id)
+	}
+}
+
+func TestScanValues(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "select Name, ID, Active from Account;"
+	fake := rdbtest.New()
+	fake.Expect(sql).Returns(rdbtest.NewResult("Name", "ID", "Active").
+		Row("Ann", int64(1), true).
+		Row("Bob", int64(2), false),
+	)
+	res, err := fake.Query(ctx, &rdb.Command{SQL: sql}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+
+	schema := res.Schema()
+	var values []interface{}
+	var rows [][]interface{}
+	for {
+		values, err = rdb.ScanValues(res, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if values == nil {
+			break
+		}
+		if len(values) != len(schema) {
+			t.Fatalf("got %d values, want %d columns", len(values), len(schema))
+		}
+		rows = append(rows, append([]interface{}(nil), values...))
+	}
+	want := [][]interface{}{{"Ann", int64(1), true}, {"Bob", int64(2), false}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("got rows %v, want %v", rows, want)
+	}
+
+	b, err := fake.Query(ctx, &rdb.Command{SQL: sql}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := rdb.Map(b.Row[1], b.Schema)
+	for i, v := range rdb.Values(b.Row[1], b.Schema) {
+		if name := b.Schema[i].Name; m[name] != v {
+			t.Fatalf("column %d %q: got %v, want %v", i, name, v, m[name])
+		}
+	}
+}
+
+func BenchmarkScanMap(b *testing.B) {
+	fake := accountPool(b.N)
+	res := scanResult(b, fake)
+	defer res.Close()
+
+	schema := res.Schema()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for {
+		row, err := res.Scan()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if row == nil {
+			break
+		}
+		_ = rdb.Map(row, schema)
+	}
+}
+
+func BenchmarkScanValues(b *testing.B) {
+	fake := accountPool(b.N)
+	res := scanResult(b, fake)
+	defer res.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var values []interface{}
+	for {
+		var err error
+		values, err = rdb.ScanValues(res, values)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if values == nil {
+			break
+		}
+	}
+}
+
+func TestRaw(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select Code, Note from Item;").Returns(
+		rdbtest.NewResult("Code", "Note").
+			Row("AB12", nil).
+			Row("CD34", []byte{}),
+	)
+	res, err := fake.Query(ctx, &rdb.Command{SQL: "select Code, Note from Item;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+
+	row, err := res.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := rdb.Raw(row, "Code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first) != "AB12" {
+		t.Fatalf("got %q", first)
+	}
+	kept := append([]byte(nil), first...)
+
+	note, err := rdb.Raw(row, "Note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note != nil || !rdb.IsNull(row, "Note") {
+		t.Fatalf("NULL column: got %v, IsNull %t", note, rdb.IsNull(row, "Note"))
+	}
+
+	row, err = res.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := rdb.Rawx(row, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(second) != "CD34" {
+		t.Fatalf("got %q", second)
+	}
+	// The raw buffer is reused by the next row, a copy is unchanged.
+	if string(first) != "CD34" {
+		t.Errorf("expected first raw slice to be reused, got %q", first)
+	}
+	if string(kept) != "AB12" {
+		t.Errorf("copied raw value changed to %q", kept)
+	}
+
+	note, err = rdb.Rawx(row, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note == nil || len(note) != 0 || rdb.IsNullx(row, 1) {
+		t.Fatalf("empty column: got %v, IsNull %t", note, rdb.IsNullx(row, 1))
+	}
+}
+
+func TestNullAsZero(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "select ID, Name from Account;"
+	fake := rdbtest.New()
+	fake.Expect(sql).Returns(
+		rdbtest.NewResult("ID", "Name").Row(int64(3), nil),
+	)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scan := func(cmd *rdb.Command) (rdb.Row, rdb.Schema) {
+		b, err := pool.Query(ctx, cmd).Buffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b.Row[0], b.Schema
+	}
+
+	var acct struct {
+		ID   int64
+		Name string
+	}
+	row, schema := scan(&rdb.Command{SQL: sql})
+	if err := rdb.IntoStruct(row, schema, &acct); err == nil {
+		t.Fatal("expected error scanning NULL into string")
+	}
+	var name *string
+	row.Into("Name", &name)
+	if name != nil {
+		t.Fatalf("expected nil pointer, got %q", *name)
+	}
+
+	row, schema = scan(&rdb.Command{SQL: sql, NullAsZero: true})
+	acct.Name = "old"
+	if err := rdb.IntoStruct(row, schema, &acct); err != nil {
+		t.Fatal(err)
+	}
+	if acct.ID != 3 || acct.Name != "" {
+		t.Fatalf("unexpected struct %+v", acct)
+	}
+	var s = "old"
+	row.Into("Name", &s)
+	if s != "" {
+		t.Fatalf("expected zero value, got %q", s)
+	}
+}
+
+func TestNullBytes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "select Data from File;"
+	fake := rdbtest.New()
+	fake.Expect(sql).Returns(
+		rdbtest.NewResult("Data").Row(nil).Row([]byte(nil)).Row([]byte{}).Row([]byte("abc")),
+	)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	b, err := pool.Query(ctx, &rdb.Command{SQL: sql}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []struct {
+		null bool
+		want []byte
+	}{
+		{true, nil},
+		{false, []byte{}},
+		{false, []byte{}},
+		{false, []byte("abc")},
+	}
+	for i, item := range list {
+		row := b.Row[i]
+		if got := rdb.IsNull(row, "Data"); got != item.null {
+			t.Errorf("row %d: got IsNull %t, want %t", i, got, item.null)
+		}
+		if got := rdb.IsNullx(row, 0); got != item.null {
+			t.Errorf("row %d: got IsNullx %t, want %t", i, got, item.null)
+		}
+		data := []byte("old")
+		row.Into("Data", &data)
+		if (data == nil) != item.null || !bytes.Equal(data, item.want) {
+			t.Errorf("row %d: got Into %#v, want %#v", i, data, item.want)
+		}
+		got, _ := row.Get("Data").([]byte)
+		if (got == nil) != item.null || !bytes.Equal(got, item.want) {
+			t.Errorf("row %d: got Get %#v, want %#v", i, got, item.want)
+		}
+	}
+}
+
+func TestAssignConvert(t *testing.T) {
+	type myString string
+	intoStruct := func(value, dest interface{}) error {
+		schema := rdb.Schema{{Name: "V"}}
+		row := &rdb.ValueRow{Schema: schema, Values: []interface{}{value}}
+		return rdb.IntoStruct(row, schema, dest)
+	}
+
+	var s struct{ V string }
+	var i struct{ V int }
+	var u struct{ V uint8 }
+	var f struct{ V float32 }
+	for _, item := range []struct {
+		value, dest interface{}
+	}{
+		{int64(65), &s},
+		{3.9, &i},
+		{int64(300), &u},
+		{int64(-1), &u},
+		{0.1, &f},
+	} {
+		if err := intoStruct(item.value, item.dest); err == nil {
+			t.Errorf("%T %v into %T: expected error", item.value, item.value, item.dest)
+		}
+	}
+
+	var ms struct{ V myString }
+	var b struct{ V []byte }
+	var d struct{ V float64 }
+	for _, item := range []struct {
+		value, dest, want interface{}
+	}{
+		{int64(3), &i, 3},
+		{4.0, &i, 4},
+		{int64(200), &u, uint8(200)},
+		{0.5, &f, float32(0.5)},
+		{int64(1) << 52, &d, float64(1 << 52)},
+		{"abc", &ms, myString("abc")},
+		{"abc", &b, []byte("abc")},
+		{[]byte("abc"), &s, "abc"},
+	} {
+		if err := intoStruct(item.value, item.dest); err != nil {
+			t.Errorf("%T %v into %T: %v", item.value, item.value, item.dest, err)
+			continue
+		}
+		if got := reflect.ValueOf(item.dest).Elem().Field(0).Interface(); !reflect.DeepEqual(got, item.want) {
+			t.Errorf("%T %v: got %#v, want %#v", item.value, item.value, got, item.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import "fmt"
+
+// ErrRowLimitExceeded is returned when a query reads more rows than the
+// Config.MaxRowsPerQuery of the pool.
+type ErrRowLimitExceeded struct {
+	Limit int64
+}
+
+func (err ErrRowLimitExceeded) Error() string {
+	return fmt.Sprintf("rdb: query returned more then %d rows", err.Limit)
+}
+
+// limitNext fails the query with ErrRowLimitExceeded once more then max
+// rows have been read from all of its results and buffers.
+type limitNext struct {
+	Next
+
+	max  int64
+	rows int64
+	err  error
+}
+
+func (n *limitNext) driverNext() Next {
+	return n.Next
+}
+
+// read counts rows and closes the query if the limit is exceeded.
+func (n *limitNext) read(rows int) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.rows += int64(rows)
+	if n.rows <= n.max {
+		return nil
+	}
+	n.err = ErrRowLimitExceeded{Limit: n.max}
+	n.Next.Close()
+	return n.err
+}
+
+func (n *limitNext) Result() (Result, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	res, err := n.Next.Result()
+	if res == nil {
+		return res, err
+	}
+	return &limitResult{Result: res, next: n}, err
+}
+
+// Buffer reads the result through Scan so no more then max+1 rows are
+// read before the limit stops the query.
+func (n *limitNext) Buffer() (*Buffer, error) {
+	res, err := n.Result()
+	if res == nil || err != nil {
+		return nil, err
+	}
+	b := &Buffer{Schema: res.Schema()}
+	for {
+		row, err := res.Scan()
+		if err != nil {
+			b.Release()
+			return nil, err
+		}
+		if row == nil {
+			return b, nil
+		}
+		b.Row = append(b.Row, row)
+	}
+}
+
+func (n *limitNext) BufferSet() (BufferSet, error) {
+	var set BufferSet
+	for {
+		b, err := n.Buffer()
+		if n.err != nil {
+			for _, b := range set {
+				b.Release()
+			}
+			return nil, n.err
+		}
+		if b == nil || err != nil {
+			return set, err
+		}
+		set = append(set, b)
+	}
+}
+
+type limitResult struct {
+	Result
+
+	next *limitNext
+}
+
+func (res *limitResult) Scan() (Row, error) {
+	if res.next.err != nil {
+		return nil, res.next.err
+	}
+	row, err := res.Result.Scan()
+	if row != nil {
+		if lerr := res.next.read(1); lerr != nil {
+			return nil, lerr
+		}
+	}
+	return row, err
+}
+
+func (res *limitResult) ScanInto(row *ValueRow) (bool, error) {
+	if res.next.err != nil {
+		return false, res.next.err
+	}
+	ok, err := ScanInto(res.Result, row)
+	if ok {
+		if lerr := res.next.read(1); lerr != nil {
+			return false, lerr
+		}
+	}
+	return ok, err
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestMaxRowsPerQuery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID from Account;").Returns(rdbtest.NewResult("ID").Row(1).Row(2).Row(3))
+	fake.Expect("select ID from Account where ID < 3;").Returns(rdbtest.NewResult("ID").Row(1).Row(2))
+	conf := fake.Config()
+	conf.MaxRowsPerQuery = 2
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	res, err := pool.Query(ctx, &rdb.Command{SQL: "select ID from Account;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := 0
+	for {
+		row, err := res.Scan()
+		if err != nil {
+			if limit, ok := err.(rdb.ErrRowLimitExceeded); !ok || limit.Limit != 2 {
+				t.Fatalf("got %v, want ErrRowLimitExceeded", err)
+			}
+			break
+		}
+		if row == nil {
+			t.Fatal("read all rows past the limit")
+		}
+		rows++
+	}
+	if rows != 2 {
+		t.Errorf("read %d rows before the limit, want 2", rows)
+	}
+	res.Close()
+
+	_, err = pool.Query(ctx, &rdb.Command{SQL: "select ID from Account;"}).Buffer()
+	if _, ok := err.(rdb.ErrRowLimitExceeded); !ok {
+		t.Fatalf("got %v from buffer, want ErrRowLimitExceeded", err)
+	}
+
+	next := pool.Query(ctx, &rdb.Command{SQL: "select ID from Account where ID < 3;"})
+	b, err := next.Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Row) != 2 {
+		t.Fatalf("got %d rows, want 2", len(b.Row))
+	}
+	if err := next.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range fake.Status().Connections() {
+		if !c.Idle {
+			t.Errorf("connection not returned to the pool %+v", c)
+		}
+	}
+}
+
+func TestMaxRowsPerQueryBuffer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rs := rdbtest.NewResult("ID")
+	for i := 0; i < 100; i++ {
+		rs.Row(i)
+	}
+	fake := rdbtest.New()
+	fake.Expect("select ID from Account;").Returns(rs)
+	conf := fake.Config()
+	conf.MaxRowsPerQuery = 2
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	for _, buffer := range []func(rdb.Next) error{
+		func(next rdb.Next) error {
+			_, err := next.Buffer()
+			return err
+		},
+		func(next rdb.Next) error {
+			_, err := next.BufferSet()
+			return err
+		},
+	} {
+		before := rs.Read()
+		next := pool.Query(ctx, &rdb.Command{SQL: "select ID from Account;"})
+		if _, ok := buffer(next).(rdb.ErrRowLimitExceeded); !ok {
+			t.Fatal("buffer did not fail with ErrRowLimitExceeded")
+		}
+		next.Close()
+		// The query is stopped at the first row over the limit.
+		if read := rs.Read() - before; read != 3 {
+			t.Fatalf("read %d rows, want 3", read)
+		}
+	}
+}
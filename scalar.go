@@ -0,0 +1,168 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"errors"
+	"reflect"
+
+	"golang.org/x/net/context"
+)
+
+// ErrNoRows is returned by Scalar when the command returns no rows.
+var ErrNoRows = errors.New("rdb: no rows in result")
+
+// ErrTooManyRows is returned by Scalar when a command with ExpectSingleRow
+// set returns more then one row.
+var ErrTooManyRows = errors.New("rdb: more then one row in result")
+
+// Scalar runs the command and returns the first column of the first row
+// as a T. It returns ErrNoRows if the command returns no rows. Other rows
+// are ignored unless the command sets ExpectSingleRow, then
+// ErrTooManyRows is returned. The result is closed before Scalar returns.
+//
+// The value is assigned as by Row.Intox, a NULL value requires T to be a
+// pointer or Command.NullAsZero to be set.
+func Scalar[T any](ctx context.Context, q Queryer, cmd *Command, params ...Param) (value T, err error) {
+	next := q.Query(ctx, cmd, params...)
+	defer func() {
+		if cerr := next.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	res, err := next.Result()
+	if err != nil {
+		return value, err
+	}
+	if res == nil {
+		return value, ErrNoRows
+	}
+	if len(res.Schema()) == 0 {
+		return value, errors.New("rdb: scalar result has no columns")
+	}
+	row, err := res.Scan()
+	if err != nil {
+		return value, err
+	}
+	if row == nil {
+		return value, ErrNoRows
+	}
+	if err = assign(&value, row.Getx(0), rowNullAsZero(row)); err != nil || !cmd.ExpectSingleRow {
+		return value, err
+	}
+	extra, err := res.Scan()
+	if err != nil {
+		return value, err
+	}
+	if extra != nil {
+		var zero T
+		return zero, ErrTooManyRows
+	}
+	return value, nil
+}
+
+// Collect runs the command and returns every row as a T. The result is
+// closed before Collect returns. A command that returns no rows returns a
+// nil slice.
+//
+// If T is a struct the columns are set as by IntoStructMode with the
+// ScanMode of the command, otherwise the
+// first column is assigned as by Scalar. Structs that implement
+// sql.Scanner or encoding.TextUnmarshaler, and time.Time, are assigned
+// from the first column.
+func Collect[T any](ctx context.Context, q Queryer, cmd *Command, params ...Param) (list []T, err error) {
+	next := q.Query(ctx, cmd, params...)
+	defer func() {
+		if cerr := next.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	res, err := next.Result()
+	if err != nil || res == nil {
+		return nil, err
+	}
+	schema := res.Schema()
+	asStruct := isStructDest(reflect.TypeOf((*T)(nil)).Elem())
+	if !asStruct && len(schema) == 0 {
+		return nil, errors.New("rdb: collect result has no columns")
+	}
+	for {
+		row, err := res.Scan()
+		if err != nil {
+			return list, err
+		}
+		if row == nil {
+			return list, nil
+		}
+		v, err := rowValue[T](row, schema, asStruct, cmd.ScanMode)
+		if err != nil {
+			return list, err
+		}
+		list = append(list, v)
+	}
+}
+
+// rowValue sets a T from the row as Collect does.
+func rowValue[T any](row Row, schema Schema, asStruct bool, mode ScanMode) (v T, err error) {
+	if asStruct {
+		err = IntoStructMode(row, schema, &v, mode)
+	} else {
+		err = assign(&v, row.Getx(0), rowNullAsZero(row))
+	}
+	return v, err
+}
+
+// StreamInto scans each row of the result into a T, as Collect does with
+// ScanLenient, and
+// sends it on the returned channel, which is closed after the last row.
+// The error channel then receives the error that ended the stream, nil
+// after the last row, or ctx.Err() if the context is done first. The
+// result is closed when the stream ends. The rows must be received or the
+// context canceled for the stream to end.
+func StreamInto[T any](ctx context.Context, result Result) (<-chan T, <-chan error) {
+	out := make(chan T)
+	errc := make(chan error, 1)
+	GoSafe(nil, errc, func() (err error) {
+		defer close(out)
+		defer func() {
+			if cerr := result.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		schema := result.Schema()
+		asStruct := isStructDest(reflect.TypeOf((*T)(nil)).Elem())
+		if !asStruct && len(schema) == 0 {
+			return errors.New("rdb: stream result has no columns")
+		}
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			row, err := result.Scan()
+			if err != nil || row == nil {
+				return err
+			}
+			v, err := rowValue[T](row, schema, asStruct, ScanLenient)
+			if err != nil {
+				return err
+			}
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+	return out, errc
+}
+
+// isStructDest returns true if t is a struct set field by field.
+func isStructDest(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	pt := reflect.PtrTo(t)
+	return !pt.Implements(scannerType) && !pt.Implements(textUnmarshalerType)
+}
@@ -0,0 +1,228 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestScalar(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select count(*) from Account;").Returns(rdbtest.NewResult("").Row(int64(42)))
+	fake.Expect("select Name from Account where ID = ?;").Returns(rdbtest.NewResult("Name").Row("Ann").Row("Bob"))
+	fake.Expect("select Name from Account where ID = -1;").Returns(rdbtest.NewResult("Name"))
+	conf := fake.Config()
+	conf.PoolMaxCapacity = 1
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	count, err := rdb.Scalar[int64](ctx, pool, &rdb.Command{SQL: "select count(*) from Account;"})
+	if err != nil || count != 42 {
+		t.Errorf("got count %d, error %v", count, err)
+	}
+	name, err := rdb.Scalar[string](ctx, pool, &rdb.Command{SQL: "select Name from Account where ID = ?;"}, rdb.Param{Value: 1})
+	if err != nil || name != "Ann" {
+		t.Errorf("got name %q, error %v", name, err)
+	}
+	name, err = rdb.Scalar[string](ctx, pool, &rdb.Command{SQL: "select Name from Account where ID = -1;"})
+	if err != rdb.ErrNoRows {
+		t.Errorf("got name %q, error %v, want ErrNoRows", name, err)
+	}
+	// With a single connection each query must have released it.
+	if n := len(fake.Status().Connections()); n != 1 || !fake.Status().Connections()[0].Idle {
+		t.Errorf("connection not returned to pool: %+v", fake.Status().Connections())
+	}
+}
+
+func TestScalarExpectSingleRow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select Name from Account where ID = 1;").Returns(rdbtest.NewResult("Name").Row("Ann"))
+	fake.Expect("select Name from Account where ID > 0;").Returns(rdbtest.NewResult("Name").Row("Ann").Row("Bob"))
+	fake.Expect("select Name from Account where ID = -1;").Returns(rdbtest.NewResult("Name"))
+	conf := fake.Config()
+	conf.PoolMaxCapacity = 1
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	scalar := func(sql string) (string, error) {
+		return rdb.Scalar[string](ctx, pool, &rdb.Command{SQL: sql, ExpectSingleRow: true})
+	}
+	if name, err := scalar("select Name from Account where ID = 1;"); err != nil || name != "Ann" {
+		t.Errorf("one row: got name %q, error %v", name, err)
+	}
+	if name, err := scalar("select Name from Account where ID > 0;"); err != rdb.ErrTooManyRows || name != "" {
+		t.Errorf("two rows: got name %q, error %v, want ErrTooManyRows", name, err)
+	}
+	if name, err := scalar("select Name from Account where ID = -1;"); err != rdb.ErrNoRows {
+		t.Errorf("no rows: got name %q, error %v, want ErrNoRows", name, err)
+	}
+	if n := len(fake.Status().Connections()); n != 1 || !fake.Status().Connections()[0].Idle {
+		t.Errorf("connection not returned to pool: %+v", fake.Status().Connections())
+	}
+}
+
+func TestCollect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select usr_id, name from usr;").Returns(
+		rdbtest.NewResult("usr_id", "name").Row(int64(1), "Ann").Row(int64(2), "Bob"),
+	)
+	fake.Expect("select Score from Game;").Returns(rdbtest.NewResult("Score").Row(3).Row(5).Row(8))
+	fake.Expect("select Score from Game where 1 = 0;").Returns(rdbtest.NewResult("Score"))
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	users, err := rdb.Collect[user](ctx, pool, &rdb.Command{
+		SQL:       "select usr_id, name from usr;",
+		ColumnMap: map[string]string{"usr_id": "ID"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].ID != 1 || users[0].Name != "Ann" || users[1].ID != 2 || users[1].Name != "Bob" {
+		t.Errorf("got users %+v", users)
+	}
+
+	scores, err := rdb.Collect[int](ctx, pool, &rdb.Command{SQL: "select Score from Game;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != 3 || scores[0] != 3 || scores[1] != 5 || scores[2] != 8 {
+		t.Errorf("got scores %v", scores)
+	}
+
+	scores, err = rdb.Collect[int](ctx, pool, &rdb.Command{SQL: "select Score from Game where 1 = 0;"})
+	if err != nil || scores != nil {
+		t.Errorf("got scores %v, error %v, want nil", scores, err)
+	}
+	if n := len(fake.Status().Connections()); n != 1 || !fake.Status().Connections()[0].Idle {
+		t.Errorf("connection not returned to pool: %+v", fake.Status().Connections())
+	}
+}
+
+func TestStreamInto(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID, name from usr;").Returns(
+		rdbtest.NewResult("ID", "name").Row(int64(1), "Ann").Row(int64(2), "Bob").Row(int64(3), "Cy"),
+	)
+	fake.Expect("select ID, name from usr where bad;").Returns(
+		rdbtest.NewResult("ID", "name").Row(int64(1), "Ann").Row("two", "Bob"),
+	)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	res, err := pool.Query(ctx, &rdb.Command{SQL: "select ID, name from usr;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, errc := rdb.StreamInto[user](ctx, res)
+	var names []string
+	for u := range users {
+		if u.ID != int64(len(names)+1) {
+			t.Errorf("got user %+v", u)
+		}
+		names = append(names, u.Name)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 || names[2] != "Cy" {
+		t.Fatalf("got names %q", names)
+	}
+
+	// A scan error ends the stream after the rows before it.
+	res, err = pool.Query(ctx, &rdb.Command{SQL: "select ID, name from usr where bad;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, errc = rdb.StreamInto[user](ctx, res)
+	n := 0
+	for range users {
+		n++
+	}
+	if err := <-errc; err == nil || n != 1 {
+		t.Fatalf("got %d users, error %v, want 1 user and an error", n, err)
+	}
+
+	// Canceling the context ends the stream.
+	streamCtx, streamCancel := context.WithCancel(ctx)
+	res, err = pool.Query(ctx, &rdb.Command{SQL: "select ID, name from usr;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, errc = rdb.StreamInto[user](streamCtx, res)
+	if u := <-users; u.Name != "Ann" {
+		t.Fatalf("got first user %+v", u)
+	}
+	streamCancel()
+	for range users {
+	}
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+// panicResult is a driver result that panics reading the second row.
+type panicResult struct {
+	rdb.Result
+	rows int
+}
+
+func (res *panicResult) Scan() (rdb.Row, error) {
+	if res.rows++; res.rows == 2 {
+		panic("driver: bad row")
+	}
+	return res.Result.Scan()
+}
+
+func TestStreamIntoPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID, name from usr;").Returns(
+		rdbtest.NewResult("ID", "name").Row(int64(1), "Ann").Row(int64(2), "Bob"),
+	)
+	res, err := fake.Query(ctx, &rdb.Command{SQL: "select ID, name from usr;"}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, errc := rdb.StreamInto[user](ctx, &panicResult{Result: res})
+	n := 0
+	for range users {
+		n++
+	}
+	err = <-errc
+	if pe, ok := err.(*rdb.PanicError); !ok || pe.Value != "driver: bad row" || n != 1 {
+		t.Fatalf("got %d users, error %v, want 1 user and a *PanicError", n, err)
+	}
+}
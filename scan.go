@@ -0,0 +1,429 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Map returns the row as a map of column name to value.
+// The schema is the Schema of the Result or Buffer the row is from.
+func Map(row Row, schema Schema) map[string]interface{} {
+	m := make(map[string]interface{}, len(schema))
+	for _, col := range schema {
+		m[col.Name] = row.Getx(col.Index)
+	}
+	return m
+}
+
+// Values returns the values of the row in column order in a new slice.
+// The schema is the Schema of the Result or Buffer the row is from.
+func Values(row Row, schema Schema) []interface{} {
+	values := make([]interface{}, len(schema))
+	for i := range values {
+		values[i] = row.Getx(i)
+	}
+	return values
+}
+
+// ScanMode sets how columns and struct fields that do not match are
+// handled when a row is set into a struct.
+type ScanMode byte
+
+// Scan modes.
+const (
+	ScanLenient           ScanMode = iota // Ignore columns without a field and fields without a column.
+	ScanStrict                            // Fail on a column without a field or a field without a column.
+	ScanRequireAllColumns                 // Fail on a column without a field.
+)
+
+// IntoStruct sets the fields of the struct pointed to by dest from the
+// row. The schema is the Schema of the Result or Buffer the row is from.
+//
+// A column is matched to the field with the same name in a "db" struct
+// tag, or else to the exported field with the same name ignoring case.
+// Fields of embedded structs are matched as if they were in the outer
+// struct. Fields tagged `db:"-"` are ignored. Columns without a matching
+// field are ignored. JSON columns are unmarshaled as by ValueRow.Intox.
+func IntoStruct(row Row, schema Schema, dest interface{}) error {
+	return IntoStructMode(row, schema, dest, ScanLenient)
+}
+
+// IntoStructMode sets the struct fields as IntoStruct does. Columns and
+// fields that do not match are handled as set by mode and reported before
+// any field is set.
+func IntoStructMode(row Row, schema Schema, dest interface{}, mode ScanMode) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("rdb: destination %T is not a pointer to a struct", dest)
+	}
+	sv := dv.Elem()
+	fields := structFields(sv.Type())
+	if mode != ScanLenient {
+		if err := fields.check(schema, sv.Type(), mode); err != nil {
+			return err
+		}
+	}
+	nullAsZero := rowNullAsZero(row)
+	for _, col := range schema {
+		f, found := fields.lookup(col.Name)
+		if !found {
+			continue
+		}
+		field, value := fieldByIndex(sv, f.index).Addr().Interface(), row.Getx(col.Index)
+		ok, err := assignJSON(field, value, col.Type)
+		if !ok {
+			err = assign(field, value, nullAsZero)
+		}
+		if err != nil {
+			return fmt.Errorf("rdb: column %q: %v", col.Name, err)
+		}
+	}
+	return nil
+}
+
+// fieldByIndex returns the field, allocating nil embedded pointers.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+type structField struct {
+	name  string
+	index []int
+}
+
+type fieldList struct {
+	list   []structField
+	byName map[string]int
+	byFold map[string]int
+}
+
+func (fl *fieldList) lookup(name string) (structField, bool) {
+	if i, found := fl.byName[name]; found {
+		return fl.list[i], true
+	}
+	if i, found := fl.byFold[strings.ToLower(name)]; found {
+		return fl.list[i], true
+	}
+	return structField{}, false
+}
+
+// check returns an error if a column has no field or, if mode is
+// ScanStrict, a field has no column.
+func (fl *fieldList) check(schema Schema, t reflect.Type, mode ScanMode) error {
+	var used []bool
+	if mode == ScanStrict {
+		used = make([]bool, len(fl.list))
+	}
+	for _, col := range schema {
+		f, found := fl.lookup(col.Name)
+		if !found {
+			return fmt.Errorf("rdb: column %q has no field in %s", col.Name, t)
+		}
+		if used != nil {
+			used[fl.byName[f.name]] = true
+		}
+	}
+	for i, ok := range used {
+		if !ok {
+			return fmt.Errorf("rdb: field %q of %s has no column", fl.list[i].name, t)
+		}
+	}
+	return nil
+}
+
+var fieldCache = struct {
+	sync.RWMutex
+	m map[reflect.Type]*fieldList
+}{
+	m: make(map[reflect.Type]*fieldList),
+}
+
+// structFields returns the fields of a struct type that may be matched to
+// a column name.
+func structFields(t reflect.Type) *fieldList {
+	fieldCache.RLock()
+	fl, found := fieldCache.m[t]
+	fieldCache.RUnlock()
+	if found {
+		return fl
+	}
+	fl = &fieldList{
+		byName: make(map[string]int),
+		byFold: make(map[string]int),
+	}
+	appendFields(fl, t, nil)
+
+	fieldCache.Lock()
+	fieldCache.m[t] = fl
+	fieldCache.Unlock()
+	return fl
+}
+
+func appendFields(fl *fieldList, t reflect.Type, parent []int) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+		index := make([]int, len(parent)+1)
+		copy(index, parent)
+		index[len(parent)] = i
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && len(tag) == 0 && ft.Kind() == reflect.Struct {
+			appendFields(fl, ft, index)
+			continue
+		}
+		if len(sf.PkgPath) != 0 {
+			continue
+		}
+		name := sf.Name
+		if len(tag) != 0 {
+			name = tag
+		}
+		// Fields of the outer struct take precedence over embedded fields.
+		if _, found := fl.byName[name]; found {
+			continue
+		}
+		fl.byName[name] = len(fl.list)
+		if _, found := fl.byFold[strings.ToLower(name)]; !found {
+			fl.byFold[strings.ToLower(name)] = len(fl.list)
+		}
+		fl.list = append(fl.list, structField{name: name, index: index})
+	}
+}
+
+// mapSchema returns a copy of the schema with columns renamed by colMap.
+func mapSchema(schema Schema, colMap map[string]string) Schema {
+	mapped := make(Schema, len(schema))
+	copy(mapped, schema)
+	for i, col := range mapped {
+		if name, found := colMap[col.Name]; found {
+			mapped[i].Name = name
+		}
+	}
+	return mapped
+}
+
+// columnMapNext applies Command.ColumnMap to the results of a query.
+type columnMapNext struct {
+	Next
+
+	colMap map[string]string
+}
+
+func (n *columnMapNext) driverNext() Next {
+	return n.Next
+}
+
+func (n *columnMapNext) Result() (Result, error) {
+	res, err := n.Next.Result()
+	if res == nil {
+		return res, err
+	}
+	return &columnMapResult{Result: res, schema: mapSchema(res.Schema(), n.colMap)}, err
+}
+
+func (n *columnMapNext) Buffer() (*Buffer, error) {
+	b, err := n.Next.Buffer()
+	if b != nil {
+		n.mapBuffer(b)
+	}
+	return b, err
+}
+
+func (n *columnMapNext) BufferSet() (BufferSet, error) {
+	set, err := n.Next.BufferSet()
+	for _, b := range set {
+		n.mapBuffer(b)
+	}
+	return set, err
+}
+
+func (n *columnMapNext) mapBuffer(b *Buffer) {
+	b.Schema = mapSchema(b.Schema, n.colMap)
+	for _, row := range b.Row {
+		if vr, ok := row.(*ValueRow); ok {
+			vr.Schema = b.Schema
+		}
+	}
+}
+
+type columnMapResult struct {
+	Result
+
+	schema Schema
+}
+
+func (res *columnMapResult) Schema() Schema {
+	return res.schema
+}
+
+func (res *columnMapResult) Prep(name string, value interface{}) Result {
+	if col, found := res.column(name); found {
+		return res.Prepx(col.Index, value)
+	}
+	res.Result.Prep(name, value)
+	return res
+}
+
+func (res *columnMapResult) Prepx(index int, value interface{}) Result {
+	res.Result.Prepx(index, value)
+	return res
+}
+
+func (res *columnMapResult) column(name string) (Column, bool) {
+	for _, col := range res.schema {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return Column{}, false
+}
+
+func (res *columnMapResult) Scan() (Row, error) {
+	row, err := res.Result.Scan()
+	if row == nil {
+		return row, err
+	}
+	if vr, ok := row.(*ValueRow); ok {
+		vr.Schema = res.schema
+		return vr, err
+	}
+	return &columnMapRow{Row: row, res: res}, err
+}
+
+func (res *columnMapResult) ScanInto(row *ValueRow) (bool, error) {
+	ok, err := ScanInto(res.Result, row)
+	if ok {
+		row.Schema = res.schema
+	}
+	return ok, err
+}
+
+// columnMapRow looks up columns of a driver row by their mapped names.
+type columnMapRow struct {
+	Row
+
+	res *columnMapResult
+}
+
+func (r *columnMapRow) nullAsZero() bool {
+	return rowNullAsZero(r.Row)
+}
+
+func (r *columnMapRow) Get(name string) interface{} {
+	if col, found := r.res.column(name); found {
+		return r.Row.Getx(col.Index)
+	}
+	return r.Row.Get(name)
+}
+
+func (r *columnMapRow) Into(name string, value interface{}) Row {
+	if col, found := r.res.column(name); found {
+		return r.Intox(col.Index, value)
+	}
+	r.Row.Into(name, value)
+	return r
+}
+
+func (r *columnMapRow) Intox(index int, value interface{}) Row {
+	r.Row.Intox(index, value)
+	return r
+}
+
+// ParamsFromStruct returns a named parameter for each field of the struct
+// or pointer to struct v. Fields are named and matched as in IntoStruct.
+// Fields of a nil embedded struct pointer are omitted.
+func ParamsFromStruct(v interface{}) ([]Param, error) {
+	sv := reflect.ValueOf(v)
+	for sv.Kind() == reflect.Ptr && !sv.IsNil() {
+		sv = sv.Elem()
+	}
+	if sv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("rdb: parameter source %T is not a struct", v)
+	}
+	fields := structFields(sv.Type())
+	params := make([]Param, 0, len(fields.list))
+	for _, f := range fields.list {
+		fv, ok := fieldValue(sv, f.index)
+		if !ok {
+			continue
+		}
+		params = append(params, Param{Name: f.name, Value: fv.Interface()})
+	}
+	return params, nil
+}
+
+// fieldValue returns the field or false if it is in a nil embedded pointer.
+func fieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// Struct returns a parameter that is replaced by the parameters of
+// ParamsFromStruct(v) when the query is run.
+//
+//	pool.Query(ctx, &rdb.Command{SQL: "insert into Account values (@ID, @Name);"}, rdb.Struct(account))
+func Struct(v interface{}) Param {
+	return Param{Value: structParam{v: v}}
+}
+
+type structParam struct {
+	v interface{}
+}
+
+// expandParams replaces parameters from Struct with the struct fields.
+func expandParams(params []Param) ([]Param, error) {
+	found := false
+	for _, p := range params {
+		if _, ok := p.Value.(structParam); ok {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return params, nil
+	}
+	out := make([]Param, 0, len(params))
+	for _, p := range params {
+		sp, ok := p.Value.(structParam)
+		if !ok {
+			out = append(out, p)
+			continue
+		}
+		fields, err := ParamsFromStruct(sp.v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, fields...)
+	}
+	return out, nil
+}
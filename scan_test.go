@@ -0,0 +1,325 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+type user struct {
+	ID   int64
+	Name string `db:"name"`
+	Skip string `db:"-"`
+}
+
+func TestColumnMap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select usr_id, usr_name from usr;").Returns(
+		rdbtest.NewResult("usr_id", "usr_name").Row(int64(4), "Ann"),
+	)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := &rdb.Command{
+		SQL: "select usr_id, usr_name from usr;",
+		ColumnMap: map[string]string{
+			"usr_id":   "ID",
+			"usr_name": "name",
+		},
+	}
+
+	res, err := pool.Query(ctx, cmd).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	row, err := res.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var u user
+	if err := rdb.IntoStruct(row, res.Schema(), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 4 || u.Name != "Ann" {
+		t.Fatalf("unexpected struct %+v", u)
+	}
+	if row.Get("name") != "Ann" {
+		t.Fatal("scanned row not renamed")
+	}
+	res.Close()
+
+	// Columns bound and read by their mapped names.
+	res, err = pool.Query(ctx, cmd).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	var id int64
+	row, err = res.Prep("name", &name).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row.Into("ID", &id)
+	if name != "Ann" || id != 4 || row.Get("ID") != int64(4) {
+		t.Fatalf("got name %q, id %d", name, id)
+	}
+	res.Close()
+
+	res, err = pool.Query(ctx, cmd).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vr rdb.ValueRow
+	if ok, err := rdb.ScanInto(res, &vr); !ok || err != nil {
+		t.Fatalf("got %t, %v", ok, err)
+	}
+	if vr.Get("name") != "Ann" {
+		t.Fatal("row read with ScanInto not renamed")
+	}
+	res.Close()
+
+	b, err := pool.Query(ctx, cmd).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := rdb.Map(b.Row[0], b.Schema)
+	if len(m) != 2 || m["ID"] != int64(4) || m["name"] != "Ann" {
+		t.Fatalf("unexpected map %v", m)
+	}
+	if b.Row[0].Get("name") != "Ann" {
+		t.Fatal("buffered row not renamed")
+	}
+}
+
+type base struct {
+	ID      int64
+	Created string `db:"created_at"`
+}
+
+type account struct {
+	base
+	Name  *string
+	other int
+}
+
+func TestIntoStructMode(t *testing.T) {
+	schema := func(names ...string) rdb.Schema {
+		sch := make(rdb.Schema, len(names))
+		for i, name := range names {
+			sch[i] = rdb.Column{Name: name, Index: i}
+		}
+		return sch
+	}
+	list := []struct {
+		name   string
+		schema rdb.Schema
+		ok     [3]bool // Lenient, Strict, RequireAllColumns.
+	}{
+		{name: "match", schema: schema("ID", "name"), ok: [3]bool{true, true, true}},
+		{name: "extra column", schema: schema("ID", "name", "extra"), ok: [3]bool{true, false, false}},
+		{name: "missing column", schema: schema("ID"), ok: [3]bool{true, false, true}},
+	}
+	modes := []rdb.ScanMode{rdb.ScanLenient, rdb.ScanStrict, rdb.ScanRequireAllColumns}
+	for _, item := range list {
+		row := &rdb.ValueRow{Schema: item.schema, Values: []interface{}{int64(3), "Ann", 1.5}[:len(item.schema)]}
+		for i, mode := range modes {
+			var u user
+			err := rdb.IntoStructMode(row, row.Schema, &u, mode)
+			if item.ok[i] != (err == nil) {
+				t.Errorf("%s, mode %d: got error %v", item.name, mode, err)
+				continue
+			}
+			if err != nil && u.ID != 0 {
+				t.Errorf("%s, mode %d: field set before error %+v", item.name, mode, u)
+			}
+			if err == nil && u.ID != 3 {
+				t.Errorf("%s, mode %d: got %+v", item.name, mode, u)
+			}
+		}
+	}
+}
+
+func TestCollectScanMode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select ID, name, Email from Account;").Returns(
+		rdbtest.NewResult("ID", "name", "Email").Row(int64(1), "Ann", "ann@example.com"),
+	)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	cmd := &rdb.Command{SQL: "select ID, name, Email from Account;"}
+	users, err := rdb.Collect[user](ctx, pool, cmd)
+	if err != nil || len(users) != 1 || users[0].Name != "Ann" {
+		t.Fatalf("lenient: got %+v, %v", users, err)
+	}
+	cmd.ScanMode = rdb.ScanRequireAllColumns
+	if _, err := rdb.Collect[user](ctx, pool, cmd); err == nil || !strings.Contains(err.Error(), `"Email"`) {
+		t.Fatalf("require all columns: got error %v", err)
+	}
+}
+
+func TestIntoStructEmbedded(t *testing.T) {
+	row := &rdb.ValueRow{
+		Schema: rdb.Schema{{Name: "id", Index: 0}, {Name: "created_at", Index: 1}, {Name: "NAME", Index: 2}, {Name: "extra", Index: 3}},
+		Values: []interface{}{int64(9), "today", "Bo", 1.5},
+	}
+	var a account
+	if err := rdb.IntoStruct(row, row.Schema, &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.ID != 9 || a.Created != "today" || a.Name == nil || *a.Name != "Bo" {
+		t.Fatalf("unexpected struct %+v", a)
+	}
+	if err := rdb.IntoStruct(row, row.Schema, a); err == nil {
+		t.Fatal("expected error for non-pointer destination")
+	}
+}
+
+// money is stored in cents and parsed from text such as "12.34".
+type money int64
+
+func (m *money) UnmarshalText(text []byte) error {
+	var whole, cents int64
+	if _, err := fmt.Sscanf(string(text), "%d.%d", &whole, &cents); err != nil {
+		return err
+	}
+	*m = money(whole*100 + cents)
+	return nil
+}
+
+// code implements sql.Scanner and records NULL.
+type code struct {
+	Value string
+	Null  bool
+}
+
+func (c *code) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		c.Null = true
+	case []byte:
+		c.Value = strings.ToUpper(string(v))
+	case string:
+		c.Value = strings.ToUpper(v)
+	default:
+		return fmt.Errorf("cannot scan %T into code", src)
+	}
+	return nil
+}
+
+type invoice struct {
+	Total  money
+	Tax    *money
+	Code   code
+	Region code
+}
+
+func TestIntoUnmarshalerAndScanner(t *testing.T) {
+	row := &rdb.ValueRow{
+		Schema: rdb.Schema{{Name: "Total", Index: 0}, {Name: "Tax", Index: 1}, {Name: "Code", Index: 2}, {Name: "Region", Index: 3}},
+		Values: []interface{}{"12.34", []byte("1.05"), []byte("ab"), nil},
+	}
+	var inv invoice
+	if err := rdb.IntoStruct(row, row.Schema, &inv); err != nil {
+		t.Fatal(err)
+	}
+	if inv.Total != 1234 || inv.Tax == nil || *inv.Tax != 105 {
+		t.Errorf("unexpected money %d %v", inv.Total, inv.Tax)
+	}
+	if inv.Code.Value != "AB" || inv.Code.Null || !inv.Region.Null {
+		t.Errorf("unexpected codes %+v %+v", inv.Code, inv.Region)
+	}
+
+	var m money
+	row.Into("Total", &m)
+	if m != 1234 {
+		t.Errorf("Into got %d", m)
+	}
+
+	bad := &rdb.ValueRow{Schema: rdb.Schema{{Name: "Total"}}, Values: []interface{}{"n/a"}}
+	if err := rdb.IntoStruct(bad, bad.Schema, &inv); err == nil {
+		t.Error("expected UnmarshalText error")
+	}
+}
+
+func TestStructParam(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type Audit struct {
+		CreatedBy string `db:"created_by"`
+		Internal  string `db:"-"`
+	}
+	type Account struct {
+		Audit
+		ID   int64
+		Name string `db:"name"`
+		note string
+	}
+
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderDollar
+	const want = "insert into Account (ID, Name, CreatedBy) values ($1, $2, $3);"
+	fake.Expect(want)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Account{Audit: Audit{CreatedBy: "admin", Internal: "x"}, ID: 4, Name: "Ann", note: "y"}
+	cmd := &rdb.Command{SQL: "insert into Account (ID, Name, CreatedBy) values (@ID, @name, @created_by);"}
+	if err := pool.Query(ctx, cmd, rdb.Struct(a)).Close(); err != nil {
+		t.Fatal(err)
+	}
+	st, err := pool.Prepare(ctx, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Exec(ctx, rdb.Struct(*a)).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range fake.Calls() {
+		if c.Op != rdbtest.OpQuery {
+			continue
+		}
+		if len(c.Params) != 3 || c.Params[0].Value != int64(4) || c.Params[1].Value != "Ann" || c.Params[2].Value != "admin" {
+			t.Fatalf("unexpected params %+v", c.Params)
+		}
+	}
+
+	params, err := rdb.ParamsFromStruct(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range params {
+		names = append(names, p.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"created_by", "ID", "name"}) {
+		t.Fatalf("got names %v", names)
+	}
+	if _, err := rdb.ParamsFromStruct(5); err == nil {
+		t.Fatal("expected error for non-struct")
+	}
+}
@@ -23,4 +23,9 @@ type Column struct {
 	Serial    bool // True if the column is auto-incrementing.
 	Precision int  // For decimal types, the precision.
 	Scale     int  // For types with scale, including decimal.
+
+	// Comment is the description of the column, such as an SQL Server
+	// extended property or a PostgreSQL col_description. Drivers set it if
+	// Config.FetchColumnComments is set and the column has one.
+	Comment string
 }
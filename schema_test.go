@@ -0,0 +1,59 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestColumnComments(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "select ID, Name, Created from Account;"
+	comments := func(fetch bool) []string {
+		fake := rdbtest.New()
+		fake.Comments = map[string]string{
+			"ID":   "Account number.",
+			"Name": "Display name of the account.",
+		}
+		fake.Expect(sql).Returns(rdbtest.NewResult("ID", "Name", "Created").Row(int64(1), "Ann", nil))
+		conf := fake.Config()
+		conf.FetchColumnComments = fetch
+		pool, err := rdb.Open(ctx, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pool.Close()
+
+		res, err := pool.Query(ctx, &rdb.Command{SQL: sql}).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Close()
+		var list []string
+		for _, col := range res.Schema() {
+			list = append(list, col.Comment)
+		}
+		return list
+	}
+
+	got := comments(true)
+	want := []string{"Account number.", "Display name of the account.", ""}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got comments %q, want %q", got, want)
+		}
+	}
+	for _, c := range comments(false) {
+		if len(c) != 0 {
+			t.Fatalf("got comment %q without FetchColumnComments", c)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import "sync"
+
+// SchemaCache holds the result schemas of the statements prepared on a
+// connection so a driver may skip describing the results of repeated
+// executions. The key identifies a prepared statement, such as its handle,
+// and must be comparable. Entries must be invalidated when the statement is
+// closed or prepared again. The zero value is ready to use and it is safe
+// for concurrent use.
+//
+// Cached schemas are shared by every result of the statement and must not
+// be modified.
+type SchemaCache struct {
+	mu   sync.Mutex
+	list map[interface{}][]Schema
+}
+
+// Get returns the schema of the result at index of the statement.
+func (c *SchemaCache) Get(key interface{}, index int) (Schema, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list := c.list[key]
+	if index < 0 || index >= len(list) || list[index] == nil {
+		return nil, false
+	}
+	return list[index], true
+}
+
+// Put caches the schema of the result at index of the statement.
+func (c *SchemaCache) Put(key interface{}, index int, sch Schema) {
+	if index < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.list == nil {
+		c.list = make(map[interface{}][]Schema)
+	}
+	list := c.list[key]
+	for len(list) <= index {
+		list = append(list, nil)
+	}
+	list[index] = sch
+	c.list[key] = list
+}
+
+// Invalidate removes the schemas of the statement.
+func (c *SchemaCache) Invalidate(key interface{}) {
+	c.mu.Lock()
+	delete(c.list, key)
+	c.mu.Unlock()
+}
+
+// Reset removes every schema, such as when the connection is reset.
+func (c *SchemaCache) Reset() {
+	c.mu.Lock()
+	c.list = nil
+	c.mu.Unlock()
+}
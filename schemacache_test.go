@@ -0,0 +1,122 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+const schemaSQL = "select ID, Name from Account where ID = ?;"
+
+func schemaPool(tb testing.TB, ctx context.Context, cache bool) (*rdbtest.Pool, rdb.Pool) {
+	fake := rdbtest.New()
+	fake.Expect(schemaSQL).Returns(rdbtest.NewResult("ID", "Name").Row(int64(1), "Ann"))
+	conf := fake.Config()
+	conf.CacheSchema = cache
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return fake, pool
+}
+
+// execSchema runs the statement and returns the schema of its result.
+func execSchema(tb testing.TB, ctx context.Context, stmt rdb.Statement) (rdb.Schema, bool) {
+	next := stmt.Exec(ctx, rdb.Param{Value: int64(1)})
+	defer next.Close()
+	res, err := next.Result()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return res.Schema(), rdb.PreparedCacheHit(next)
+}
+
+func TestSchemaCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake, pool := schemaPool(t, ctx, true)
+	defer pool.Close()
+
+	buf, err := pool.Query(ctx, &rdb.Command{SQL: schemaSQL}, rdb.Param{Value: int64(1)}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := buf.Schema
+
+	stmt, err := pool.Prepare(ctx, &rdb.Command{SQL: schemaSQL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		sch, _ := execSchema(t, ctx, stmt)
+		if !reflect.DeepEqual(sch, fresh) {
+			t.Fatalf("exec %d: got schema %+v, want %+v", i, sch, fresh)
+		}
+	}
+	if got := fake.Describes(); got != 2 {
+		t.Fatalf("got %d describes, want 2", got)
+	}
+
+	// A statement prepared again is described again.
+	fake.Unprepare()
+	sch, hit := execSchema(t, ctx, stmt)
+	if hit {
+		t.Fatal("statement not prepared again")
+	}
+	if !reflect.DeepEqual(sch, fresh) {
+		t.Fatalf("got schema %+v, want %+v", sch, fresh)
+	}
+	execSchema(t, ctx, stmt)
+	if got := fake.Describes(); got != 3 {
+		t.Fatalf("got %d describes after prepare, want 3", got)
+	}
+
+	// Without CacheSchema every execution is described.
+	fake, pool = schemaPool(t, ctx, false)
+	defer pool.Close()
+	stmt, err = pool.Prepare(ctx, &rdb.Command{SQL: schemaSQL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		execSchema(t, ctx, stmt)
+	}
+	if got := fake.Describes(); got != 3 {
+		t.Fatalf("got %d describes without cache, want 3", got)
+	}
+}
+
+func benchmarkSchema(b *testing.B, cache bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake, pool := schemaPool(b, ctx, cache)
+	defer pool.Close()
+	stmt, err := pool.Prepare(ctx, &rdb.Command{SQL: schemaSQL})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		execSchema(b, ctx, stmt)
+	}
+	b.ReportMetric(float64(fake.Describes())/float64(b.N), "describes/op")
+}
+
+func BenchmarkSchemaDescribe(b *testing.B) {
+	benchmarkSchema(b, false)
+}
+
+func BenchmarkSchemaCache(b *testing.B) {
+	benchmarkSchema(b, true)
+}
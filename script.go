@@ -0,0 +1,171 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// ScriptOpts are the options of RunScript.
+type ScriptOpts struct {
+	// Run the script in a transaction that is committed after the last
+	// statement and rolled back if a statement fails. The Queryer must be a
+	// Pool or a Transaction. If it is a Transaction the statements are run
+	// in it and it is left to the caller to commit.
+	Transactional bool
+
+	// Isolation of the transaction if Transactional.
+	Isolation Isolation
+
+	// BatchSeparator is a line, such as "GO", that separates batches sent
+	// whole to the server. Empty uses "GO" if the driver quotes
+	// identifiers in brackets, as SQL Server does, otherwise the script is
+	// split on ";" terminators.
+	BatchSeparator string
+}
+
+// ScriptError is returned by RunScript when a statement fails.
+type ScriptError struct {
+	Index int    // Index of the statement in the script, starting at 1.
+	SQL   string // Statement that failed.
+	Err   error  // Error returned by the statement.
+}
+
+func (err *ScriptError) Error() string {
+	return fmt.Sprintf("rdb: script statement %d: %v", err.Index, err.Err)
+}
+
+var errScriptTx = errors.New("rdb: transactional script requires a Pool or Transaction")
+
+// RunScript splits the script into statements and runs them in order,
+// stopping at the first error, which is returned as a *ScriptError.
+// String literals, quoted identifiers, comments and PostgreSQL
+// dollar-quoted bodies such as $$ ... $$ are not split.
+func RunScript(ctx context.Context, q Queryer, script string, opts ScriptOpts) error {
+	sep := opts.BatchSeparator
+	if len(sep) == 0 && CapabilitiesOf(q).Quote == QuoteBracket {
+		sep = "GO"
+	}
+	list := splitScript(script, sep)
+	if !opts.Transactional {
+		return runScript(ctx, q, list)
+	}
+	switch db := q.(type) {
+	case Transaction:
+		return runScript(ctx, db, list)
+	case Pool:
+		txCtx, cancel := context.WithCancel(ctx)
+		// Cancel rolls back the transaction if it was not committed.
+		defer cancel()
+		tx, err := db.Begin(txCtx, opts.Isolation)
+		if err != nil {
+			return err
+		}
+		if err := runScript(txCtx, tx, list); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+	return errScriptTx
+}
+
+func runScript(ctx context.Context, q Queryer, list []string) error {
+	for i, sql := range list {
+		// Names in a script are variables for the server to resolve.
+		next := q.Query(ctx, &Command{SQL: sql, Name: "script", AllowUnboundNames: true})
+		_, err := next.BufferSet()
+		if cerr := next.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return &ScriptError{Index: i + 1, SQL: sql, Err: err}
+		}
+	}
+	return nil
+}
+
+// splitScript returns the statements of the script. If sep is set the
+// script is split on lines equal to sep, otherwise after each ";". Parts
+// with nothing but white space and comments are dropped.
+func splitScript(script, sep string) []string {
+	var list []string
+	start, content := 0, false
+	add := func(end int) {
+		if content {
+			list = append(list, strings.TrimSpace(script[start:end]))
+		}
+		content = false
+	}
+	for i := 0; i < len(script); i++ {
+		if len(sep) != 0 && (i == 0 || script[i-1] == '\n') {
+			end := skipLine(script, i)
+			if strings.EqualFold(strings.TrimSpace(script[i:end]), sep) {
+				add(i)
+				start = end
+				i = end - 1
+				continue
+			}
+		}
+		switch c := script[i]; c {
+		case '\'', '"', '`':
+			i = skipQuoted(script, i, c)
+			content = true
+		case '-':
+			if i+1 < len(script) && script[i+1] == '-' {
+				i = skipLine(script, i) - 1
+				continue
+			}
+			content = true
+		case '/':
+			if i+1 < len(script) && script[i+1] == '*' {
+				i = skipBlockComment(script, i)
+				continue
+			}
+			content = true
+		case '$':
+			if len(sep) == 0 {
+				i = skipDollarQuoted(script, i)
+			}
+			content = true
+		case ';':
+			if len(sep) == 0 {
+				add(i + 1)
+				start = i + 1
+				continue
+			}
+			content = true
+		case ' ', '\t', '\r', '\n':
+		default:
+			content = true
+		}
+	}
+	add(len(script))
+	return list
+}
+
+// skipDollarQuoted returns the index of the end of a dollar-quoted string
+// such as $$body$$ or $tag$body$tag$ starting at i. If there is no tag at i,
+// such as for a $1 parameter, i is returned.
+func skipDollarQuoted(sql string, i int) int {
+	end := i + 1
+	for end < len(sql) && isIdentPart(sql[end]) {
+		if end == i+1 && !isIdentStart(sql[end]) {
+			return i
+		}
+		end++
+	}
+	if end >= len(sql) || sql[end] != '$' {
+		return i
+	}
+	tag := sql[i : end+1]
+	if n := strings.Index(sql[end+1:], tag); n >= 0 {
+		return end + n + len(tag)
+	}
+	return len(sql)
+}
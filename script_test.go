@@ -0,0 +1,164 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+// callSQL returns the SQL of each query run on the fake.
+func callSQL(fake *rdbtest.Pool) []string {
+	var list []string
+	for _, c := range fake.Calls() {
+		if c.Op == rdbtest.OpQuery {
+			list = append(list, c.SQL)
+		}
+	}
+	return list
+}
+
+func TestRunScript(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const script = `
+-- Accounts; created first.
+create table Account (ID int, Name text);
+insert into Account values (1, 'semi;colon');
+create function touch() returns trigger as $body$
+begin
+	new.Updated = now(); return new;
+end;
+$body$ language plpgsql;
+/* done; */
+`
+	want := []string{
+		"-- Accounts; created first.\ncreate table Account (ID int, Name text);",
+		"insert into Account values (1, 'semi;colon');",
+		"create function touch() returns trigger as $body$\nbegin\n\tnew.Updated = now(); return new;\nend;\n$body$ language plpgsql;",
+	}
+	fake := rdbtest.New()
+	for _, sql := range want {
+		fake.Expect(sql)
+	}
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	if err := rdb.RunScript(ctx, pool, script, rdb.ScriptOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := callSQL(fake); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got statements %q, want %q", got, want)
+	}
+}
+
+func TestRunScriptVariables(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const batch = "declare @n int = 1;\nselect @n;"
+	fake := rdbtest.New()
+	fake.Quote = rdb.QuoteBracket
+	fake.Style = rdb.PlaceholderAtP
+	fake.Expect(batch)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	if err := rdb.RunScript(ctx, pool, batch+"\nGO\n", rdb.ScriptOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := callSQL(fake); !reflect.DeepEqual(got, []string{batch}) {
+		t.Fatalf("got statements %q", got)
+	}
+}
+
+func TestRunScriptBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const script = "create table Account (ID int);\ninsert into Account values (1);\nGO\ncreate procedure Touch as\n\tselect 'GO';\n  go  \n"
+	want := []string{
+		"create table Account (ID int);\ninsert into Account values (1);",
+		"create procedure Touch as\n\tselect 'GO';",
+	}
+	fake := rdbtest.New()
+	fake.Quote = rdb.QuoteBracket
+	for _, sql := range want {
+		fake.Expect(sql)
+	}
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	if err := rdb.RunScript(ctx, pool, script, rdb.ScriptOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := callSQL(fake); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got batches %q, want %q", got, want)
+	}
+}
+
+func TestRunScriptRollback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errFail := errors.New("table exists")
+	fake := rdbtest.New()
+	fake.Expect("create table A (ID int);")
+	fake.Expect("create table B (ID int);").Error(errFail)
+	fake.Expect("create table C (ID int);")
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	const script = "create table A (ID int); create table B (ID int); create table C (ID int);"
+	err = rdb.RunScript(ctx, pool, script, rdb.ScriptOpts{Transactional: true})
+	serr, ok := err.(*rdb.ScriptError)
+	if !ok || serr.Index != 2 || serr.Err != errFail || serr.SQL != "create table B (ID int);" {
+		t.Fatalf("got error %#v", err)
+	}
+
+	ops := func() []rdbtest.Op {
+		var ops []rdbtest.Op
+		for _, c := range fake.Calls() {
+			ops = append(ops, c.Op)
+		}
+		return ops
+	}
+	want := []rdbtest.Op{rdbtest.OpBegin, rdbtest.OpQuery, rdbtest.OpQuery, rdbtest.OpRollback}
+	for i := 0; i < 100 && len(ops()) < len(want); i++ {
+		// The rollback is run when the transaction context is done.
+		time.Sleep(time.Millisecond)
+	}
+	if got := ops(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got ops %v, want %v", got, want)
+	}
+
+	conn, err := pool.Connection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := rdb.RunScript(ctx, conn, script, rdb.ScriptOpts{Transactional: true}); err == nil {
+		t.Fatal("expected error for transactional script on a connection")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// ServerInfo describes the server a pool is connected to.
+type ServerInfo struct {
+	Version    string // Server product version.
+	Database   string // Current database of the connection.
+	ServerName string // Name of the server or host.
+}
+
+// ServerInfoQueryer may be implemented by a driver Pool to provide the
+// query run by QueryServerInfo, such as
+// "select @@VERSION as Version, DB_NAME() as Database, @@SERVERNAME as ServerName;".
+// It returns one row with the columns "Version", "Database" and
+// "ServerName". Missing columns are left empty.
+type ServerInfoQueryer interface {
+	ServerInfoSQL() string
+}
+
+// QueryServerInfo runs the server info query of the driver, which also
+// tests that the server may be reached. ErrNotSupported is returned if the
+// driver does not implement ServerInfoQueryer.
+func QueryServerInfo(ctx context.Context, q Queryer) (ServerInfo, error) {
+	var info ServerInfo
+	sq, ok := driverOf(q).(ServerInfoQueryer)
+	if !ok || len(sq.ServerInfoSQL()) == 0 {
+		return info, ErrNotSupported
+	}
+	next := q.Query(ctx, &Command{SQL: sq.ServerInfoSQL(), Name: "server info"})
+	defer next.Close()
+	b, err := next.Buffer()
+	if err != nil {
+		return info, err
+	}
+	if b == nil || len(b.Row) != 1 {
+		return info, fmt.Errorf("rdb: server info query did not return a single row")
+	}
+	row := b.Row[0]
+	for _, col := range b.Schema {
+		var field *string
+		switch col.Name {
+		case "Version":
+			field = &info.Version
+		case "Database":
+			field = &info.Database
+		case "ServerName":
+			field = &info.ServerName
+		default:
+			continue
+		}
+		switch v := row.Getx(col.Index).(type) {
+		case nil:
+		case []byte:
+			*field = string(v)
+		default:
+			*field = fmt.Sprint(v)
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestQueryServerInfo(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "select @@VERSION as Version, DB_NAME() as Database, @@SERVERNAME as ServerName;"
+	fake := rdbtest.New()
+	fake.InfoSQL = sql
+	fake.Expect(sql).Returns(rdbtest.NewResult("Version", "Database", "ServerName").
+		Row("Microsoft SQL Server 2016 (SP1) - 13.0.4001.0", []byte("app"), "DB1\\SQLEXPRESS"))
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	info, err := rdb.QueryServerInfo(ctx, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rdb.ServerInfo{
+		Version:    "Microsoft SQL Server 2016 (SP1) - 13.0.4001.0",
+		Database:   "app",
+		ServerName: "DB1\\SQLEXPRESS",
+	}
+	if info != want {
+		t.Fatalf("got %+v, want %+v", info, want)
+	}
+
+	other := rdbtest.New()
+	otherPool, err := rdb.Open(ctx, other.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otherPool.Close()
+	if _, err := rdb.QueryServerInfo(ctx, otherPool); err != rdb.ErrNotSupported {
+		t.Fatalf("got %v, want ErrNotSupported", err)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+)
+
+// ErrStmtClosed is returned when a closed Stmt is queried.
+var ErrStmtClosed = errors.New("rdb: statement closed")
+
+// Stmt is a prepared statement that may be shared and queried from many
+// goroutines until it is closed. The driver prepares it on each connection
+// it runs on.
+type Stmt struct {
+	st     Statement
+	cancel func()
+	closed int32 // Set to 1 when closed, accessed atomically.
+}
+
+// PrepareStmt prepares the command. The statement is closed when Close is
+// called or the context is done, which un-prepares it on every connection.
+func PrepareStmt(ctx context.Context, p Preparer, cmd *Command) (*Stmt, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	st, err := p.Prepare(ctx, cmd)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Stmt{st: st, cancel: cancel}, nil
+}
+
+// Query runs the statement with the params. ErrStmtClosed is returned if
+// the statement is closed.
+func (s *Stmt) Query(ctx context.Context, params ...Param) Next {
+	if atomic.LoadInt32(&s.closed) != 0 {
+		return &nextError{err: ErrStmtClosed}
+	}
+	return s.st.Exec(ctx, params...)
+}
+
+// Close the statement. Queries already running are not stopped.
+func (s *Stmt) Close() {
+	if atomic.CompareAndSwapInt32(&s.closed, 0, 1) {
+		s.cancel()
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestStmt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "select Name from Account where ID = ?;"
+	fake := rdbtest.New()
+	fake.Expect(sql).Returns(rdbtest.NewResult("Name").Row("Ann"))
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	stmt, err := rdb.PrepareStmt(ctx, pool, &rdb.Command{SQL: sql})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two queries open at once run on two connections.
+	first := stmt.Query(ctx, rdb.Param{Value: 1})
+	second := stmt.Query(ctx, rdb.Param{Value: 2})
+	for _, next := range []rdb.Next{first, second} {
+		if rdb.PreparedCacheHit(next) {
+			t.Error("statement already prepared on a new connection")
+		}
+		if _, err := next.BufferSet(); err != nil {
+			t.Fatal(err)
+		}
+		next.Close()
+	}
+	if got := fake.Prepared(sql); got != 2 {
+		t.Fatalf("prepared on %d connections, want 2", got)
+	}
+	next := stmt.Query(ctx, rdb.Param{Value: 3})
+	if !rdb.PreparedCacheHit(next) {
+		t.Error("prepared statement not reused")
+	}
+	next.Close()
+
+	stmt.Close()
+	for i := 0; i < 100 && fake.Prepared(sql) != 0; i++ {
+		// The statement is un-prepared when its context is done.
+		time.Sleep(time.Millisecond)
+	}
+	if got := fake.Prepared(sql); got != 0 {
+		t.Fatalf("prepared on %d connections after close", got)
+	}
+	if err := stmt.Query(ctx, rdb.Param{Value: 1}).Close(); err != rdb.ErrStmtClosed {
+		t.Fatalf("got %v, want %v", err, rdb.ErrStmtClosed)
+	}
+	var ops int
+	for _, c := range fake.Calls() {
+		if c.Op == rdbtest.OpUnprepare {
+			ops++
+		}
+	}
+	if ops != 1 {
+		t.Fatalf("got %d unprepare calls, want 1", ops)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("context of the caller ended")
+	}
+}
+
+func TestStatementSettings(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const (
+		sqlAccount = "select Name, Born from Account where ID = ?;"
+		sqlSlow    = "select Name from Report where ID = ?;"
+		sqlAudit   = "exec Audit ?;"
+	)
+	fake := rdbtest.New()
+	fake.Expect(sqlAccount).Returns(rdbtest.NewResult("Name", "Born").Row("ann", "02/01/2016"))
+	fake.Expect(sqlSlow).Delay(time.Second)
+	fake.Expect(sqlAudit).Returns(rdbtest.NewResult("Line").Row("a"))
+	conf := fake.Config()
+	conf.TimeLayouts = []string{"02/01/2006"}
+	conf.DefaultCommand.Timeout = 20 * time.Millisecond
+	conf.BeforeQuery = func(ctx context.Context, cmd *rdb.Command, params []rdb.Param) (*rdb.Command, []rdb.Param, error) {
+		return cmd, append([]rdb.Param{{Value: 7}}, params[1:]...), nil
+	}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	prepare := func(cmd *rdb.Command) rdb.Statement {
+		st, err := pool.Prepare(ctx, cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+
+	st := prepare(&rdb.Command{
+		SQL:       sqlAccount,
+		ColumnMap: map[string]string{"Name": "FullName"},
+		Converter: func(col rdb.Column, v interface{}) (interface{}, error) {
+			if s, ok := v.(string); ok && col.Name == "FullName" {
+				return strings.ToUpper(s), nil
+			}
+			return v, nil
+		},
+	})
+	b, err := st.Exec(ctx, rdb.Param{Value: 1}).Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	var born time.Time
+	b.Row[0].Into("FullName", &name).Into("Born", &born)
+	if name != "ANN" || born.Month() != time.January || born.Day() != 2 {
+		t.Fatalf("got %q born %v", name, born)
+	}
+	calls := fake.Calls()
+	if p := calls[len(calls)-1].Params; len(p) != 1 || p[0].Value != 7 {
+		t.Fatalf("got params %v, want those from BeforeQuery", p)
+	}
+
+	start := time.Now()
+	_, err = prepare(&rdb.Command{SQL: sqlSlow}).Exec(ctx, rdb.Param{Value: 1}).Buffer()
+	if err != context.DeadlineExceeded || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("got %v after %v, want the default timeout", err, time.Since(start))
+	}
+
+	next := prepare(&rdb.Command{SQL: sqlAudit, Discard: true}).Exec(ctx, rdb.Param{Value: 1})
+	if res, err := next.Result(); res != nil || err != nil {
+		t.Fatalf("got result %v, error %v, want results discarded", res, err)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// TruncInfo reports text that was truncated to fit a column because the
+// command set TruncLongText.
+type TruncInfo struct {
+	Column    string // Name of the column or parameter.
+	Length    int    // Length of the text in characters.
+	Truncated int    // Length of the text after it was truncated.
+}
+
+// TruncError may be returned by a driver for text longer then the column
+// or parameter when truncation is not allowed, see TruncLongText.
+type TruncError struct {
+	Column string // Name of the column or parameter.
+	Length int    // Length of the text in characters.
+	Max    int    // Max length of the column or parameter.
+}
+
+func (err *TruncError) Error() string {
+	return fmt.Sprintf("rdb: text of %q is %d characters, longer then %d", err.Column, err.Length, err.Max)
+}
+
+// TruncLongText returns true if text of the parameter may be truncated to
+// fit: the TruncLongText of the parameter, or of the command if it is
+// FlagDefault. Drivers should use it rather then reading the command.
+func TruncLongText(cmd *Command, param Param) bool {
+	return param.TruncLongText.Bool(cmd.TruncLongText)
+}
+
+// TruncText returns the text cut to max characters. If it is cut the
+// truncation is reported to OnTruncate. Drivers should use it for each
+// text value they truncate when TruncLongText returns true.
+func (c *Config) TruncText(column, text string, max int) string {
+	if max < 0 || len(text) <= max {
+		return text
+	}
+	n := utf8.RuneCountInString(text)
+	if n <= max {
+		return text
+	}
+	end := 0
+	for i := 0; i < max; i++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	if c.OnTruncate != nil {
+		c.OnTruncate(TruncInfo{Column: column, Length: n, Truncated: max})
+	}
+	return text[:end]
+}
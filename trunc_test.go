@@ -0,0 +1,105 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestOnTruncate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "insert into Note (Title, Body) values (@title, @body);"
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderAtP
+	fake.Expect(sql)
+	var list []rdb.TruncInfo
+	conf := fake.Config()
+	conf.OnTruncate = func(info rdb.TruncInfo) {
+		list = append(list, info)
+	}
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	params := []rdb.Param{
+		{Name: "title", Length: 10, Value: "short"},
+		{Name: "body", Length: 5, Value: "héllo world"},
+	}
+	cmd := &rdb.Command{SQL: sql}
+	if err := pool.Query(ctx, cmd, params...).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("reported %+v without TruncLongText", list)
+	}
+
+	cmd.TruncLongText = true
+	if err := pool.Query(ctx, cmd, params...).Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []rdb.TruncInfo{{Column: "body", Length: 11, Truncated: 5}}
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("got %+v, want %+v", list, want)
+	}
+	calls := fake.Calls()
+	if got := calls[len(calls)-1].Params[1].Value; got != "héllo" {
+		t.Fatalf("got value %q sent, want %q", got, "héllo")
+	}
+	if params[1].Value != "héllo world" {
+		t.Fatal("caller parameter changed")
+	}
+}
+
+func TestParamTruncLongText(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "insert into Log (Code, Detail) values (@code, @detail);"
+	fake := rdbtest.New()
+	fake.Style = rdb.PlaceholderAtP
+	fake.StrictLength = true
+	fake.Expect(sql)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	cmd := &rdb.Command{SQL: sql}
+	detail := rdb.Param{Name: "detail", Length: 8, Value: "stack trace follows", TruncLongText: rdb.FlagTrue}
+	err = pool.Query(ctx, cmd, rdb.Param{Name: "code", Length: 4, Value: "E100"}, detail).Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := fake.Calls()
+	if got := calls[len(calls)-1].Params[1].Value; got != "stack tr" {
+		t.Fatalf("got detail %q sent, want it truncated", got)
+	}
+
+	// The code is strict while the detail is still truncated.
+	err = pool.Query(ctx, cmd, rdb.Param{Name: "code", Length: 4, Value: "E100-X"}, detail).Close()
+	want := rdb.TruncError{Column: "code", Length: 6, Max: 4}
+	if te, ok := err.(*rdb.TruncError); !ok || *te != want {
+		t.Fatalf("got %v, want %+v", err, want)
+	}
+
+	// A parameter may also opt out of truncation set on the command.
+	cmd.TruncLongText = true
+	detail.TruncLongText = rdb.FlagFalse
+	err = pool.Query(ctx, cmd, rdb.Param{Name: "code", Length: 4, Value: "E100-X"}, detail).Close()
+	want = rdb.TruncError{Column: "detail", Length: 19, Max: 8}
+	if te, ok := err.(*rdb.TruncError); !ok || *te != want {
+		t.Fatalf("got %v, want %+v", err, want)
+	}
+}
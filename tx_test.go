@@ -0,0 +1,449 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestTwoPhaseCommit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const xid = "order-42"
+	var participants []*rdbtest.Pool
+	var txs []rdb.Transaction
+	for _, sql := range []string{"insert into Orders values (42);", "update Stock set N = N - 1;"} {
+		fake := rdbtest.New()
+		fake.XA = true
+		fake.Expect(sql)
+		pool, err := rdb.Open(ctx, fake.Config())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := rdb.BeginDistributed(ctx, pool, rdb.IsoSerializable, xid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Query(ctx, &rdb.Command{SQL: sql}).Close(); err != nil {
+			t.Fatal(err)
+		}
+		participants = append(participants, fake)
+		txs = append(txs, tx)
+	}
+
+	// Phase one: every participant must prepare before any commit.
+	for _, tx := range txs {
+		if err := tx.Prepare(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := txs[0].Query(ctx, &rdb.Command{SQL: "insert into Orders values (42);"}).Close(); err == nil {
+		t.Fatal("expected error querying a prepared transaction")
+	}
+	// Phase two.
+	for _, tx := range txs {
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, fake := range participants {
+		var ops []rdbtest.Op
+		for _, c := range fake.Calls() {
+			if c.Op == rdbtest.OpBegin && c.XID != xid {
+				t.Errorf("participant %d: begin with XID %q", i, c.XID)
+			}
+			ops = append(ops, c.Op)
+		}
+		want := []rdbtest.Op{rdbtest.OpBegin, rdbtest.OpQuery, rdbtest.OpPrepareTx, rdbtest.OpCommit}
+		if !reflect.DeepEqual(ops, want) {
+			t.Errorf("participant %d: got %v, want %v", i, ops, want)
+		}
+	}
+}
+
+func TestTwoPhaseNotSupported(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rdb.BeginDistributed(ctx, pool, rdb.IsoDefault, "x"); err != rdb.ErrNotSupported {
+		t.Fatalf("got %v, want ErrNotSupported", err)
+	}
+	tx, err := pool.Begin(ctx, rdb.IsoDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Prepare(ctx); err != rdb.ErrNotSupported {
+		t.Fatalf("got %v, want ErrNotSupported", err)
+	}
+}
+
+// rename is a repository function that joins any ambient transaction.
+func rename(ctx context.Context, pool rdb.Pool, id int64, name string) error {
+	return rdb.From(ctx, pool).Query(ctx, &rdb.Command{SQL: "update Account set Name = ? where ID = ?;"},
+		rdb.Param{Value: name},
+		rdb.Param{Value: id},
+	).Close()
+}
+
+func TestContextTx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("update Account set Name = ? where ID = ?;")
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, has := rdb.TxFromContext(ctx); has {
+		t.Fatal("unexpected transaction in context")
+	}
+	if err := rename(ctx, pool, 1, "A"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := pool.Begin(ctx, rdb.IsoDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txCtx := rdb.ContextWithTx(ctx, tx)
+	if got, has := rdb.TxFromContext(txCtx); !has || got != tx {
+		t.Fatal("transaction not found in context")
+	}
+	if err := rename(txCtx, pool, 2, "B"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var queryTx []int
+	for _, c := range fake.Calls() {
+		if c.Op == rdbtest.OpQuery {
+			queryTx = append(queryTx, c.Tx)
+		}
+	}
+	if !reflect.DeepEqual(queryTx, []int{0, 1}) {
+		t.Fatalf("got query transactions %v, want [0 1]", queryTx)
+	}
+}
+
+func TestQueryIsolation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select Total from Report;").Returns(rdbtest.NewResult("Total").Row(int64(10)))
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := pool.Query(ctx, &rdb.Command{SQL: "select Total from Report;", Isolation: rdb.IsoSnapshot}).BufferSet()
+	if err != nil || len(set) != 1 || len(set[0].Row) != 1 {
+		t.Fatalf("got %v, error %v", set, err)
+	}
+	if err := pool.Query(ctx, &rdb.Command{SQL: "select Total from Report;"}).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := fake.Calls()
+	var ops []rdbtest.Op
+	for _, c := range calls {
+		ops = append(ops, c.Op)
+	}
+	want := []rdbtest.Op{rdbtest.OpBegin, rdbtest.OpQuery, rdbtest.OpCommit, rdbtest.OpQuery}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("got ops %v, want %v", ops, want)
+	}
+	if calls[0].Isolation != rdb.IsoSnapshot || calls[1].Tx != calls[0].Tx {
+		t.Fatalf("isolated query not run in snapshot transaction: %+v", calls[:2])
+	}
+	if calls[3].Tx != 0 {
+		t.Fatal("next query was run in the isolated transaction")
+	}
+}
+
+func TestContextQueryOptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "select Total from Report;"
+	fake := rdbtest.New()
+	fake.Expect(sql).Returns(rdbtest.NewResult("Total").Row(int64(10)))
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	cmd := &rdb.Command{SQL: sql}
+	if err := pool.Query(rdb.WithReadOnly(ctx), cmd).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Query(ctx, cmd).Close(); err != nil {
+		t.Fatal(err)
+	}
+	calls := fake.Calls()
+	if !calls[0].Command.ReadOnly || calls[1].Command.ReadOnly {
+		t.Fatalf("got read only %t, %t, want true, false", calls[0].Command.ReadOnly, calls[1].Command.ReadOnly)
+	}
+	if cmd.ReadOnly {
+		t.Fatal("caller command changed")
+	}
+
+	isoCtx := rdb.WithIsolation(ctx, rdb.IsoSerializable)
+	if err := pool.Query(isoCtx, cmd).Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The level of the command wins over the context.
+	if err := pool.Query(isoCtx, &rdb.Command{SQL: sql, Isolation: rdb.IsoSnapshot}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	var levels []rdb.Isolation
+	for _, c := range fake.Calls()[2:] {
+		if c.Op == rdbtest.OpBegin {
+			levels = append(levels, c.Isolation)
+		}
+	}
+	want := []rdb.Isolation{rdb.IsoSerializable, rdb.IsoSnapshot}
+	if !reflect.DeepEqual(levels, want) {
+		t.Fatalf("got levels %v, want %v", levels, want)
+	}
+}
+
+func TestQueryAtomic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "update Account set Balance = Balance - 10 where ID = 1; update Account set Balance = Balance + 10 where ID = 2;"
+	errFail := errors.New("constraint failed")
+	fake := rdbtest.New()
+	fake.Expect(sql).Returns(rdbtest.NewResult("Balance").Row(int64(90))).ErrorAfter(errFail)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	ops := func() []rdbtest.Op {
+		var ops []rdbtest.Op
+		for _, c := range fake.Calls() {
+			ops = append(ops, c.Op)
+		}
+		return ops
+	}
+
+	set, err := pool.Query(ctx, &rdb.Command{SQL: sql, Atomic: true}).BufferSet()
+	if err != errFail || len(set) != 1 {
+		t.Fatalf("got %d buffers, error %v", len(set), err)
+	}
+	want := []rdbtest.Op{rdbtest.OpBegin, rdbtest.OpQuery, rdbtest.OpRollback}
+	for i := 0; i < 100 && len(ops()) < len(want); i++ {
+		// The rollback is run when the transaction context is done.
+		time.Sleep(time.Millisecond)
+	}
+	if got := ops(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("atomic: got ops %v, want %v", got, want)
+	}
+
+	next := pool.Query(ctx, &rdb.Command{SQL: sql})
+	set, err = next.BufferSet()
+	next.Close()
+	if err != errFail || len(set) != 1 {
+		t.Fatalf("got %d buffers, error %v", len(set), err)
+	}
+	want = append(want, rdbtest.OpQuery)
+	time.Sleep(5 * time.Millisecond)
+	if got := ops(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("not atomic: got ops %v, want %v", got, want)
+	}
+}
+
+func TestQueryResultFinish(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "select Total from Report; select Name from Report;"
+	fake := rdbtest.New()
+	fake.Expect(sql).Returns(
+		rdbtest.NewResult("Total").Row(int64(10)),
+		rdbtest.NewResult("Name").Row("Ann"),
+	)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	lastOp := func() rdbtest.Op {
+		calls := fake.Calls()
+		return calls[len(calls)-1].Op
+	}
+	cmd := &rdb.Command{SQL: sql, Atomic: true}
+
+	// Only the result is closed.
+	res, err := pool.Query(ctx, cmd).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := res.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if op := lastOp(); op != rdbtest.OpCommit {
+		t.Fatalf("closed result: got last op %v, want commit", op)
+	}
+
+	// Each result is read to the end and nothing is closed.
+	next := pool.Query(ctx, cmd)
+	for i := 0; i < 2; i++ {
+		res, err := next.Result()
+		if err != nil || res == nil {
+			t.Fatalf("result %d: got %v, error %v", i, res, err)
+		}
+		for {
+			row, err := res.Scan()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row == nil {
+				break
+			}
+		}
+		if op := lastOp(); (op == rdbtest.OpCommit) != (i == 1) {
+			t.Fatalf("result %d read: got last op %v", i, op)
+		}
+	}
+	if got := len(fake.Calls()); got != 6 {
+		t.Fatalf("got %d calls, want 6", got)
+	}
+}
+
+func TestIsolationFallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Isolations = rdb.IsolationLevels(rdb.IsoReadCommited, rdb.IsoRepeatableRead, rdb.IsoSerializable)
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	list := []struct {
+		iso, want rdb.Isolation
+	}{
+		{rdb.IsoDefault, rdb.IsoDefault},
+		{rdb.IsoReadUncommited, rdb.IsoReadCommited},
+		{rdb.IsoSerializable, rdb.IsoSerializable},
+		{rdb.IsoSnapshot, rdb.IsoRepeatableRead},
+		{rdb.IsoLinearizable, rdb.IsoSerializable},
+	}
+	for i, item := range list {
+		txCtx, txCancel := context.WithCancel(ctx)
+		tx, err := pool.Begin(txCtx, item.iso)
+		if err != nil {
+			t.Fatalf("%s: %v", item.iso, err)
+		}
+		if tx.Isolation() != item.want {
+			t.Errorf("%s: got %s, want %s", item.iso, tx.Isolation(), item.want)
+		}
+		if got := fake.Calls()[i].Isolation; got != item.want {
+			t.Errorf("%s: driver got %s, want %s", item.iso, got, item.want)
+		}
+		txCancel()
+	}
+
+	strict := rdbtest.New()
+	strict.Isolations = fake.Isolations
+	conf := strict.Config()
+	conf.StrictIsolation = true
+	strictPool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer strictPool.Close()
+	if _, err := strictPool.Begin(ctx, rdb.IsoSnapshot); err == nil {
+		t.Error("strict: expected error beginning snapshot transaction")
+	}
+	if err := strictPool.Query(ctx, &rdb.Command{SQL: "select 1;", Isolation: rdb.IsoSnapshot}).Close(); err == nil {
+		t.Error("strict: expected error running snapshot query")
+	}
+	if len(strict.Calls()) != 0 {
+		t.Errorf("strict: got calls %+v", strict.Calls())
+	}
+	tx, err := strictPool.Begin(ctx, rdb.IsoRepeatableRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Isolation() != rdb.IsoRepeatableRead {
+		t.Errorf("strict: got %s, want repeatable read", tx.Isolation())
+	}
+	tx.Commit(ctx)
+}
+
+func TestDefaultIsolation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := rdbtest.New()
+	fake.Expect("select 1;")
+	conf := fake.Config()
+	conf.DefaultIsolation = rdb.IsoSerializable
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	txCtx, txCancel := context.WithCancel(ctx)
+	tx, err := pool.Begin(txCtx, rdb.IsoDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Isolation() != rdb.IsoSerializable {
+		t.Errorf("got %s, want serializable", tx.Isolation())
+	}
+	txCancel()
+
+	tx, err = pool.Begin(ctx, rdb.IsoReadCommited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Isolation() != rdb.IsoReadCommited {
+		t.Errorf("got %s, want read committed", tx.Isolation())
+	}
+	tx.Commit(ctx)
+
+	if err := pool.Query(ctx, &rdb.Command{SQL: "select 1;", Atomic: true}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	var got []rdb.Isolation
+	for _, c := range fake.Calls() {
+		if c.Op == rdbtest.OpBegin {
+			got = append(got, c.Isolation)
+		}
+	}
+	want := []rdb.Isolation{rdb.IsoSerializable, rdb.IsoReadCommited, rdb.IsoSerializable}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("driver began %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// TypedMap is like Map but converts each value to a canonical Go type for
+// the column type so the same query returns the same types from any driver:
+//
+//	text, decimal, money, UUID, enum, JSON, XML: string
+//	binary: []byte
+//	bool: bool
+//	integer and serial types: int64, unsigned values that overflow: uint64
+//	float types: float64
+//	date and time types: time.Time
+//	duration: time.Duration
+//
+// The column Type is used, or Generic if Type is not set. NULL stays nil.
+// Values of other types, or that cannot be converted, are left as is.
+func TypedMap(row Row, schema Schema) map[string]interface{} {
+	m := make(map[string]interface{}, len(schema))
+	for _, col := range schema {
+		m[col.Name] = canonicalValue(col, row.Getx(col.Index))
+	}
+	return m
+}
+
+var (
+	stringType   = reflect.TypeOf("")
+	boolType     = reflect.TypeOf(false)
+	int64Type    = reflect.TypeOf(int64(0))
+	float64Type  = reflect.TypeOf(float64(0))
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+func columnType(col Column) Type {
+	if col.Type == 0 {
+		return col.Generic
+	}
+	return col.Type
+}
+
+// canonical returns the canonical Go type for the column type.
+func canonical(col Column) reflect.Type {
+	switch columnType(col) {
+	case Text, Decimal,
+		TypeText, TypeAnsiText, TypeVarChar, TypeAnsiVarChar, TypeChar, TypeAnsiChar,
+		TypeDecimal, TypeMoney, TypeUUID, TypeEnum, TypeJSON, TypeXML:
+		return stringType
+	case Binary, TypeBinary:
+		return bytesType
+	case Bool, TypeBool:
+		return boolType
+	case Integer,
+		TypeUint8, TypeUint16, TypeUint32, TypeUint64,
+		TypeInt8, TypeInt16, TypeInt32, TypeInt64,
+		TypeSerial16, TypeSerial32, TypeSerial64:
+		return int64Type
+	case Float, TypeFloat32, TypeFloat64:
+		return float64Type
+	case Time, TypeTimestampz, TypeTime, TypeDate, TypeTimestamp:
+		return timeType
+	case TypeDuration:
+		return durationType
+	}
+	return nil
+}
+
+func canonicalValue(col Column, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	ct := canonical(col)
+	if ct == nil || reflect.TypeOf(value) == ct {
+		return value
+	}
+	if b, ok := value.([]byte); ok && len(b) == 16 && columnType(col) == TypeUUID {
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	}
+	if v, err := convertCanonical(ct, value); err == nil {
+		return v
+	}
+	return value
+}
+
+func convertCanonical(ct reflect.Type, value interface{}) (interface{}, error) {
+	sv := reflect.ValueOf(value)
+	switch ct {
+	case stringType:
+		switch v := value.(type) {
+		case []byte:
+			return string(v), nil
+		case fmt.Stringer:
+			return v.String(), nil
+		}
+		if sv.Kind() == reflect.String {
+			return sv.String(), nil
+		}
+		return fmt.Sprint(value), nil
+	case bytesType:
+		if v, ok := value.(string); ok {
+			return []byte(v), nil
+		}
+	case boolType:
+		switch sv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return sv.Int() != 0, nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return sv.Uint() != 0, nil
+		}
+		if s, ok := textValue(value); ok {
+			return strconv.ParseBool(s)
+		}
+	case durationType:
+		switch sv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return time.Duration(sv.Int()), nil
+		}
+		if s, ok := textValue(value); ok {
+			return time.ParseDuration(s)
+		}
+	case int64Type:
+		switch sv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return sv.Int(), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if u := sv.Uint(); u > math.MaxInt64 {
+				return u, nil
+			}
+			return int64(sv.Uint()), nil
+		case reflect.Bool:
+			if sv.Bool() {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+		if s, ok := textValue(value); ok {
+			return strconv.ParseInt(s, 10, 64)
+		}
+	case float64Type:
+		switch sv.Kind() {
+		case reflect.Float32:
+			// Keep the shortest decimal form, 0.1 rather then 0.10000000149.
+			return strconv.ParseFloat(strconv.FormatFloat(sv.Float(), 'g', -1, 32), 64)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float64:
+			return sv.Convert(ct).Interface(), nil
+		}
+		if s, ok := textValue(value); ok {
+			return strconv.ParseFloat(s, 64)
+		}
+	case timeType:
+		if s, ok := textValue(value); ok {
+			for _, layout := range timeLayouts {
+				if t, err := time.Parse(layout, s); err == nil {
+					return t, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("rdb: cannot convert %T to %s", value, ct)
+}
+
+// timeLayouts are the text forms of time values drivers commonly return.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+	"15:04:05.999999999",
+}
+
+func textValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
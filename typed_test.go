@@ -0,0 +1,87 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestTypedMap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sql = "select ID, Name, Score, Active, Created, Photo, Note from Account;"
+	columns := []string{"ID", "Name", "Score", "Active", "Created", "Photo", "Note"}
+	created := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+
+	// Each fake returns the values as a different driver might.
+	native := rdbtest.NewResult(columns...).
+		Row(int32(5), "Ann", float32(0.5), true, created, []byte{1, 2}, nil)
+	native.Schema[0].Type = rdb.TypeInt32
+	native.Schema[1].Type = rdb.TypeVarChar
+	native.Schema[2].Type = rdb.TypeFloat32
+	native.Schema[3].Type = rdb.TypeBool
+	native.Schema[4].Type = rdb.TypeTimestampz
+	native.Schema[5].Type = rdb.TypeBinary
+	native.Schema[6].Type = rdb.TypeText
+
+	text := rdbtest.NewResult(columns...).
+		Row([]byte("5"), []byte("Ann"), "0.5", int64(1), "2016-05-04 03:02:01Z", "\x01\x02", nil)
+	text.Schema[0].Generic = rdb.Integer
+	text.Schema[1].Generic = rdb.Text
+	text.Schema[2].Generic = rdb.Float
+	text.Schema[3].Generic = rdb.Bool
+	text.Schema[4].Generic = rdb.Time
+	text.Schema[5].Generic = rdb.Binary
+	text.Schema[6].Generic = rdb.Text
+
+	want := map[string]interface{}{
+		"ID":      int64(5),
+		"Name":    "Ann",
+		"Score":   float64(0.5),
+		"Active":  true,
+		"Created": created,
+		"Photo":   []byte{1, 2},
+		"Note":    nil,
+	}
+	for i, set := range []*rdbtest.ResultSet{native, text} {
+		fake := rdbtest.New()
+		fake.Expect(sql).Returns(set)
+		pool, err := rdb.Open(ctx, fake.Config())
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := pool.Query(ctx, &rdb.Command{SQL: sql}).Buffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := rdb.TypedMap(b.Row[0], b.Schema)
+		for name, value := range want {
+			if got[name] == nil && value == nil {
+				continue
+			}
+			if reflect.TypeOf(got[name]) != reflect.TypeOf(value) {
+				t.Errorf("driver %d column %s: got type %T, want %T", i, name, got[name], value)
+				continue
+			}
+			if tm, ok := value.(time.Time); ok {
+				if !got[name].(time.Time).Equal(tm) {
+					t.Errorf("driver %d column %s: got %v, want %v", i, name, got[name], value)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(got[name], value) {
+				t.Errorf("driver %d column %s: got %v, want %v", i, name, got[name], value)
+			}
+		}
+		pool.Close()
+	}
+}
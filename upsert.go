@@ -0,0 +1,244 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// UpsertSyntax is the insert-or-update statement a driver supports.
+type UpsertSyntax byte
+
+// Upsert syntaxes declared by drivers.
+const (
+	UpsertNone           UpsertSyntax = iota // Upsert is not supported.
+	UpsertOnConflict                         // "INSERT ... ON CONFLICT (...) DO UPDATE", PostgreSQL and SQLite.
+	UpsertOnDuplicateKey                     // "INSERT ... ON DUPLICATE KEY UPDATE", MySQL.
+	UpsertMerge                              // "MERGE INTO ... USING (VALUES ...)", SQL Server.
+)
+
+// UpsertSyntaxer may be implemented by a driver Pool to declare the upsert
+// syntax it supports. Capabler takes precedence over it.
+type UpsertSyntaxer interface {
+	UpsertSyntax() UpsertSyntax
+}
+
+var errUpsertKey = errors.New("rdb: upsert requires at least one key column")
+
+// Upsert inserts the rows into table, updating the updateCols of rows that
+// already exist with the same keyCols. Each row holds the values of the
+// keyCols followed by the values of the updateCols. It returns the number of
+// rows affected as reported by the driver, or -1 if the driver does not
+// report it. If updateCols is empty existing rows are left unchanged.
+//
+// The statement is built for the Upsert syntax in the Capabilities of the
+// driver. ErrNotSupported is returned if it is UpsertNone. The table and
+// column names are used as is and must be quoted by the caller if required.
+//
+// If the driver declares a MaxPacketSize the rows are split into as many
+// statements as needed to keep the estimated size of each under it. The
+// statements are not atomic unless q is a Transaction. If a statement fails
+// the rows affected by the statements before it are returned with the error.
+func Upsert(ctx context.Context, q Queryer, table string, keyCols, updateCols []string, rows [][]interface{}) (int64, error) {
+	if len(keyCols) == 0 {
+		return 0, errUpsertKey
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	caps := CapabilitiesOf(q)
+	one, err := upsertSQL(caps.Upsert, table, keyCols, updateCols, 1)
+	if err != nil {
+		return 0, err
+	}
+	width := len(keyCols) + len(updateCols)
+	for i, row := range rows {
+		if len(row) != width {
+			return 0, fmt.Errorf("rdb: upsert row %d has %d values, want %d", i, len(row), width)
+		}
+	}
+	var chunks [][][]interface{}
+	if caps.MaxPacketSize > 0 {
+		two, _ := upsertSQL(caps.Upsert, table, keyCols, updateCols, 2)
+		perRow := len(two) - len(one)
+		chunks = chunkRows(rows, len(one)-perRow, perRow, caps.MaxPacketSize)
+	} else {
+		chunks = [][][]interface{}{rows}
+	}
+
+	var affected int64
+	for _, chunk := range chunks {
+		sql, _ := upsertSQL(caps.Upsert, table, keyCols, updateCols, len(chunk))
+		params := make([]Param, 0, len(chunk)*width)
+		for _, row := range chunk {
+			for _, v := range row {
+				params = append(params, Param{Value: v})
+			}
+		}
+		next := q.Query(ctx, &Command{SQL: sql, Name: "upsert " + table}, params...)
+		if _, err := next.BufferSet(); err != nil {
+			return affected, err
+		}
+		ra, ok := driverNextOf(next).(RowsAffecter)
+		if !ok || affected < 0 {
+			affected = -1
+			continue
+		}
+		affected += ra.RowsAffected()
+	}
+	return affected, nil
+}
+
+// chunkRows splits rows so the estimated size of each statement, the base
+// SQL plus perRow SQL and the values of each row, is at most max. A row
+// larger than max is placed in a chunk of its own.
+func chunkRows(rows [][]interface{}, base, perRow, max int) [][][]interface{} {
+	var chunks [][][]interface{}
+	start, size := 0, base
+	for i, row := range rows {
+		n := perRow
+		for _, v := range row {
+			n += paramSize(v)
+		}
+		if i > start && size+n > max {
+			chunks = append(chunks, rows[start:i])
+			start, size = i, base
+		}
+		size += n
+	}
+	return append(chunks, rows[start:])
+}
+
+// paramSize estimates the bytes a parameter value takes in a message.
+func paramSize(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	}
+	return 8
+}
+
+func upsertSQL(syntax UpsertSyntax, table string, keyCols, updateCols []string, count int) (string, error) {
+	cols := append(append([]string{}, keyCols...), updateCols...)
+	buf := &bytes.Buffer{}
+	switch syntax {
+	default:
+		return "", ErrNotSupported
+	case UpsertOnConflict:
+		writeInsert(buf, table, cols, count)
+		buf.WriteString(" ON CONFLICT (")
+		writeList(buf, keyCols, "")
+		if len(updateCols) == 0 {
+			buf.WriteString(") DO NOTHING;")
+			break
+		}
+		buf.WriteString(") DO UPDATE SET ")
+		for i, col := range updateCols {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			fmt.Fprintf(buf, "%s = EXCLUDED.%s", col, col)
+		}
+		buf.WriteByte(';')
+	case UpsertOnDuplicateKey:
+		writeInsert(buf, table, cols, count)
+		buf.WriteString(" ON DUPLICATE KEY UPDATE ")
+		set := updateCols
+		if len(set) == 0 {
+			// Assign a key to itself so existing rows are left unchanged.
+			set = keyCols[:1]
+		}
+		for i, col := range set {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			fmt.Fprintf(buf, "%s = VALUES(%s)", col, col)
+		}
+		buf.WriteByte(';')
+	case UpsertMerge:
+		buf.WriteString("MERGE INTO ")
+		buf.WriteString(table)
+		buf.WriteString(" AS target USING (")
+		writeValues(buf, len(cols), count)
+		buf.WriteString(") AS source (")
+		writeList(buf, cols, "")
+		buf.WriteString(") ON ")
+		for i, col := range keyCols {
+			if i > 0 {
+				buf.WriteString(" AND ")
+			}
+			fmt.Fprintf(buf, "target.%s = source.%s", col, col)
+		}
+		if len(updateCols) > 0 {
+			buf.WriteString(" WHEN MATCHED THEN UPDATE SET ")
+			for i, col := range updateCols {
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				fmt.Fprintf(buf, "%s = source.%s", col, col)
+			}
+		}
+		buf.WriteString(" WHEN NOT MATCHED THEN INSERT (")
+		writeList(buf, cols, "")
+		buf.WriteString(") VALUES (")
+		writeList(buf, cols, "source.")
+		buf.WriteString(");")
+	}
+	return buf.String(), nil
+}
+
+// writeInsert writes "INSERT INTO table (cols) VALUES (?, ?), ..." for
+// count rows.
+func writeInsert(buf *bytes.Buffer, table string, cols []string, count int) {
+	buf.WriteString("INSERT INTO ")
+	buf.WriteString(table)
+	buf.WriteString(" (")
+	writeList(buf, cols, "")
+	buf.WriteString(") ")
+	writeValues(buf, len(cols), count)
+}
+
+// writeValues writes a VALUES list of count rows of n placeholders.
+func writeValues(buf *bytes.Buffer, n, count int) {
+	buf.WriteString("VALUES ")
+	for r := 0; r < count; r++ {
+		if r > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteByte('(')
+		for c := 0; c < n; c++ {
+			if c > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteByte('?')
+		}
+		buf.WriteByte(')')
+	}
+}
+
+// writeList writes the comma separated items, each with prefix.
+func writeList(buf *bytes.Buffer, items []string, prefix string) {
+	for i, item := range items {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(prefix)
+		buf.WriteString(item)
+	}
+}
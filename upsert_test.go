@@ -0,0 +1,145 @@
+// Copyright 2016 Daniel Theophanes.
+// Use of this source code is governed by a zlib-style
+// license that can be found in the LICENSE file.
+
+package rdb_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kardianos/rdb"
+	"github.com/kardianos/rdb/rdbtest"
+	"golang.org/x/net/context"
+)
+
+func TestUpsert(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rows := [][]interface{}{
+		{int64(1), "Ann", 10},
+		{int64(2), "Bob", 20},
+	}
+	list := []struct {
+		syntax rdb.UpsertSyntax
+		sql    string
+	}{
+		{
+			syntax: rdb.UpsertOnConflict,
+			sql:    "INSERT INTO Account (ID, Name, Balance) VALUES (?, ?, ?), (?, ?, ?) ON CONFLICT (ID) DO UPDATE SET Name = EXCLUDED.Name, Balance = EXCLUDED.Balance;",
+		},
+		{
+			syntax: rdb.UpsertOnDuplicateKey,
+			sql:    "INSERT INTO Account (ID, Name, Balance) VALUES (?, ?, ?), (?, ?, ?) ON DUPLICATE KEY UPDATE Name = VALUES(Name), Balance = VALUES(Balance);",
+		},
+		{
+			syntax: rdb.UpsertMerge,
+			sql:    "MERGE INTO Account AS target USING (VALUES (?, ?, ?), (?, ?, ?)) AS source (ID, Name, Balance) ON target.ID = source.ID WHEN MATCHED THEN UPDATE SET Name = source.Name, Balance = source.Balance WHEN NOT MATCHED THEN INSERT (ID, Name, Balance) VALUES (source.ID, source.Name, source.Balance);",
+		},
+	}
+	for _, item := range list {
+		fake := rdbtest.New()
+		fake.Upsert = item.syntax
+		fake.Expect(item.sql).Affected(3)
+		pool, err := rdb.Open(ctx, fake.Config())
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := rdb.Upsert(ctx, pool, "Account", []string{"ID"}, []string{"Name", "Balance"}, rows)
+		if err != nil {
+			t.Fatalf("syntax %d: %v", item.syntax, err)
+		}
+		if n != 3 {
+			t.Errorf("syntax %d: got %d rows affected, want 3", item.syntax, n)
+		}
+		calls := fake.Calls()
+		if len(calls) != 1 || len(calls[0].Params) != 6 || calls[0].Params[4].Value != "Bob" {
+			t.Errorf("syntax %d: unexpected calls %+v", item.syntax, calls)
+		}
+		pool.Close()
+	}
+
+	fake := rdbtest.New()
+	if _, err := rdb.Upsert(ctx, fake, "Account", []string{"ID"}, nil, rows[:1]); err != rdb.ErrNotSupported {
+		t.Errorf("got %v, want ErrNotSupported", err)
+	}
+	fake.Upsert = rdb.UpsertOnConflict
+	pool, err := rdb.Open(ctx, fake.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if _, err := rdb.Upsert(ctx, pool, "Account", []string{"ID"}, []string{"Name"}, rows); err == nil {
+		t.Error("expected error for row width")
+	}
+}
+
+func TestUpsertPacketSize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	long := strings.Repeat("x", 100)
+	rows := [][]interface{}{
+		{int64(1), "Ann"},
+		{int64(2), long},
+		{int64(3), "Cid"},
+		{int64(4), "Dee"},
+	}
+	fake := rdbtest.New()
+	fake.Upsert = rdb.UpsertOnDuplicateKey
+	one := fake.Expect("INSERT INTO Account (ID, Name) VALUES (?, ?) ON DUPLICATE KEY UPDATE Name = VALUES(Name);").Affected(1)
+	two := fake.Expect("INSERT INTO Account (ID, Name) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE Name = VALUES(Name);").Affected(2)
+	conf := fake.Config()
+	conf.MaxPacketSize = 150
+	pool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	if got := rdb.CapabilitiesOf(pool).MaxPacketSize; got != 150 {
+		t.Fatalf("got max packet size %d, want 150", got)
+	}
+	n, err := rdb.Upsert(ctx, pool, "Account", []string{"ID"}, []string{"Name"}, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("got %d rows affected, want 4", n)
+	}
+	// The long row does not fit with the first and is sent on its own.
+	calls := fake.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("got %d statements, want 3", len(calls))
+	}
+	for i, want := range []int{1, 1, 2} {
+		if got := len(calls[i].Params) / 2; got != want {
+			t.Errorf("statement %d: got %d rows, want %d", i, got, want)
+		}
+	}
+	if calls[1].Params[1].Value != long || calls[2].Params[0].Value != int64(3) {
+		t.Errorf("unexpected calls %+v", calls)
+	}
+	if one.Called() != 2 || two.Called() != 1 {
+		t.Errorf("got %d single and %d double row statements", one.Called(), two.Called())
+	}
+	// A failed statement returns the rows affected before it.
+	errFail := errors.New("deadlock")
+	fake = rdbtest.New()
+	fake.Upsert = rdb.UpsertOnDuplicateKey
+	fake.Expect("INSERT INTO Account (ID, Name) VALUES (?, ?) ON DUPLICATE KEY UPDATE Name = VALUES(Name);").Affected(1)
+	fake.Expect("INSERT INTO Account (ID, Name) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE Name = VALUES(Name);").Error(errFail)
+	conf = fake.Config()
+	conf.MaxPacketSize = 150
+	failPool, err := rdb.Open(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer failPool.Close()
+	n, err = rdb.Upsert(ctx, failPool, "Account", []string{"ID"}, []string{"Name"}, rows)
+	if err != errFail || n != 2 {
+		t.Errorf("got %d rows affected and %v, want 2 and %v", n, err, errFail)
+	}
+}